@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	adapterHttp "github.com/freischarler/desafio-twitter/internal/adapters/http"
@@ -11,6 +14,7 @@ import (
 	"github.com/freischarler/desafio-twitter/internal/infraestructure/dynamoDb"
 	"github.com/freischarler/desafio-twitter/internal/infraestructure/redis"
 	"github.com/freischarler/desafio-twitter/internal/middleware"
+	"github.com/freischarler/desafio-twitter/internal/snowflake"
 )
 
 func main() {
@@ -22,21 +26,137 @@ func main() {
 	// Setting up tables
 	dynamoConfigurator.SetupDatabase()
 
+	// One-off migration of the follow graph to directed follows
+	if os.Getenv("MIGRATE_FOLLOW_GRAPH") == "true" {
+		if err := dynamoConfigurator.MigrateFollowGraph(); err != nil {
+			log.Fatalf("Could not migrate follow graph: %s\n", err)
+		}
+	}
+
+	// One-off count of the follows made before follow counts were kept
+	if os.Getenv("MIGRATE_FOLLOW_COUNTS") == "true" {
+		if err := dynamoConfigurator.MigrateFollowCounts(); err != nil {
+			log.Fatalf("Could not migrate follow counts: %s\n", err)
+		}
+	}
+
 	redisClient := redis.NewRedisClient()
 
 	// Crear los servicios usando DynamoDB
 	tweetService := application.NewDynamoRedisTweetService(dynamoDBClient, redisClient)
-	userService := application.NewDynamoDBUserService(dynamoDBClient)
+	userService := application.NewDynamoDBUserService(dynamoDBClient, redisClient)
+	trendService := application.NewRedisTrendService(redisClient)
+	tweetService.Trends = trendService
+
+	// Followers cannot be read until their index is built, which may take
+	// hours on a table created before the directed graph; until then
+	// listing them fails and the jobs reading them wait
+	followersIndexReady := new(atomic.Bool)
+	tweetService.FollowersIndexReady = followersIndexReady
+	userService.FollowersIndexReady = followersIndexReady
+	go func() {
+		if err := dynamoConfigurator.WaitForIndex(dynamoDb.UserFollowersTable, dynamoDb.FollowersIndex); err != nil {
+			log.Printf("Could not wait for index %s: %s\n", dynamoDb.FollowersIndex, err)
+			return
+		}
+		followersIndexReady.Store(true)
+		log.Printf("Reading followers from index %s\n", dynamoDb.FollowersIndex)
+
+		// One-off copy of the tweets posted before home timelines were
+		// materialized; it writes a row per tweet and follower, so it runs
+		// in the background
+		if os.Getenv("MIGRATE_HOME_TIMELINES") == "true" {
+			if err := dynamoConfigurator.MigrateHomeTimelines(); err != nil {
+				log.Printf("Could not migrate home timelines: %s\n", err)
+			}
+		}
+	}()
+
+	// Tweets of a user are read from the legacy index until the sorted one is
+	// built, which may take hours on a large table. Only then can the legacy
+	// index and the old tweet lists be dropped.
+	userTweetsIndexReady := new(atomic.Bool)
+	tweetService.UserTweetsIndexReady = userTweetsIndexReady
+	go func() {
+		if err := dynamoConfigurator.WaitForIndex(dynamoDb.TweetsTable, dynamoDb.UserTweetsIndex); err != nil {
+			log.Printf("Could not wait for index %s: %s\n", dynamoDb.UserTweetsIndex, err)
+			return
+		}
+		userTweetsIndexReady.Store(true)
+		log.Printf("Reading user tweets from index %s\n", dynamoDb.UserTweetsIndex)
 
-	mux := http.NewServeMux()
+		if os.Getenv("MIGRATE_USER_TIMELINES") == "true" {
+			// The migration copies tweets to the home timelines of followers
+			if err := dynamoConfigurator.WaitForIndex(dynamoDb.UserFollowersTable, dynamoDb.FollowersIndex); err != nil {
+				log.Printf("Could not wait for index %s: %s\n", dynamoDb.FollowersIndex, err)
+				return
+			}
+			if err := dynamoConfigurator.MigrateUserTimelines(); err != nil {
+				log.Printf("Could not migrate user timelines: %s\n", err)
+			}
+		}
+	}()
 
-	mux.HandleFunc("/tweet", adapterHttp.PostTweet(tweetService))    // Post a tweet
-	mux.HandleFunc("/follow", adapterHttp.FollowUser(userService))   // Follow a user
-	mux.HandleFunc("/timeline/", adapterHttp.Timeline(tweetService)) // View timeline
+	// Conversations cannot be read until their index is built, which may
+	// take hours on a table created before replies
+	conversationsIndexReady := new(atomic.Bool)
+	tweetService.ConversationsIndexReady = conversationsIndexReady
+	go func() {
+		if err := dynamoConfigurator.WaitForIndex(dynamoDb.TweetsTable, dynamoDb.ConversationsIndex); err != nil {
+			log.Printf("Could not wait for index %s: %s\n", dynamoDb.ConversationsIndex, err)
+			return
+		}
+		conversationsIndexReady.Store(true)
+		log.Printf("Reading conversations from index %s\n", dynamoDb.ConversationsIndex)
+	}()
+
+	// Bound every backend call, so a slow backend cannot hold requests
+	timeouts := application.Timeouts{
+		Read:  durationEnv("READ_TIMEOUT", application.DefaultTimeouts.Read),
+		Write: durationEnv("WRITE_TIMEOUT", application.DefaultTimeouts.Write),
+	}
+	tweetService.Timeouts = timeouts
+	userService.Timeouts = timeouts
+	trendService.Timeouts = timeouts
+
+	// Tweet and user IDs are unique across instances as long as each one
+	// runs with its own worker ID, so there is no default: two instances left
+	// on the same one would generate colliding IDs
+	value := os.Getenv("WORKER_ID")
+	if value == "" {
+		log.Fatal("WORKER_ID is required to generate unique IDs")
+	}
+	workerID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid WORKER_ID %q: %s\n", value, err)
+	}
+	ids, err := snowflake.NewGenerator(workerID)
+	if err != nil {
+		log.Fatalf("Could not create ID generator: %s\n", err)
+	}
+	tweetService.IDs = ids
+	userService.IDs = ids
+
+	// Work that outgrows a request, like listing a new celebrity for every
+	// follower, runs in the background on every instance
+	go tweetService.RunJobs(context.Background())
+
+	// Requests act as the user of their bearer token
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		log.Fatal("JWT_SECRET is required to authenticate requests")
+	}
+	authenticator := middleware.NewAuthenticator([]byte(jwtSecret), middleware.WithUnauthorizedHandler(adapterHttp.Unauthorized))
+
+	router := adapterHttp.NewRouter(tweetService, userService, trendService, authenticator)
+	handler := authenticator.Middleware(router)
 
 	// Apply rate limiting middleware
-	rateLimitMiddleware := middleware.RateLimitMiddleware(time.Minute, 100)
-	handler := rateLimitMiddleware(mux)
+	rateLimitMiddleware := middleware.RateLimitMiddleware(time.Minute, 100, middleware.WithLimitHandler(adapterHttp.TooManyRequests))
+	handler = rateLimitMiddleware(handler)
+
+	// Tag every request with an ID, including the rate limited ones
+	handler = middleware.RequestIDMiddleware(handler)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -48,3 +168,17 @@ func main() {
 		log.Fatalf("Could not start server: %s\n", err)
 	}
 }
+
+// durationEnv returns the duration in an environment variable, like "2s",
+// or fallback when it is not set
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %s\n", name, value, err)
+	}
+	return duration
+}
@@ -38,6 +38,31 @@ func (m *MockDynamoDBClient) UpdateItem(ctx context.Context, input *dynamodb.Upd
 	return &dynamodb.UpdateItemOutput{}, nil
 }
 
+func (m *MockDynamoDBClient) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	// Mock implementation
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (m *MockDynamoDBClient) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	// Mock implementation
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (m *MockDynamoDBClient) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	// Mock implementation
+	return &dynamodb.BatchGetItemOutput{}, nil
+}
+
+func (m *MockDynamoDBClient) Scan(ctx context.Context, input *dynamodb.ScanInput, opts ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	// Mock implementation
+	return &dynamodb.ScanOutput{}, nil
+}
+
+func (m *MockDynamoDBClient) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	// Mock implementation
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
 type MockRedisClient struct{}
 
 func (m *MockRedisClient) Get(ctx context.Context, key string) *redis.StringCmd {
@@ -50,6 +75,41 @@ func (m *MockRedisClient) Set(ctx context.Context, key string, value interface{}
 	return redis.NewStatusResult("", nil)
 }
 
+func (m *MockRedisClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	// Mock implementation
+	return redis.NewBoolResult(true, nil)
+}
+
+func (m *MockRedisClient) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	// Mock implementation
+	return redis.NewIntResult(0, nil)
+}
+
+func (m *MockRedisClient) MGet(ctx context.Context, keys ...string) *redis.SliceCmd {
+	// Mock implementation
+	return redis.NewSliceResult(make([]interface{}, len(keys)), nil)
+}
+
+func (m *MockRedisClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	// Mock implementation
+	return redis.NewCmdResult(nil, redis.Nil)
+}
+
+func (m *MockRedisClient) ZIncrBy(ctx context.Context, key string, increment float64, member string) *redis.FloatCmd {
+	// Mock implementation
+	return redis.NewFloatResult(increment, nil)
+}
+
+func (m *MockRedisClient) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	// Mock implementation
+	return redis.NewBoolResult(true, nil)
+}
+
+func (m *MockRedisClient) ZRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd {
+	// Mock implementation
+	return redis.NewZSliceCmdResult(nil, nil)
+}
+
 func TestMain(m *testing.M) {
 	// Set up mock environment variables
 	os.Setenv("PORT", "8080")
@@ -68,15 +128,15 @@ func TestServerSetup(t *testing.T) {
 	redisClient := &MockRedisClient{}
 
 	tweetService := application.NewDynamoRedisTweetService(dynamoDBClient, redisClient)
-	userService := application.NewDynamoDBUserService(dynamoDBClient)
+	userService := application.NewDynamoDBUserService(dynamoDBClient, redisClient)
+	trendService := application.NewRedisTrendService(redisClient)
+	tweetService.Trends = trendService
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/tweet", adapterHttp.PostTweet(tweetService))
-	mux.HandleFunc("/follow", adapterHttp.FollowUser(userService))
-	mux.HandleFunc("/timeline/", adapterHttp.Timeline(tweetService))
+	authenticator := middleware.NewAuthenticator([]byte("secret"), middleware.WithUnauthorizedHandler(adapterHttp.Unauthorized))
+	router := adapterHttp.NewRouter(tweetService, userService, trendService, authenticator)
 
-	rateLimitMiddleware := middleware.RateLimitMiddleware(time.Minute, 100)
-	handler := rateLimitMiddleware(mux)
+	rateLimitMiddleware := middleware.RateLimitMiddleware(time.Minute, 100, middleware.WithLimitHandler(adapterHttp.TooManyRequests))
+	handler := middleware.RequestIDMiddleware(rateLimitMiddleware(authenticator.Middleware(router)))
 
 	server := httptest.NewServer(handler)
 	defer server.Close()
@@ -86,17 +146,71 @@ func TestServerSetup(t *testing.T) {
 	assert.NoError(t, err)
 	resp, err := http.DefaultClient.Do(req)
 	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.NotEmpty(t, resp.Header.Get("X-Request-ID"))
+
+	// Test POST /tweet with a token
+	token, err := authenticator.IssueToken("1", time.Hour)
+	assert.NoError(t, err)
+	req, err = http.NewRequest("POST", server.URL+"/tweet", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
 	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 
+	// Test POST /tweet with an invalid token
+	req, err = http.NewRequest("POST", server.URL+"/tweet", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer invalid")
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
 	// Test POST /follow
 	req, err = http.NewRequest("POST", server.URL+"/follow", nil)
 	assert.NoError(t, err)
 	resp, err = http.DefaultClient.Do(req)
 	assert.NoError(t, err)
-	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
 
 	// Test GET /timeline/
 	resp, err = http.Get(server.URL + "/timeline/")
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Test GET /users/{id}/followers
+	resp, err = http.Get(server.URL + "/users/1/followers")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Test GET /trends
+	resp, err = http.Get(server.URL + "/trends")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Test GET /v1/users/{id}/followers
+	resp, err = http.Get(server.URL + "/v1/users/1/followers")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Test GET /v1/tweets is not allowed
+	resp, err = http.Get(server.URL + "/v1/tweets")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.Equal(t, "POST", resp.Header.Get("Allow"))
+}
+
+func TestDurationEnv(t *testing.T) {
+	t.Run("should read a duration", func(t *testing.T) {
+		t.Setenv("READ_TIMEOUT", "500ms")
+		assert.Equal(t, 500*time.Millisecond, durationEnv("READ_TIMEOUT", time.Second))
+	})
+
+	t.Run("should fall back when the variable is not set", func(t *testing.T) {
+		t.Setenv("READ_TIMEOUT", "")
+		assert.Equal(t, time.Second, durationEnv("READ_TIMEOUT", time.Second))
+	})
 }
@@ -0,0 +1,118 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/freischarler/desafio-twitter/internal/domain"
+)
+
+// TokenTTL is how long the tokens issued on registration and login last
+const TokenTTL = 24 * time.Hour
+
+// TokenIssuer issues the bearer tokens users authenticate with
+type TokenIssuer interface {
+	IssueToken(userID string, ttl time.Duration) (string, error)
+}
+
+// TokenResponse is the body of a successful registration or login
+type TokenResponse struct {
+	Token string `json:"token"`
+	// ExpiresIn is the number of seconds the token is valid for
+	ExpiresIn int64       `json:"expiresIn"`
+	User      domain.User `json:"user"`
+}
+
+// Register handles signing up a user
+func Register(userService domain.UserService, tokens TokenIssuer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
+		var req registerRequest
+		if err := decodeRequest(w, r, &req); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+
+		if req.Handle == "" || req.Password == "" {
+			writeError(w, r, badRequest("Both handle and password are required"), "")
+			return
+		}
+
+		user, err := userService.Register(r.Context(), domain.Registration{
+			Handle:      req.Handle,
+			DisplayName: req.DisplayName,
+			Password:    req.Password,
+		})
+		if err != nil {
+			writeError(w, r, err, "Failed to register user")
+			return
+		}
+
+		writeToken(w, r, tokens, user, http.StatusCreated)
+		log.Printf("User %s registered successfully", user.ID)
+	}
+}
+
+// Login handles exchanging the credentials of a user for a token
+func Login(userService domain.UserService, tokens TokenIssuer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
+		var req loginRequest
+		if err := decodeRequest(w, r, &req); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+
+		if req.Handle == "" || req.Password == "" {
+			writeError(w, r, badRequest("Both handle and password are required"), "")
+			return
+		}
+
+		user, err := userService.Login(r.Context(), req.Handle, req.Password)
+		if err != nil {
+			writeError(w, r, err, "Failed to log in")
+			return
+		}
+
+		writeToken(w, r, tokens, user, http.StatusOK)
+		log.Printf("User %s logged in successfully", user.ID)
+	}
+}
+
+// GetProfile handles viewing the profile of a user
+func GetProfile(userService domain.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
+		userID := r.PathValue("id")
+
+		user, err := userService.GetProfile(r.Context(), userID)
+		if err != nil {
+			writeError(w, r, err, "Failed to fetch user")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+		log.Printf("Fetched profile of user %s successfully", userID)
+	}
+}
+
+// writeToken answers a request with a new token for user
+func writeToken(w http.ResponseWriter, r *http.Request, tokens TokenIssuer, user domain.User, status int) {
+	token, err := tokens.IssueToken(user.ID, TokenTTL)
+	if err != nil {
+		writeError(w, r, err, "Failed to issue token")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(TokenResponse{
+		Token:     token,
+		ExpiresIn: int64(TokenTTL / time.Second),
+		User:      user,
+	})
+}
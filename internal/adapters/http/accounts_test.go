@@ -0,0 +1,179 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/freischarler/desafio-twitter/internal/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	authenticator := middleware.NewAuthenticator([]byte("secret"))
+	mockUserService := &MockUserService{
+		RegisterFunc: func(ctx context.Context, registration domain.Registration) (domain.User, error) {
+			if registration.Handle == "taken" {
+				return domain.User{}, domain.ErrHandleTaken
+			}
+			if _, err := registration.Validate(); err != nil {
+				return domain.User{}, err
+			}
+			return domain.User{ID: "1", Handle: registration.Handle, DisplayName: registration.DisplayName}, nil
+		},
+	}
+
+	handler := Register(mockUserService, authenticator)
+
+	t.Run("should register a user and issue a token", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`{"handle": "ada", "displayName": "Ada", "password": "correct horse"}`)
+		req, err := http.NewRequest("POST", "/v1/users", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var response TokenResponse
+		err = json.NewDecoder(rr.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", response.User.ID)
+		assert.Equal(t, "ada", response.User.Handle)
+		assert.NotContains(t, rr.Body.String(), "correct horse")
+
+		principal, err := authenticator.Authenticate(response.Token)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", principal.UserID)
+	})
+
+	t.Run("should return conflict if the handle is taken", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`handle=taken&password=correct horse`)
+		req, err := http.NewRequest("POST", "/v1/users", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"code":"handle_taken"`)
+	})
+
+	t.Run("should return bad request for a short password", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`handle=ada&password=short`)
+		req, err := http.NewRequest("POST", "/v1/users", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"code":"invalid_password"`)
+	})
+
+	t.Run("should return error if handle or password is missing", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`handle=ada`)
+		req, err := http.NewRequest("POST", "/v1/users", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Both handle and password are required")
+	})
+}
+
+func TestLogin(t *testing.T) {
+	authenticator := middleware.NewAuthenticator([]byte("secret"))
+	mockUserService := &MockUserService{
+		LoginFunc: func(ctx context.Context, handle, password string) (domain.User, error) {
+			if handle != "ada" || password != "correct horse" {
+				return domain.User{}, domain.ErrInvalidCredentials
+			}
+			return domain.User{ID: "1", Handle: "ada"}, nil
+		},
+	}
+
+	handler := Login(mockUserService, authenticator)
+
+	t.Run("should issue a token for valid credentials", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`handle=ada&password=correct horse`)
+		req, err := http.NewRequest("POST", "/v1/login", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+		var response TokenResponse
+		err = json.NewDecoder(rr.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(TokenTTL.Seconds()), response.ExpiresIn)
+
+		principal, err := authenticator.Authenticate(response.Token)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", principal.UserID)
+	})
+
+	t.Run("should return unauthorized for a wrong password", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`handle=ada&password=wrong horse`)
+		req, err := http.NewRequest("POST", "/v1/login", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"code":"invalid_credentials"`)
+	})
+}
+
+func TestGetProfile(t *testing.T) {
+	mockUserService := &MockUserService{
+		GetProfileFunc: func(ctx context.Context, userID string) (domain.User, error) {
+			if userID == "404" {
+				return domain.User{}, domain.ErrUserNotFound
+			}
+			return domain.User{ID: userID, Handle: "ada", DisplayName: "Ada", CreatedAt: 1}, nil
+		},
+	}
+
+	handler := GetProfile(mockUserService)
+
+	t.Run("should return the profile of a user", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/1", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("id", "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var user domain.User
+		err = json.NewDecoder(rr.Body).Decode(&user)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.User{ID: "1", Handle: "ada", DisplayName: "Ada", CreatedAt: 1}, user)
+	})
+
+	t.Run("should return not found if the user does not exist", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/404", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("id", "404")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
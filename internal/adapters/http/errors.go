@@ -0,0 +1,124 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/freischarler/desafio-twitter/internal/middleware"
+)
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	// Code identifies the error for clients, like "tweet_not_found"
+	Code string `json:"code"`
+	// Message describes the error for humans
+	Message string `json:"message"`
+	// RequestID is the ID of the failed request, also found in the logs
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// errorMapping is how a domain error is answered
+type errorMapping struct {
+	err    error
+	status int
+	code   string
+}
+
+// errorMappings translates domain errors to responses. Errors not listed
+// here are internal errors.
+var errorMappings = []errorMapping{
+	{domain.ErrTweetEmpty, http.StatusBadRequest, "tweet_empty"},
+	{domain.ErrTweetTooLong, http.StatusBadRequest, "tweet_too_long"},
+	{domain.ErrInvalidTweetID, http.StatusBadRequest, "invalid_tweet_id"},
+	{domain.ErrInvalidCursor, http.StatusBadRequest, "invalid_cursor"},
+	{domain.ErrInvalidHashtag, http.StatusBadRequest, "invalid_hashtag"},
+	{domain.ErrCannotFollowSelf, http.StatusBadRequest, "cannot_follow_self"},
+	{domain.ErrInvalidHandle, http.StatusBadRequest, "invalid_handle"},
+	{domain.ErrInvalidDisplayName, http.StatusBadRequest, "invalid_display_name"},
+	{domain.ErrInvalidPassword, http.StatusBadRequest, "invalid_password"},
+	{domain.ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials"},
+	{domain.ErrUnauthenticated, http.StatusUnauthorized, "unauthenticated"},
+	{domain.ErrNotPrincipal, http.StatusForbidden, "forbidden"},
+	{domain.ErrNotTweetOwner, http.StatusForbidden, "not_tweet_owner"},
+	{domain.ErrTweetNotFound, http.StatusNotFound, "tweet_not_found"},
+	{domain.ErrReplyToNotFound, http.StatusNotFound, "reply_to_not_found"},
+	{domain.ErrQuotedNotFound, http.StatusNotFound, "quoted_not_found"},
+	{domain.ErrUserNotFound, http.StatusNotFound, "user_not_found"},
+	{domain.ErrAlreadyRetweeted, http.StatusConflict, "already_retweeted"},
+	{domain.ErrHandleTaken, http.StatusConflict, "handle_taken"},
+	{domain.ErrRateLimited, http.StatusTooManyRequests, "rate_limited"},
+	{domain.ErrIndexNotReady, http.StatusServiceUnavailable, "index_not_ready"},
+	// A backend call outlived the timeout of its operation
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, "timeout"},
+}
+
+// requestError is an error in the request itself, found by a handler before
+// calling a service
+type requestError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// badRequest returns the error for a missing or malformed parameter
+func badRequest(message string) error {
+	return &requestError{status: http.StatusBadRequest, code: "invalid_request", message: message}
+}
+
+// writeError answers a request with the JSON response for err and logs it.
+// Internal errors are answered with the given message, so their details
+// only reach the logs.
+func writeError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	status, response := translateError(err, message)
+	response.RequestID = middleware.RequestID(r.Context())
+
+	log.Printf("Request %s %s %s failed with %d: %v", response.RequestID, r.Method, r.URL.Path, status, err)
+
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// translateError returns the status and body of the response for err
+func translateError(err error, message string) (int, ErrorResponse) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.status, ErrorResponse{Code: reqErr.code, Message: reqErr.message}
+	}
+
+	for _, mapping := range errorMappings {
+		if !errors.Is(err, mapping.err) {
+			continue
+		}
+		// Validation errors explain what is wrong with the tweet
+		var validationErr *domain.TweetValidationError
+		if errors.As(err, &validationErr) {
+			return mapping.status, ErrorResponse{Code: mapping.code, Message: validationErr.Error()}
+		}
+		return mapping.status, ErrorResponse{Code: mapping.code, Message: mapping.err.Error()}
+	}
+
+	return http.StatusInternalServerError, ErrorResponse{Code: "internal_error", Message: message}
+}
+
+// TooManyRequests answers a request over the rate limit
+func TooManyRequests(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, domain.ErrRateLimited, "")
+}
+
+// Unauthorized answers a request with an invalid bearer token
+func Unauthorized(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, domain.ErrUnauthenticated, "")
+}
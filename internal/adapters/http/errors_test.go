@@ -0,0 +1,73 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/freischarler/desafio-twitter/internal/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"request error", badRequest("userID is required"), http.StatusBadRequest, "invalid_request"},
+		{"tweet too long", &domain.TweetValidationError{Err: domain.ErrTweetTooLong, Length: 300, Max: 280}, http.StatusBadRequest, "tweet_too_long"},
+		{"cannot follow self", domain.ErrCannotFollowSelf, http.StatusBadRequest, "cannot_follow_self"},
+		{"not tweet owner", domain.ErrNotTweetOwner, http.StatusForbidden, "not_tweet_owner"},
+		{"wrapped not found", fmt.Errorf("delete: %w", domain.ErrTweetNotFound), http.StatusNotFound, "tweet_not_found"},
+		{"already retweeted", domain.ErrAlreadyRetweeted, http.StatusConflict, "already_retweeted"},
+		{"rate limited", domain.ErrRateLimited, http.StatusTooManyRequests, "rate_limited"},
+		{"index not ready", domain.ErrIndexNotReady, http.StatusServiceUnavailable, "index_not_ready"},
+		{"timeout", fmt.Errorf("get item: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "timeout"},
+		{"internal error", errors.New("connection refused"), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run("should map "+tt.name, func(t *testing.T) {
+			status, response := translateError(tt.err, "Failed")
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.code, response.Code)
+		})
+	}
+
+	t.Run("should explain validation errors", func(t *testing.T) {
+		_, response := translateError(&domain.TweetValidationError{Err: domain.ErrTweetTooLong, Length: 300, Max: 280}, "Failed")
+		assert.Equal(t, "tweet is too long: 300 characters, the maximum is 280", response.Message)
+	})
+
+	t.Run("should hide the details of internal errors", func(t *testing.T) {
+		_, response := translateError(errors.New("connection refused"), "Failed to save tweet")
+		assert.Equal(t, "Failed to save tweet", response.Message)
+	})
+}
+
+func TestWriteError(t *testing.T) {
+	handler := middleware.RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, domain.ErrTweetNotFound, "Failed")
+	}))
+
+	req, err := http.NewRequest("GET", "/tweets/1", nil)
+	assert.NoError(t, err)
+	req.Header.Set(middleware.RequestIDHeader, "abc-123")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var response ErrorResponse
+	err = json.NewDecoder(rr.Body).Decode(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrorResponse{Code: "tweet_not_found", Message: "tweet not found", RequestID: "abc-123"}, response)
+}
@@ -1,9 +1,11 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/freischarler/desafio-twitter/internal/domain"
 )
@@ -12,25 +14,33 @@ import (
 func PostTweet(tweetService domain.TweetService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
-		r.ParseForm()
-		userID := r.FormValue("userID")
-		tweet := r.FormValue("tweet")
+		var req postTweetRequest
+		if err := decodeRequest(w, r, &req); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
 
-		if userID == "" {
-			http.Error(w, "userID is required", http.StatusBadRequest)
-			log.Printf("Failed to post tweet: userID is required")
+		userID, err := actingUser(r, req.UserID)
+		if err != nil {
+			writeError(w, r, err, "")
 			return
 		}
-		if tweet == "" {
-			http.Error(w, "tweet is required", http.StatusBadRequest)
-			log.Printf("Failed to post tweet: tweet is required")
+		if req.Tweet == "" {
+			writeError(w, r, badRequest("tweet is required"), "")
 			return
 		}
 
-		tweetID, err := tweetService.PostTweet(userID, tweet)
+		var opts []domain.PostOption
+		if req.InReplyToTweetID != "" {
+			opts = append(opts, domain.InReplyTo(req.InReplyToTweetID))
+		}
+		if req.QuotedTweetID != "" {
+			opts = append(opts, domain.Quoting(req.QuotedTweetID))
+		}
+
+		tweetID, err := tweetService.PostTweet(r.Context(), userID, req.Tweet, opts...)
 		if err != nil {
-			http.Error(w, "Failed to save tweet", http.StatusInternalServerError)
-			log.Printf("Failed to save tweet: %v", err)
+			writeError(w, r, err, "Failed to save tweet")
 			return
 		}
 
@@ -41,23 +51,160 @@ func PostTweet(tweetService domain.TweetService) http.HandlerFunc {
 	}
 }
 
+// GetTweet handles viewing a tweet
+func GetTweet(tweetService domain.TweetService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
+		tweetID := r.PathValue("id")
+
+		tweet, err := tweetService.GetTweet(r.Context(), tweetID)
+		if err != nil {
+			writeError(w, r, err, "Failed to fetch tweet")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tweet)
+		log.Printf("Fetched tweet %s successfully", tweetID)
+	}
+}
+
+// DeleteTweet handles deleting a tweet
+func DeleteTweet(tweetService domain.TweetService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
+		tweetID := r.PathValue("id")
+		var req userRequest
+		if err := decodeRequest(w, r, &req); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		userID, err := actingUser(r, req.UserID)
+		if err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+
+		if err := tweetService.DeleteTweet(r.Context(), userID, tweetID); err != nil {
+			writeError(w, r, err, "Failed to delete tweet")
+			return
+		}
+
+		response := map[string]string{"message": "Tweet deleted successfully"}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		log.Printf("Tweet deleted successfully: %s", tweetID)
+	}
+}
+
+// Retweet handles resharing a tweet
+func Retweet(tweetService domain.TweetService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
+		tweetID := r.PathValue("id")
+		var req userRequest
+		if err := decodeRequest(w, r, &req); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		userID, err := actingUser(r, req.UserID)
+		if err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+
+		retweetID, err := tweetService.Retweet(r.Context(), userID, tweetID)
+		if err != nil {
+			writeError(w, r, err, "Failed to retweet")
+			return
+		}
+
+		response := map[string]string{"message": "Retweeted successfully", "tweetID": retweetID}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		log.Printf("User %s retweeted tweet %s successfully", userID, tweetID)
+	}
+}
+
+// LikeTweet handles liking a tweet
+func LikeTweet(tweetService domain.TweetService) http.HandlerFunc {
+	return likeAction("like", tweetService.LikeTweet)
+}
+
+// UnlikeTweet handles removing a like from a tweet
+func UnlikeTweet(tweetService domain.TweetService) http.HandlerFunc {
+	return likeAction("unlike", tweetService.UnlikeTweet)
+}
+
+// likeAction handles liking or unliking the tweet in the path
+func likeAction(name string, action func(ctx context.Context, userID, tweetID string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
+		tweetID := r.PathValue("id")
+		var req userRequest
+		if err := decodeRequest(w, r, &req); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		userID, err := actingUser(r, req.UserID)
+		if err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+
+		if err := action(r.Context(), userID, tweetID); err != nil {
+			writeError(w, r, err, "Failed to "+name+" tweet")
+			return
+		}
+
+		response := map[string]string{"message": "Tweet " + name + "d successfully"}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		log.Printf("User %s %sd tweet %s successfully", userID, name, tweetID)
+	}
+}
+
+// Conversation handles viewing the conversation a tweet belongs to
+func Conversation(tweetService domain.TweetService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
+		tweetID := r.PathValue("id")
+
+		conversation, err := tweetService.GetConversation(r.Context(), tweetID)
+		if err != nil {
+			writeError(w, r, err, "Failed to fetch conversation")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(conversation)
+		log.Printf("Fetched conversation for tweet %s successfully", tweetID)
+	}
+}
+
 // FollowUser handles following a user
 func FollowUser(userService domain.UserService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
-		r.ParseForm()
-		followerID := r.FormValue("followerID")
-		followeeID := r.FormValue("followeeID")
+		var req followRequest
+		if err := decodeRequest(w, r, &req); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		followerID, err := actingUser(r, req.FollowerID)
+		if err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		followeeID := req.FolloweeID
 
-		if followerID == "" || followeeID == "" {
-			http.Error(w, "Both followerID and followeeID are required", http.StatusBadRequest)
-			log.Printf("Failed to follow user: Missing followerID or followeeID")
+		if followeeID == "" {
+			writeError(w, r, badRequest("followeeID is required"), "")
 			return
 		}
 
-		if err := userService.FollowUser(followerID, followeeID); err != nil {
-			http.Error(w, "Failed to follow user", http.StatusInternalServerError)
-			log.Printf("Failed to follow user: %v", err)
+		if err := userService.FollowUser(r.Context(), followerID, followeeID); err != nil {
+			writeError(w, r, err, "Failed to follow user")
 			return
 		}
 
@@ -68,27 +215,210 @@ func FollowUser(userService domain.UserService) http.HandlerFunc {
 	}
 }
 
+// UnfollowUser handles unfollowing a user
+func UnfollowUser(userService domain.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
+		var req followRequest
+		if err := decodeRequest(w, r, &req); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		followerID, err := actingUser(r, req.FollowerID)
+		if err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		followeeID := req.FolloweeID
+
+		if followeeID == "" {
+			writeError(w, r, badRequest("followeeID is required"), "")
+			return
+		}
+
+		if err := userService.UnfollowUser(r.Context(), followerID, followeeID); err != nil {
+			writeError(w, r, err, "Failed to unfollow user")
+			return
+		}
+
+		response := map[string]string{"message": "Unfollowed successfully"}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		log.Printf("User %s unfollowed user %s successfully", followerID, followeeID)
+	}
+}
+
+// Followers handles listing the followers of a user
+func Followers(userService domain.UserService) http.HandlerFunc {
+	return userList("followers", userService.GetFollowers)
+}
+
+// Following handles listing the users a user follows
+func Following(userService domain.UserService) http.HandlerFunc {
+	return userList("following", userService.GetFollowing)
+}
+
+// userList handles listing a page of users related to the user in the path
+func userList(name string, list func(ctx context.Context, userID string, page domain.PageRequest) (domain.UserPage, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
+		userID := r.PathValue("id")
+
+		if userID == "" {
+			writeError(w, r, badRequest("userID is required"), "")
+			return
+		}
+
+		page, err := parsePageRequest(r)
+		if err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+
+		users, err := list(r.Context(), userID, page)
+		if err != nil {
+			writeError(w, r, err, "Failed to fetch "+name)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(users)
+		log.Printf("Fetched %s for user %s successfully", name, userID)
+	}
+}
+
+// Likes handles listing the tweets a user liked
+func Likes(tweetService domain.TweetService) http.HandlerFunc {
+	return tweetList("likes", tweetService.GetLikedTweets)
+}
+
+// Mentions handles listing the tweets that mention a user
+func Mentions(tweetService domain.TweetService) http.HandlerFunc {
+	return tweetList("mentions", tweetService.GetMentions)
+}
+
+// tweetList handles listing a page of tweets related to the user in the path
+func tweetList(name string, list func(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
+		userID := r.PathValue("id")
+
+		if userID == "" {
+			writeError(w, r, badRequest("userID is required"), "")
+			return
+		}
+
+		page, err := parsePageRequest(r)
+		if err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+
+		tweets, err := list(r.Context(), userID, page)
+		if err != nil {
+			writeError(w, r, err, "Failed to fetch "+name)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tweets)
+		log.Printf("Fetched %s for user %s successfully", name, userID)
+	}
+}
+
+// Hashtag handles listing the most recent tweets with a hashtag
+func Hashtag(tweetService domain.TweetService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
+		tag := r.PathValue("tag")
+
+		page, err := parsePageRequest(r)
+		if err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+
+		tweets, err := tweetService.GetHashtagTimeline(r.Context(), tag, page)
+		if err != nil {
+			writeError(w, r, err, "Failed to fetch hashtag")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tweets)
+		log.Printf("Fetched hashtag %s successfully", tag)
+	}
+}
+
+// Trends handles listing the trending hashtags
+func Trends(trendService domain.TrendService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
+
+		page, err := parsePageRequest(r)
+		if err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+
+		trends, err := trendService.GetTrends(r.Context(), page.Limit)
+		if err != nil {
+			writeError(w, r, err, "Failed to fetch trends")
+			return
+		}
+
+		response := map[string][]domain.Trend{"trends": trends}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		log.Printf("Fetched trends successfully")
+	}
+}
+
 // Timeline handles viewing a user's timeline
 func Timeline(tweetService domain.TweetService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Received %s request for %s", r.Method, r.URL.Path)
-		userID := r.URL.Path[len("/timeline/"):]
+		userID := r.PathValue("id")
 
 		if userID == "" {
-			http.Error(w, "userID is required", http.StatusBadRequest)
-			log.Printf("Failed to fetch timeline: userID is required")
+			writeError(w, r, badRequest("userID is required"), "")
 			return
 		}
 
-		tweets, err := tweetService.GetTimeline(userID)
+		page, err := parsePageRequest(r)
 		if err != nil {
-			http.Error(w, "Failed to fetch timeline", http.StatusInternalServerError)
-			log.Printf("Failed to fetch timeline: %v", err)
+			writeError(w, r, err, "")
+			return
+		}
+
+		timeline, err := tweetService.GetTimeline(r.Context(), userID, page)
+		if err != nil {
+			writeError(w, r, err, "Failed to fetch timeline")
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(tweets)
+		json.NewEncoder(w).Encode(timeline)
 		log.Printf("Fetched timeline for user %s successfully", userID)
 	}
 }
+
+// parsePageRequest reads the pagination parameters of a request
+func parsePageRequest(r *http.Request) (domain.PageRequest, error) {
+	query := r.URL.Query()
+	page := domain.PageRequest{
+		Cursor:  query.Get("cursor"),
+		SinceID: query.Get("since_id"),
+		MaxID:   query.Get("max_id"),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return domain.PageRequest{}, badRequest("limit must be a positive integer")
+		}
+		page.Limit = n
+	}
+
+	return page, nil
+}
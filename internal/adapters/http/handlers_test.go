@@ -2,6 +2,7 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -9,37 +10,125 @@ import (
 	"time"
 
 	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/freischarler/desafio-twitter/internal/middleware"
 	"github.com/stretchr/testify/assert"
 )
 
+// withPrincipal returns req as authenticated by userID
+func withPrincipal(req *http.Request, userID string) *http.Request {
+	return req.WithContext(middleware.ContextWithPrincipal(req.Context(), middleware.Principal{UserID: userID}))
+}
+
 type MockTweetService struct {
-	PostTweetFunc   func(userID, tweet string) (string, error)
-	GetTimelineFunc func(userID string) ([]domain.Tweet, error)
-	GetTweetFunc    func(tweetID string) (domain.Tweet, error)
+	PostTweetFunc       func(ctx context.Context, userID, tweet string, opts ...domain.PostOption) (string, error)
+	GetTimelineFunc     func(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error)
+	GetTweetFunc        func(ctx context.Context, tweetID string) (domain.Tweet, error)
+	DeleteTweetFunc     func(ctx context.Context, userID, tweetID string) error
+	GetConversationFunc func(ctx context.Context, tweetID string) (domain.ConversationNode, error)
+	RetweetFunc         func(ctx context.Context, userID, tweetID string) (string, error)
+	LikeTweetFunc       func(ctx context.Context, userID, tweetID string) error
+	UnlikeTweetFunc     func(ctx context.Context, userID, tweetID string) error
+	GetLikedTweetsFunc  func(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error)
+	GetMentionsFunc     func(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error)
+	GetHashtagFunc      func(ctx context.Context, tag string, page domain.PageRequest) (domain.TimelinePage, error)
+}
+
+func (m *MockTweetService) PostTweet(ctx context.Context, userID, tweet string, opts ...domain.PostOption) (string, error) {
+	return m.PostTweetFunc(ctx, userID, tweet, opts...)
+}
+func (m *MockTweetService) GetTimeline(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error) {
+	return m.GetTimelineFunc(ctx, userID, page)
+}
+
+func (m *MockTweetService) GetTweet(ctx context.Context, tweetID string) (domain.Tweet, error) {
+	return m.GetTweetFunc(ctx, tweetID)
+}
+
+func (m *MockTweetService) DeleteTweet(ctx context.Context, userID, tweetID string) error {
+	return m.DeleteTweetFunc(ctx, userID, tweetID)
+}
+
+func (m *MockTweetService) GetConversation(ctx context.Context, tweetID string) (domain.ConversationNode, error) {
+	return m.GetConversationFunc(ctx, tweetID)
+}
+
+func (m *MockTweetService) Retweet(ctx context.Context, userID, tweetID string) (string, error) {
+	return m.RetweetFunc(ctx, userID, tweetID)
+}
+
+func (m *MockTweetService) LikeTweet(ctx context.Context, userID, tweetID string) error {
+	return m.LikeTweetFunc(ctx, userID, tweetID)
 }
 
-func (m *MockTweetService) PostTweet(userID, tweet string) (string, error) {
-	return m.PostTweetFunc(userID, tweet)
+func (m *MockTweetService) UnlikeTweet(ctx context.Context, userID, tweetID string) error {
+	return m.UnlikeTweetFunc(ctx, userID, tweetID)
 }
-func (m *MockTweetService) GetTimeline(userID string) ([]domain.Tweet, error) {
-	return m.GetTimelineFunc(userID)
+
+func (m *MockTweetService) GetLikedTweets(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error) {
+	return m.GetLikedTweetsFunc(ctx, userID, page)
+}
+
+func (m *MockTweetService) GetMentions(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error) {
+	return m.GetMentionsFunc(ctx, userID, page)
 }
 
-func (m *MockTweetService) GetTweet(tweetID string) (domain.Tweet, error) {
-	return m.GetTweetFunc(tweetID)
+func (m *MockTweetService) GetHashtagTimeline(ctx context.Context, tag string, page domain.PageRequest) (domain.TimelinePage, error) {
+	return m.GetHashtagFunc(ctx, tag, page)
 }
 
 type MockUserService struct {
-	FollowUserFunc func(followerID, followeeID string) error
+	FollowUserFunc   func(ctx context.Context, followerID, followeeID string) error
+	UnfollowUserFunc func(ctx context.Context, followerID, followeeID string) error
+	GetFollowersFunc func(ctx context.Context, userID string, page domain.PageRequest) (domain.UserPage, error)
+	GetFollowingFunc func(ctx context.Context, userID string, page domain.PageRequest) (domain.UserPage, error)
+	RegisterFunc     func(ctx context.Context, registration domain.Registration) (domain.User, error)
+	LoginFunc        func(ctx context.Context, handle, password string) (domain.User, error)
+	GetProfileFunc   func(ctx context.Context, userID string) (domain.User, error)
+}
+
+func (m *MockUserService) FollowUser(ctx context.Context, followerID, followeeID string) error {
+	return m.FollowUserFunc(ctx, followerID, followeeID)
+}
+
+func (m *MockUserService) UnfollowUser(ctx context.Context, followerID, followeeID string) error {
+	return m.UnfollowUserFunc(ctx, followerID, followeeID)
+}
+
+func (m *MockUserService) GetFollowers(ctx context.Context, userID string, page domain.PageRequest) (domain.UserPage, error) {
+	return m.GetFollowersFunc(ctx, userID, page)
 }
 
-func (m *MockUserService) FollowUser(followerID, followeeID string) error {
-	return m.FollowUserFunc(followerID, followeeID)
+func (m *MockUserService) GetFollowing(ctx context.Context, userID string, page domain.PageRequest) (domain.UserPage, error) {
+	return m.GetFollowingFunc(ctx, userID, page)
+}
+
+func (m *MockUserService) Register(ctx context.Context, registration domain.Registration) (domain.User, error) {
+	return m.RegisterFunc(ctx, registration)
+}
+
+func (m *MockUserService) Login(ctx context.Context, handle, password string) (domain.User, error) {
+	return m.LoginFunc(ctx, handle, password)
+}
+
+func (m *MockUserService) GetProfile(ctx context.Context, userID string) (domain.User, error) {
+	return m.GetProfileFunc(ctx, userID)
 }
 
 func TestPostTweet(t *testing.T) {
+	var postedBy string
 	mockTweetService := &MockTweetService{
-		PostTweetFunc: func(userID, tweet string) (string, error) {
+		PostTweetFunc: func(ctx context.Context, userID, tweet string, opts ...domain.PostOption) (string, error) {
+			postedBy = userID
+			options := domain.NewPostOptions(opts...)
+			if options.InReplyToTweetID == "404" {
+				return "", domain.ErrReplyToNotFound
+			}
+			if options.QuotedTweetID == "404" {
+				return "", domain.ErrQuotedNotFound
+			}
+			if _, err := domain.ValidateTweet(tweet); err != nil {
+				return "", err
+			}
 			return "12345", nil
 		},
 	}
@@ -51,6 +140,7 @@ func TestPostTweet(t *testing.T) {
 		req, err := http.NewRequest("POST", "/tweet", reqBody)
 		assert.NoError(t, err)
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = withPrincipal(req, "1")
 
 		rr := httptest.NewRecorder()
 		handler.ServeHTTP(rr, req)
@@ -63,17 +153,115 @@ func TestPostTweet(t *testing.T) {
 		assert.Equal(t, "12345", response["tweetID"])
 	})
 
-	t.Run("should return error if userID is missing", func(t *testing.T) {
-		reqBody := bytes.NewBufferString(`tweet=Hello World`)
+	t.Run("should post tweet from a JSON body", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`{"userID": "1", "tweet": "Hello World"}`)
+		req, err := http.NewRequest("POST", "/v1/tweets", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req = withPrincipal(req, "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response map[string]string
+		err = json.NewDecoder(rr.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, "12345", response["tweetID"])
+	})
+
+	t.Run("should return unsupported media type for other bodies", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`<tweet>Hello World</tweet>`)
+		req, err := http.NewRequest("POST", "/v1/tweets", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/xml")
+		req = withPrincipal(req, "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+	})
+
+	t.Run("should return bad request for a blank tweet", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`userID=1&tweet=%20%20`)
 		req, err := http.NewRequest("POST", "/tweet", reqBody)
 		assert.NoError(t, err)
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = withPrincipal(req, "1")
 
 		rr := httptest.NewRecorder()
 		handler.ServeHTTP(rr, req)
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
-		assert.Contains(t, rr.Body.String(), "userID is required")
+		assert.Contains(t, rr.Body.String(), domain.ErrTweetEmpty.Error())
+	})
+
+	t.Run("should return not found when replying to a missing tweet", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`userID=1&tweet=Hello World&inReplyToTweetID=404`)
+		req, err := http.NewRequest("POST", "/tweet", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = withPrincipal(req, "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should return not found when quoting a missing tweet", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`userID=1&tweet=Hello World&quotedTweetID=404`)
+		req, err := http.NewRequest("POST", "/tweet", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = withPrincipal(req, "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should return unauthorized without a principal", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`tweet=Hello World`)
+		req, err := http.NewRequest("POST", "/tweet", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("should return forbidden when posting as another user", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`userID=2&tweet=Hello World`)
+		req, err := http.NewRequest("POST", "/tweet", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = withPrincipal(req, "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"code":"forbidden"`)
+	})
+
+	t.Run("should post as the principal without a userID", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`tweet=Hello World`)
+		req, err := http.NewRequest("POST", "/v1/tweets", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = withPrincipal(req, "7")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "7", postedBy)
 	})
 
 	t.Run("should return error if tweet is missing", func(t *testing.T) {
@@ -81,6 +269,7 @@ func TestPostTweet(t *testing.T) {
 		req, err := http.NewRequest("POST", "/tweet", reqBody)
 		assert.NoError(t, err)
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = withPrincipal(req, "1")
 
 		rr := httptest.NewRecorder()
 		handler.ServeHTTP(rr, req)
@@ -90,9 +279,370 @@ func TestPostTweet(t *testing.T) {
 	})
 }
 
+func TestDeleteTweet(t *testing.T) {
+	mockTweetService := &MockTweetService{
+		DeleteTweetFunc: func(ctx context.Context, userID, tweetID string) error {
+			switch {
+			case tweetID == "404":
+				return domain.ErrTweetNotFound
+			case userID != "1":
+				return domain.ErrNotTweetOwner
+			}
+			return nil
+		},
+	}
+
+	handler := DeleteTweet(mockTweetService)
+
+	tests := []struct {
+		name      string
+		principal string
+		tweetID   string
+		query     string
+		expected  int
+	}{
+		{"should delete tweet successfully", "1", "10", "", http.StatusOK},
+		{"should accept the userID of the principal", "1", "10", "userID=1", http.StatusOK},
+		{"should return unauthorized without a principal", "", "10", "userID=1", http.StatusUnauthorized},
+		{"should return forbidden when acting as another user", "1", "10", "userID=2", http.StatusForbidden},
+		{"should return not found if tweet does not exist", "1", "404", "", http.StatusNotFound},
+		{"should return forbidden if user is not the author", "2", "10", "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("DELETE", "/tweets/"+tt.tweetID+"?"+tt.query, nil)
+			assert.NoError(t, err)
+			req.SetPathValue("id", tt.tweetID)
+			if tt.principal != "" {
+				req = withPrincipal(req, tt.principal)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expected, rr.Code)
+		})
+	}
+}
+
+func TestRetweet(t *testing.T) {
+	mockTweetService := &MockTweetService{
+		RetweetFunc: func(ctx context.Context, userID, tweetID string) (string, error) {
+			switch {
+			case tweetID == "404":
+				return "", domain.ErrTweetNotFound
+			case userID == "2":
+				return "", domain.ErrAlreadyRetweeted
+			}
+			return "20", nil
+		},
+	}
+
+	handler := Retweet(mockTweetService)
+
+	tests := []struct {
+		name      string
+		principal string
+		tweetID   string
+		body      string
+		expected  int
+	}{
+		{"should retweet successfully", "1", "10", "", http.StatusOK},
+		{"should return unauthorized without a principal", "", "10", "userID=1", http.StatusUnauthorized},
+		{"should return forbidden when acting as another user", "1", "10", "userID=2", http.StatusForbidden},
+		{"should return not found if tweet does not exist", "1", "404", "userID=1", http.StatusNotFound},
+		{"should return conflict if already retweeted", "2", "10", "", http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/tweets/"+tt.tweetID+"/retweet", bytes.NewBufferString(tt.body))
+			assert.NoError(t, err)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetPathValue("id", tt.tweetID)
+			if tt.principal != "" {
+				req = withPrincipal(req, tt.principal)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expected, rr.Code)
+		})
+	}
+}
+
+func TestLikeTweet(t *testing.T) {
+	var liked []string
+	mockTweetService := &MockTweetService{
+		LikeTweetFunc: func(ctx context.Context, userID, tweetID string) error {
+			if tweetID == "404" {
+				return domain.ErrTweetNotFound
+			}
+			liked = append(liked, tweetID)
+			return nil
+		},
+		UnlikeTweetFunc: func(ctx context.Context, userID, tweetID string) error {
+			liked = nil
+			return nil
+		},
+	}
+
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		method    string
+		principal string
+		tweetID   string
+		body      string
+		expected  int
+	}{
+		{"should like tweet successfully", LikeTweet(mockTweetService), "POST", "1", "10", "", http.StatusOK},
+		{"should return unauthorized without a principal", LikeTweet(mockTweetService), "POST", "", "10", "userID=1", http.StatusUnauthorized},
+		{"should return not found if tweet does not exist", LikeTweet(mockTweetService), "POST", "1", "404", "userID=1", http.StatusNotFound},
+		{"should unlike tweet successfully", UnlikeTweet(mockTweetService), "DELETE", "1", "10", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "/tweets/"+tt.tweetID+"/like?"+tt.body, nil)
+			assert.NoError(t, err)
+			req.SetPathValue("id", tt.tweetID)
+			if tt.principal != "" {
+				req = withPrincipal(req, tt.principal)
+			}
+
+			rr := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expected, rr.Code)
+		})
+	}
+
+	assert.Empty(t, liked)
+}
+
+func TestLikes(t *testing.T) {
+	mockTweetService := &MockTweetService{
+		GetLikedTweetsFunc: func(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error) {
+			if page.Cursor == "bad" {
+				return domain.TimelinePage{}, domain.ErrInvalidCursor
+			}
+			return domain.TimelinePage{
+				Tweets:     []domain.Tweet{{TweetID: "10", UserID: "2", Liked: true, LikeCount: 3}},
+				NextCursor: "MTA",
+			}, nil
+		},
+	}
+
+	handler := Likes(mockTweetService)
+
+	t.Run("should list liked tweets", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/users/1/likes?limit=1", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("id", "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var page domain.TimelinePage
+		err = json.NewDecoder(rr.Body).Decode(&page)
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 1)
+		assert.True(t, page.Tweets[0].Liked)
+		assert.Equal(t, int64(3), page.Tweets[0].LikeCount)
+		assert.Equal(t, "MTA", page.NextCursor)
+	})
+
+	t.Run("should reject invalid cursors", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/users/1/likes?cursor=bad", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("id", "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestMentions(t *testing.T) {
+	var requested domain.PageRequest
+	mockTweetService := &MockTweetService{
+		GetMentionsFunc: func(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error) {
+			requested = page
+			return domain.TimelinePage{
+				Tweets: []domain.Tweet{{TweetID: "10", UserID: "2", Content: "Hi @" + userID, Mentions: []string{userID}}},
+			}, nil
+		},
+	}
+
+	handler := Mentions(mockTweetService)
+
+	req, err := http.NewRequest("GET", "/users/1/mentions?limit=5&since_id=3", nil)
+	assert.NoError(t, err)
+	req.SetPathValue("id", "1")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, domain.PageRequest{Limit: 5, SinceID: "3"}, requested)
+	var page domain.TimelinePage
+	err = json.NewDecoder(rr.Body).Decode(&page)
+	assert.NoError(t, err)
+	assert.Len(t, page.Tweets, 1)
+	assert.Equal(t, []string{"1"}, page.Tweets[0].Mentions)
+}
+
+func TestHashtag(t *testing.T) {
+	mockTweetService := &MockTweetService{
+		GetHashtagFunc: func(ctx context.Context, tag string, page domain.PageRequest) (domain.TimelinePage, error) {
+			if tag == "no spaces" {
+				return domain.TimelinePage{}, domain.ErrInvalidHashtag
+			}
+			return domain.TimelinePage{
+				Tweets: []domain.Tweet{{TweetID: "10", UserID: "2", Content: "Hi #" + tag, Hashtags: []string{"golang"}}},
+			}, nil
+		},
+	}
+
+	handler := Hashtag(mockTweetService)
+
+	t.Run("should list the tweets of a hashtag", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/hashtags/GoLang", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("tag", "GoLang")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var page domain.TimelinePage
+		err = json.NewDecoder(rr.Body).Decode(&page)
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 1)
+		assert.Equal(t, []string{"golang"}, page.Tweets[0].Hashtags)
+	})
+
+	t.Run("should reject an invalid hashtag", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/hashtags/no%20spaces", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("tag", "no spaces")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+type MockTrendService struct {
+	RecordHashtagsFunc func(ctx context.Context, hashtags []string) error
+	GetTrendsFunc      func(ctx context.Context, limit int) ([]domain.Trend, error)
+}
+
+func (m *MockTrendService) RecordHashtags(ctx context.Context, hashtags []string) error {
+	return m.RecordHashtagsFunc(ctx, hashtags)
+}
+
+func (m *MockTrendService) GetTrends(ctx context.Context, limit int) ([]domain.Trend, error) {
+	return m.GetTrendsFunc(ctx, limit)
+}
+
+func TestTrends(t *testing.T) {
+	var requested int
+	mockTrendService := &MockTrendService{
+		GetTrendsFunc: func(ctx context.Context, limit int) ([]domain.Trend, error) {
+			requested = limit
+			return []domain.Trend{{Hashtag: "golang", Count: 10, Baseline: 20, Velocity: 6.5}}, nil
+		},
+	}
+
+	handler := Trends(mockTrendService)
+
+	t.Run("should list the trending hashtags", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/trends?limit=5", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, 5, requested)
+		var response map[string][]domain.Trend
+		err = json.NewDecoder(rr.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.Trend{{Hashtag: "golang", Count: 10, Baseline: 20, Velocity: 6.5}}, response["trends"])
+	})
+
+	t.Run("should reject an invalid limit", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/trends?limit=abc", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestConversation(t *testing.T) {
+	mockTweetService := &MockTweetService{
+		GetConversationFunc: func(ctx context.Context, tweetID string) (domain.ConversationNode, error) {
+			if tweetID == "404" {
+				return domain.ConversationNode{}, domain.ErrTweetNotFound
+			}
+			return domain.ConversationNode{
+				Tweet: domain.Tweet{TweetID: "1", ConversationID: "1"},
+				Replies: []domain.ConversationNode{
+					{Tweet: domain.Tweet{TweetID: tweetID, InReplyToTweetID: "1", ConversationID: "1"}, Replies: []domain.ConversationNode{}},
+				},
+			}, nil
+		},
+	}
+
+	handler := Conversation(mockTweetService)
+
+	t.Run("should return the conversation tree", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/tweets/2/conversation", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("id", "2")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var conversation domain.ConversationNode
+		err = json.NewDecoder(rr.Body).Decode(&conversation)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", conversation.Tweet.TweetID)
+		assert.Len(t, conversation.Replies, 1)
+		assert.Equal(t, "2", conversation.Replies[0].Tweet.TweetID)
+	})
+
+	t.Run("should return not found if tweet does not exist", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/tweets/404/conversation", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("id", "404")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
 func TestFollowUser(t *testing.T) {
+	var follower string
 	mockUserService := &MockUserService{
-		FollowUserFunc: func(followerID, followeeID string) error {
+		FollowUserFunc: func(ctx context.Context, followerID, followeeID string) error {
+			follower = followerID
+			if followerID == followeeID {
+				return domain.ErrCannotFollowSelf
+			}
 			return nil
 		},
 	}
@@ -104,6 +654,7 @@ func TestFollowUser(t *testing.T) {
 		req, err := http.NewRequest("POST", "/follow", reqBody)
 		assert.NoError(t, err)
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = withPrincipal(req, "1")
 
 		rr := httptest.NewRecorder()
 		handler.ServeHTTP(rr, req)
@@ -115,26 +666,196 @@ func TestFollowUser(t *testing.T) {
 		assert.Equal(t, "Followed successfully", response["message"])
 	})
 
-	t.Run("should return error if followerID or followeeID is missing", func(t *testing.T) {
+	t.Run("should return error if followeeID is missing", func(t *testing.T) {
 		reqBody := bytes.NewBufferString(`followerID=1`)
 		req, err := http.NewRequest("POST", "/follow", reqBody)
 		assert.NoError(t, err)
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = withPrincipal(req, "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "followeeID is required")
+	})
+
+	t.Run("should return bad request when following yourself", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`followerID=1&followeeID=1`)
+		req, err := http.NewRequest("POST", "/follow", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = withPrincipal(req, "1")
 
 		rr := httptest.NewRecorder()
 		handler.ServeHTTP(rr, req)
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
-		assert.Contains(t, rr.Body.String(), "Both followerID and followeeID are required")
+		var response ErrorResponse
+		err = json.NewDecoder(rr.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, "cannot_follow_self", response.Code)
+	})
+
+	t.Run("should follow as the principal without a followerID", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`followeeID=2`)
+		req, err := http.NewRequest("POST", "/v1/follows", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = withPrincipal(req, "3")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "3", follower)
+	})
+
+	t.Run("should return unauthorized without a principal", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`followerID=1&followeeID=2`)
+		req, err := http.NewRequest("POST", "/follow", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should return forbidden when following on behalf of another user", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`followerID=4&followeeID=2`)
+		req, err := http.NewRequest("POST", "/follow", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = withPrincipal(req, "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestUnfollowUser(t *testing.T) {
+	mockUserService := &MockUserService{
+		UnfollowUserFunc: func(ctx context.Context, followerID, followeeID string) error {
+			return nil
+		},
+	}
+
+	handler := UnfollowUser(mockUserService)
+
+	t.Run("should unfollow user successfully", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`followerID=1&followeeID=2`)
+		req, err := http.NewRequest("POST", "/unfollow", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = withPrincipal(req, "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response map[string]string
+		err = json.NewDecoder(rr.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, "Unfollowed successfully", response["message"])
+	})
+
+	t.Run("should return error if followeeID is missing", func(t *testing.T) {
+		reqBody := bytes.NewBufferString(`followerID=1`)
+		req, err := http.NewRequest("POST", "/unfollow", reqBody)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = withPrincipal(req, "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "followeeID is required")
+	})
+}
+
+func TestFollowers(t *testing.T) {
+	var requestedUserID string
+	var requestedPage domain.PageRequest
+	mockUserService := &MockUserService{
+		GetFollowersFunc: func(ctx context.Context, userID string, page domain.PageRequest) (domain.UserPage, error) {
+			requestedUserID = userID
+			requestedPage = page
+			if page.Cursor == "bad" {
+				return domain.UserPage{}, domain.ErrInvalidCursor
+			}
+			return domain.UserPage{UserIDs: []string{"2", "3"}, Count: 5, NextCursor: domain.EncodeCursor("3")}, nil
+		},
+		GetFollowingFunc: func(ctx context.Context, userID string, page domain.PageRequest) (domain.UserPage, error) {
+			return domain.UserPage{UserIDs: []string{"4"}, Count: 1}, nil
+		},
+	}
+
+	t.Run("should list followers successfully", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/users/1/followers?limit=2", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("id", "1")
+
+		rr := httptest.NewRecorder()
+		Followers(mockUserService).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var page domain.UserPage
+		err = json.NewDecoder(rr.Body).Decode(&page)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"2", "3"}, page.UserIDs)
+		assert.Equal(t, int64(5), page.Count)
+		assert.Equal(t, domain.EncodeCursor("3"), page.NextCursor)
+		assert.Equal(t, "1", requestedUserID)
+		assert.Equal(t, 2, requestedPage.Limit)
+	})
+
+	t.Run("should list following successfully", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/users/1/following", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("id", "1")
+
+		rr := httptest.NewRecorder()
+		Following(mockUserService).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var page domain.UserPage
+		err = json.NewDecoder(rr.Body).Decode(&page)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"4"}, page.UserIDs)
+		assert.Empty(t, page.NextCursor)
+	})
+
+	t.Run("should return error if cursor is invalid", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/users/1/followers?cursor=bad", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("id", "1")
+
+		rr := httptest.NewRecorder()
+		Followers(mockUserService).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 }
 
 func TestTimeline(t *testing.T) {
+	var requestedPage domain.PageRequest
 	mockTweetService := &MockTweetService{
-		GetTimelineFunc: func(userID string) ([]domain.Tweet, error) {
-			return []domain.Tweet{
-				{TweetID: "1", UserID: "1", Content: "Hello World", Timestamp: time.Now().UnixNano()},
-				{TweetID: "2", UserID: "1", Content: "Hello Again", Timestamp: time.Now().UnixNano()},
+		GetTimelineFunc: func(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error) {
+			requestedPage = page
+			if page.Cursor == "bad" {
+				return domain.TimelinePage{}, domain.ErrInvalidCursor
+			}
+			return domain.TimelinePage{
+				Tweets: []domain.Tweet{
+					{TweetID: "1", UserID: "1", Content: "Hello World", Timestamp: time.Now().UnixNano()},
+					{TweetID: "2", UserID: "1", Content: "Hello Again", Timestamp: time.Now().UnixNano()},
+				},
+				NextCursor: domain.EncodeCursor("2"),
 			}, nil
 		},
 	}
@@ -142,23 +863,59 @@ func TestTimeline(t *testing.T) {
 	handler := Timeline(mockTweetService)
 
 	t.Run("should get timeline successfully", func(t *testing.T) {
-		req, err := http.NewRequest("GET", "/timeline/1", nil)
+		req, err := http.NewRequest("GET", "/v1/users/1/timeline", nil)
 		assert.NoError(t, err)
+		req.SetPathValue("id", "1")
 
 		rr := httptest.NewRecorder()
 		handler.ServeHTTP(rr, req)
 
 		assert.Equal(t, http.StatusOK, rr.Code)
-		var tweets []domain.Tweet
-		err = json.NewDecoder(rr.Body).Decode(&tweets)
+		var page domain.TimelinePage
+		err = json.NewDecoder(rr.Body).Decode(&page)
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 2)
+		assert.Equal(t, "1", page.Tweets[0].TweetID)
+		assert.Equal(t, "2", page.Tweets[1].TweetID)
+		assert.Equal(t, domain.EncodeCursor("2"), page.NextCursor)
+	})
+
+	t.Run("should pass pagination parameters to the service", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/1/timeline?limit=5&cursor=abc&since_id=10&max_id=20", nil)
 		assert.NoError(t, err)
-		assert.Len(t, tweets, 2)
-		assert.Equal(t, "1", tweets[0].TweetID)
-		assert.Equal(t, "2", tweets[1].TweetID)
+		req.SetPathValue("id", "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, domain.PageRequest{Limit: 5, Cursor: "abc", SinceID: "10", MaxID: "20"}, requestedPage)
+	})
+
+	t.Run("should return error if limit is invalid", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/1/timeline?limit=zero", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("id", "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should return error if cursor is invalid", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/1/timeline?cursor=bad", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("id", "1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 
 	t.Run("should return error if userID is missing", func(t *testing.T) {
-		req, err := http.NewRequest("GET", "/timeline/", nil)
+		req, err := http.NewRequest("GET", "/v1/users//timeline", nil)
 		assert.NoError(t, err)
 
 		rr := httptest.NewRecorder()
@@ -168,3 +925,49 @@ func TestTimeline(t *testing.T) {
 		assert.Contains(t, rr.Body.String(), "userID is required")
 	})
 }
+
+func TestRequestContext(t *testing.T) {
+	t.Run("should pass the context of the request to the service", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		var serviceErr error
+		mockTweetService := &MockTweetService{
+			GetTimelineFunc: func(serviceCtx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error) {
+				// The client goes away while the timeline is read
+				cancel()
+				select {
+				case <-serviceCtx.Done():
+					serviceErr = serviceCtx.Err()
+				case <-time.After(time.Second):
+				}
+				return domain.TimelinePage{}, serviceErr
+			},
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", "/v1/users/1/timeline", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("id", "1")
+
+		rr := httptest.NewRecorder()
+		Timeline(mockTweetService).ServeHTTP(rr, req)
+
+		assert.ErrorIs(t, serviceErr, context.Canceled)
+	})
+
+	t.Run("should answer 504 when the service times out", func(t *testing.T) {
+		mockTweetService := &MockTweetService{
+			GetTweetFunc: func(ctx context.Context, tweetID string) (domain.Tweet, error) {
+				return domain.Tweet{}, context.DeadlineExceeded
+			},
+		}
+
+		req, err := http.NewRequest("GET", "/v1/tweets/1", nil)
+		assert.NoError(t, err)
+		req.SetPathValue("id", "1")
+
+		rr := httptest.NewRecorder()
+		GetTweet(mockTweetService).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusGatewayTimeout, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"code":"timeout"`)
+	})
+}
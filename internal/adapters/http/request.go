@@ -0,0 +1,145 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/freischarler/desafio-twitter/internal/middleware"
+)
+
+// MaxBodyBytes is the largest request body the API reads
+const MaxBodyBytes = 64 << 10
+
+// postTweetRequest is the body of a request to post a tweet
+type postTweetRequest struct {
+	UserID           string `json:"userID"`
+	Tweet            string `json:"tweet"`
+	InReplyToTweetID string `json:"inReplyToTweetID"`
+	QuotedTweetID    string `json:"quotedTweetID"`
+}
+
+// followRequest is the body of a request to follow or unfollow a user
+type followRequest struct {
+	FollowerID string `json:"followerID"`
+	FolloweeID string `json:"followeeID"`
+}
+
+// userRequest is the body of a request acting on a tweet as a user
+type userRequest struct {
+	UserID string `json:"userID"`
+}
+
+// registerRequest is the body of a request to sign up
+type registerRequest struct {
+	Handle      string `json:"handle"`
+	DisplayName string `json:"displayName"`
+	Password    string `json:"password"`
+}
+
+// loginRequest is the body of a request to log in
+type loginRequest struct {
+	Handle   string `json:"handle"`
+	Password string `json:"password"`
+}
+
+// actingUser returns the ID of the authenticated user a request acts as.
+// Clients may still send the user ID in the request, but it must be the one
+// of the authenticated user.
+func actingUser(r *http.Request, requested string) (string, error) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		return "", domain.ErrUnauthenticated
+	}
+	if requested != "" && requested != principal.UserID {
+		return "", domain.ErrNotPrincipal
+	}
+	return principal.UserID, nil
+}
+
+// decodeRequest reads the parameters of a request into dst, a pointer to a
+// struct of string fields. JSON bodies are decoded strictly: unknown fields
+// and trailing data are rejected. Form bodies, and requests without a body,
+// are read from the form values named like the JSON fields. Any other
+// content type is unsupported.
+func decodeRequest(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		if r.ContentLength > 0 {
+			return unsupportedMediaType(contentType)
+		}
+		return decodeForm(r, dst)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return unsupportedMediaType(contentType)
+	}
+
+	switch mediaType {
+	case "application/json":
+		return decodeJSON(r, dst)
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		return decodeForm(r, dst)
+	default:
+		return unsupportedMediaType(mediaType)
+	}
+}
+
+// decodeJSON strictly decodes a JSON body into dst
+func decodeJSON(r *http.Request, dst any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		return bodyError(err)
+	}
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return bodyError(errors.New("body must contain a single JSON object"))
+	}
+	return nil
+}
+
+// decodeForm fills the string fields of dst with the form values named like
+// their JSON fields
+func decodeForm(r *http.Request, dst any) error {
+	if err := r.ParseForm(); err != nil {
+		return bodyError(err)
+	}
+	if err := r.ParseMultipartForm(MaxBodyBytes); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return bodyError(err)
+	}
+
+	v := reflect.ValueOf(dst).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if name := v.Type().Field(i).Tag.Get("json"); name != "" {
+			v.Field(i).SetString(r.FormValue(name))
+		}
+	}
+	return nil
+}
+
+// bodyError returns the error for a body that cannot be read
+func bodyError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return &requestError{status: http.StatusRequestEntityTooLarge, code: "body_too_large", message: "request body is too large"}
+	}
+	return badRequest("invalid request body: " + err.Error())
+}
+
+// unsupportedMediaType returns the error for a body of an unsupported type
+func unsupportedMediaType(mediaType string) error {
+	return &requestError{
+		status:  http.StatusUnsupportedMediaType,
+		code:    "unsupported_media_type",
+		message: "unsupported content type " + strconv.Quote(mediaType) + ", use application/json or application/x-www-form-urlencoded",
+	}
+}
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeRequest(t *testing.T) {
+	decode := func(contentType, body string) (followRequest, int, string) {
+		req := httptest.NewRequest("POST", "/v1/follows", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		var dst followRequest
+		err := decodeRequest(httptest.NewRecorder(), req, &dst)
+		if err == nil {
+			return dst, http.StatusOK, ""
+		}
+		status, response := translateError(err, "")
+		return dst, status, response.Code
+	}
+
+	t.Run("should decode a JSON body", func(t *testing.T) {
+		dst, status, _ := decode("application/json; charset=utf-8", `{"followerID": "1", "followeeID": "2"}`)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, followRequest{FollowerID: "1", FolloweeID: "2"}, dst)
+	})
+
+	t.Run("should decode a form body", func(t *testing.T) {
+		dst, status, _ := decode("application/x-www-form-urlencoded", `followerID=1&followeeID=2`)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, followRequest{FollowerID: "1", FolloweeID: "2"}, dst)
+	})
+
+	t.Run("should read the query of a request without a body", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "/v1/follows?followerID=1&followeeID=2", nil)
+		var dst followRequest
+		err := decodeRequest(httptest.NewRecorder(), req, &dst)
+		assert.NoError(t, err)
+		assert.Equal(t, followRequest{FollowerID: "1", FolloweeID: "2"}, dst)
+	})
+
+	t.Run("should reject unknown JSON fields", func(t *testing.T) {
+		_, status, code := decode("application/json", `{"followerID": "1", "followee": "2"}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "invalid_request", code)
+	})
+
+	t.Run("should reject malformed JSON", func(t *testing.T) {
+		_, status, _ := decode("application/json", `{"followerID": 1}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		_, status, _ = decode("application/json", `{"followerID": "1"} {}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("should reject bodies over the maximum size", func(t *testing.T) {
+		body := `{"followerID": "` + strings.Repeat("1", MaxBodyBytes) + `"}`
+		_, status, code := decode("application/json", body)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+		assert.Equal(t, "body_too_large", code)
+
+		_, status, _ = decode("application/x-www-form-urlencoded", "followerID="+strings.Repeat("1", MaxBodyBytes))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	})
+
+	t.Run("should reject unsupported content types", func(t *testing.T) {
+		_, status, code := decode("text/plain", `followerID=1`)
+		assert.Equal(t, http.StatusUnsupportedMediaType, status)
+		assert.Equal(t, "unsupported_media_type", code)
+
+		_, status, _ = decode("", `followerID=1`)
+		assert.Equal(t, http.StatusUnsupportedMediaType, status)
+	})
+}
@@ -0,0 +1,144 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/freischarler/desafio-twitter/internal/domain"
+)
+
+// APIVersion is the prefix of the current version of the API
+const APIVersion = "/v1"
+
+// Router routes requests by method and path to the handlers of the API
+type Router struct {
+	mux *http.ServeMux
+}
+
+// NewRouter creates the router of the API. Every route lives under
+// APIVersion; the routes from before versioning still work as deprecated
+// aliases of their /v1 successors. Tokens are issued to users when they sign
+// up or log in.
+func NewRouter(tweetService domain.TweetService, userService domain.UserService, trendService domain.TrendService, tokens TokenIssuer) *Router {
+	mux := http.NewServeMux()
+
+	routes := []struct {
+		method  string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"POST", "/tweets", PostTweet(tweetService)},
+		{"GET", "/tweets/{id}", GetTweet(tweetService)},
+		{"DELETE", "/tweets/{id}", DeleteTweet(tweetService)},
+		{"POST", "/tweets/{id}/retweet", Retweet(tweetService)},
+		{"POST", "/tweets/{id}/like", LikeTweet(tweetService)},
+		{"DELETE", "/tweets/{id}/like", UnlikeTweet(tweetService)},
+		{"GET", "/tweets/{id}/conversation", Conversation(tweetService)},
+		{"POST", "/follows", FollowUser(userService)},
+		{"DELETE", "/follows", UnfollowUser(userService)},
+		{"POST", "/users", Register(userService, tokens)},
+		{"POST", "/login", Login(userService, tokens)},
+		{"GET", "/users/{id}", GetProfile(userService)},
+		{"GET", "/users/{id}/timeline", Timeline(tweetService)},
+		{"GET", "/users/{id}/followers", Followers(userService)},
+		{"GET", "/users/{id}/following", Following(userService)},
+		{"GET", "/users/{id}/likes", Likes(tweetService)},
+		{"GET", "/users/{id}/mentions", Mentions(tweetService)},
+		{"GET", "/hashtags/{tag}", Hashtag(tweetService)},
+		{"GET", "/trends", Trends(trendService)},
+	}
+	for _, route := range routes {
+		mux.HandleFunc(route.method+" "+APIVersion+route.path, route.handler)
+	}
+
+	legacyRoutes := []struct {
+		pattern   string
+		successor string
+		handler   http.HandlerFunc
+	}{
+		{"POST /tweet", "/tweets", PostTweet(tweetService)},
+		{"POST /follow", "/follows", FollowUser(userService)},
+		{"POST /unfollow", "/follows", UnfollowUser(userService)},
+		{"GET /timeline/{id...}", "/users/{id}/timeline", Timeline(tweetService)},
+		{"DELETE /tweets/{id}", "/tweets/{id}", DeleteTweet(tweetService)},
+		{"POST /tweets/{id}/retweet", "/tweets/{id}/retweet", Retweet(tweetService)},
+		{"POST /tweets/{id}/like", "/tweets/{id}/like", LikeTweet(tweetService)},
+		{"DELETE /tweets/{id}/like", "/tweets/{id}/like", UnlikeTweet(tweetService)},
+		{"GET /tweets/{id}/conversation", "/tweets/{id}/conversation", Conversation(tweetService)},
+		{"GET /users/{id}/followers", "/users/{id}/followers", Followers(userService)},
+		{"GET /users/{id}/following", "/users/{id}/following", Following(userService)},
+		{"GET /users/{id}/likes", "/users/{id}/likes", Likes(tweetService)},
+		{"GET /users/{id}/mentions", "/users/{id}/mentions", Mentions(tweetService)},
+		{"GET /hashtags/{tag}", "/hashtags/{tag}", Hashtag(tweetService)},
+		{"GET /trends", "/trends", Trends(trendService)},
+	}
+	for _, route := range legacyRoutes {
+		mux.Handle(route.pattern, deprecated(APIVersion+route.successor, route.handler))
+	}
+
+	return &Router{mux: mux}
+}
+
+// ServeHTTP dispatches a request to the handler of its route. Requests
+// without a route, or with a method the route does not support, are
+// answered with the JSON error of the API.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, pattern := rt.mux.Handler(r); pattern != "" {
+		rt.mux.ServeHTTP(w, r)
+		return
+	}
+
+	// Let the mux decide between not found, method not allowed and a
+	// redirect, then answer errors in JSON
+	rec := &statusRecorder{header: make(http.Header)}
+	rt.mux.ServeHTTP(rec, r)
+	switch rec.status {
+	case http.StatusNotFound:
+		writeError(w, r, &requestError{status: http.StatusNotFound, code: "not_found", message: "no route for " + r.URL.Path}, "")
+	case http.StatusMethodNotAllowed:
+		w.Header().Set("Allow", rec.header.Get("Allow"))
+		writeError(w, r, &requestError{status: http.StatusMethodNotAllowed, code: "method_not_allowed", message: r.Method + " is not allowed for " + r.URL.Path}, "")
+	default:
+		for key, values := range rec.header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(rec.status)
+		w.Write(rec.body)
+	}
+}
+
+// deprecated marks the responses of a legacy route as deprecated and points
+// clients to the route that replaces it. The wildcards of the successor are
+// filled in from the request.
+func deprecated(successor string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		link := strings.NewReplacer("{id}", r.PathValue("id"), "{tag}", r.PathValue("tag")).Replace(successor)
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+link+`>; rel="successor-version"`)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder keeps the response the mux gives to a request without a
+// handler
+type statusRecorder struct {
+	header http.Header
+	status int
+	body   []byte
+}
+
+func (rec *statusRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body = append(rec.body, b...)
+	return len(b), nil
+}
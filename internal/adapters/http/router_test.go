@@ -0,0 +1,99 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/freischarler/desafio-twitter/internal/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter(t *testing.T) {
+	var timelineUserID string
+	mockTweetService := &MockTweetService{
+		GetTweetFunc: func(ctx context.Context, tweetID string) (domain.Tweet, error) {
+			if tweetID == "404" {
+				return domain.Tweet{}, domain.ErrTweetNotFound
+			}
+			return domain.Tweet{TweetID: tweetID, UserID: "1", Content: "Hello World"}, nil
+		},
+		GetTimelineFunc: func(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error) {
+			timelineUserID = userID
+			return domain.TimelinePage{}, nil
+		},
+	}
+	router := NewRouter(mockTweetService, &MockUserService{}, &MockTrendService{}, middleware.NewAuthenticator([]byte("secret")))
+
+	t.Run("should route versioned requests", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/tweets/10", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get("Deprecation"))
+		var tweet domain.Tweet
+		err := json.NewDecoder(rr.Body).Decode(&tweet)
+		assert.NoError(t, err)
+		assert.Equal(t, "10", tweet.TweetID)
+	})
+
+	t.Run("should return not found for a missing tweet", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/tweets/404", nil))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should read the user of the timeline from the path", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/users/7/timeline", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "7", timelineUserID)
+	})
+
+	t.Run("should keep legacy routes as deprecated aliases", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/timeline/8", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "8", timelineUserID)
+		assert.Equal(t, "true", rr.Header().Get("Deprecation"))
+		assert.Equal(t, `</v1/users/8/timeline>; rel="successor-version"`, rr.Header().Get("Link"))
+	})
+
+	t.Run("should reject a wrong method with the allowed ones", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("PUT", "/v1/tweets/10", nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+		assert.Contains(t, rr.Header().Get("Allow"), "GET")
+		assert.Contains(t, rr.Header().Get("Allow"), "DELETE")
+		var response ErrorResponse
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, "method_not_allowed", response.Code)
+	})
+
+	t.Run("should reject a wrong method on legacy routes", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/tweet", nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+		assert.Equal(t, "POST", rr.Header().Get("Allow"))
+	})
+
+	t.Run("should return not found for unknown routes", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/unknown", nil))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		var response ErrorResponse
+		err := json.NewDecoder(rr.Body).Decode(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, "not_found", response.Code)
+	})
+}
@@ -0,0 +1,151 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+)
+
+// Register creates a user. The handle is claimed first with a conditional
+// write on the Handles table, so two users can never hold the same handle,
+// regardless of case.
+func (s *DynamoDBUserService) Register(ctx context.Context, registration domain.Registration) (domain.User, error) {
+	ctx, cancel := s.Timeouts.write(ctx)
+	defer cancel()
+
+	registration, err := registration.Validate()
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	passwordHash, err := hashPassword(registration.Password)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	id, err := s.IDs.Next()
+	if err != nil {
+		return domain.User{}, err
+	}
+	user := domain.User{
+		ID:          strconv.FormatInt(id, 10),
+		Handle:      registration.Handle,
+		DisplayName: registration.DisplayName,
+		CreatedAt:   time.Now().UnixNano(),
+	}
+
+	_, err = s.DynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("Handles"),
+		Item: map[string]types.AttributeValue{
+			"Handle": &types.AttributeValueMemberS{Value: domain.NormalizeHandle(user.Handle)},
+			"UserID": &types.AttributeValueMemberS{Value: user.ID},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(Handle)"),
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return domain.User{}, domain.ErrHandleTaken
+		}
+		return domain.User{}, err
+	}
+
+	item := userItem(user)
+	item["PasswordHash"] = &types.AttributeValueMemberS{Value: passwordHash}
+	_, err = s.DynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String("Users"),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(UserID)"),
+	})
+	if err != nil {
+		// Release the handle so it can be registered again
+		if releaseErr := s.releaseHandle(ctx, user); releaseErr != nil {
+			log.Printf("Failed to release handle %s: %v", user.Handle, releaseErr)
+		}
+		return domain.User{}, err
+	}
+
+	return user, nil
+}
+
+// Login returns the user with a handle if the password is theirs
+func (s *DynamoDBUserService) Login(ctx context.Context, handle, password string) (domain.User, error) {
+	ctx, cancel := s.Timeouts.read(ctx)
+	defer cancel()
+
+	result, err := s.DynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Handles"),
+		Key: map[string]types.AttributeValue{
+			"Handle": &types.AttributeValueMemberS{Value: domain.NormalizeHandle(handle)},
+		},
+	})
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	var item map[string]types.AttributeValue
+	if result.Item != nil {
+		item, err = s.getUserItem(ctx, stringAttr(result.Item, "UserID"))
+		if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+			return domain.User{}, err
+		}
+	}
+
+	// Unknown handles still check a password, so they cannot be told apart
+	// from wrong passwords by the time taken
+	if !checkPassword(stringAttr(item, "PasswordHash"), password) {
+		return domain.User{}, domain.ErrInvalidCredentials
+	}
+	return userFromItem(item), nil
+}
+
+// GetProfile retrieves a user
+func (s *DynamoDBUserService) GetProfile(ctx context.Context, userID string) (domain.User, error) {
+	ctx, cancel := s.Timeouts.read(ctx)
+	defer cancel()
+
+	item, err := s.getUserItem(ctx, userID)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return userFromItem(item), nil
+}
+
+// getUserItem retrieves the Users item of a user
+func (s *DynamoDBUserService) getUserItem(ctx context.Context, userID string) (map[string]types.AttributeValue, error) {
+	result, err := s.DynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Users"),
+		Key: map[string]types.AttributeValue{
+			"UserID": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	return result.Item, nil
+}
+
+// releaseHandle deletes the claim of a user on their handle
+func (s *DynamoDBUserService) releaseHandle(ctx context.Context, user domain.User) error {
+	_, err := s.DynamoDBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("Handles"),
+		Key: map[string]types.AttributeValue{
+			"Handle": &types.AttributeValueMemberS{Value: domain.NormalizeHandle(user.Handle)},
+		},
+		ConditionExpression: aws.String("UserID = :userID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":userID": &types.AttributeValueMemberS{Value: user.ID},
+		},
+	})
+	return err
+}
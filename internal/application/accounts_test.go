@@ -0,0 +1,97 @@
+package application
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAccounts(t *testing.T) {
+	PasswordCost = bcrypt.MinCost
+	defer func() { PasswordCost = bcrypt.DefaultCost }()
+
+	// Items of the Handles and Users tables by key
+	tables := map[string]map[string]map[string]types.AttributeValue{
+		"Handles": {},
+		"Users":   {},
+	}
+	keyOf := map[string]string{"Handles": "Handle", "Users": "UserID"}
+	mockDynamoDBClient := &MockDynamoDBClient{
+		PutItemFunc: func(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			table := *input.TableName
+			key := input.Item[keyOf[table]].(*types.AttributeValueMemberS).Value
+			if _, exists := tables[table][key]; exists && aws.ToString(input.ConditionExpression) != "" {
+				return nil, &types.ConditionalCheckFailedException{}
+			}
+			tables[table][key] = input.Item
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			table := *input.TableName
+			key := input.Key[keyOf[table]].(*types.AttributeValueMemberS).Value
+			return &dynamodb.GetItemOutput{Item: tables[table][key]}, nil
+		},
+	}
+
+	service := NewDynamoDBUserService(mockDynamoDBClient, &MockRedisClient{})
+	service.IDs = fixedIDGenerator{id: 42}
+
+	var registered domain.User
+	t.Run("should register a user", func(t *testing.T) {
+		user, err := service.Register(context.Background(), domain.Registration{Handle: "@Ada", Password: "correct horse"})
+		assert.NoError(t, err)
+		assert.Equal(t, "42", user.ID)
+		assert.Equal(t, "Ada", user.Handle)
+		assert.Equal(t, "Ada", user.DisplayName)
+		assert.NotZero(t, user.CreatedAt)
+		registered = user
+
+		assert.Contains(t, tables["Handles"], "ada")
+		hash := tables["Users"][user.ID]["PasswordHash"].(*types.AttributeValueMemberS).Value
+		assert.NotContains(t, hash, "correct horse")
+	})
+
+	t.Run("should not register a taken handle regardless of case", func(t *testing.T) {
+		_, err := service.Register(context.Background(), domain.Registration{Handle: "ADA", Password: "another horse"})
+		assert.Equal(t, domain.ErrHandleTaken, err)
+		assert.Len(t, tables["Users"], 1)
+	})
+
+	t.Run("should not register an invalid handle", func(t *testing.T) {
+		_, err := service.Register(context.Background(), domain.Registration{Handle: "ada lovelace", Password: "correct horse"})
+		assert.Equal(t, domain.ErrInvalidHandle, err)
+	})
+
+	t.Run("should log in with the password of the user", func(t *testing.T) {
+		user, err := service.Login(context.Background(), "ada", "correct horse")
+		assert.NoError(t, err)
+		assert.Equal(t, registered, user)
+	})
+
+	t.Run("should not log in with a wrong password", func(t *testing.T) {
+		_, err := service.Login(context.Background(), "ada", "wrong horse")
+		assert.Equal(t, domain.ErrInvalidCredentials, err)
+	})
+
+	t.Run("should not log in with an unknown handle", func(t *testing.T) {
+		_, err := service.Login(context.Background(), "grace", "correct horse")
+		assert.Equal(t, domain.ErrInvalidCredentials, err)
+	})
+
+	t.Run("should get the profile of a user", func(t *testing.T) {
+		user, err := service.GetProfile(context.Background(), registered.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, registered, user)
+	})
+
+	t.Run("should return not found for an unknown user", func(t *testing.T) {
+		_, err := service.GetProfile(context.Background(), "404")
+		assert.Equal(t, domain.ErrUserNotFound, err)
+	})
+}
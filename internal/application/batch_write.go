@@ -0,0 +1,73 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	// batchWriteSize is the most items DynamoDB writes in a single
+	// BatchWriteItem
+	batchWriteSize = 25
+
+	// batchWriteAttempts is how many times a batch is written while DynamoDB
+	// keeps leaving items unprocessed
+	batchWriteAttempts = 5
+
+	// batchWriteBackoff is how long to wait before writing the unprocessed
+	// items of a batch again, doubled on every retry
+	batchWriteBackoff = 25 * time.Millisecond
+)
+
+// errUnprocessedItems is returned when DynamoDB still leaves items of a
+// batch unprocessed after the last attempt
+var errUnprocessedItems = errors.New("items left unprocessed by DynamoDB")
+
+// batchWrite puts or deletes many items of a table with BatchWriteItem, in
+// batches of batchWriteSize. Unlike a transaction, a batch is not atomic, so
+// the writes must be safe to repeat.
+func batchWrite(ctx context.Context, client DynamoDBClient, table string, requests []types.WriteRequest) error {
+	for start := 0; start < len(requests); start += batchWriteSize {
+		end := min(start+batchWriteSize, len(requests))
+		if err := batchWriteBatch(ctx, client, table, requests[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchWriteBatch writes up to batchWriteSize items of a table. The items
+// DynamoDB leaves unprocessed, when the table is throttled, are written
+// again with exponential backoff.
+func batchWriteBatch(ctx context.Context, client DynamoDBClient, table string, requests []types.WriteRequest) error {
+	backoff := batchWriteBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{
+				table: requests,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		requests = result.UnprocessedItems[table]
+		if len(requests) == 0 {
+			return nil
+		}
+		if attempt >= batchWriteAttempts {
+			return errUnprocessedItems
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
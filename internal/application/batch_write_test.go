@@ -0,0 +1,74 @@
+package application
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchWrite(t *testing.T) {
+	backoff := batchWriteBackoff
+	batchWriteBackoff = time.Millisecond
+	t.Cleanup(func() { batchWriteBackoff = backoff })
+
+	var batches []int
+	var unprocessed int
+	mockDynamoDBClient := &MockDynamoDBClient{
+		BatchWriteItemFunc: func(ctx context.Context, input *dynamodb.BatchWriteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+			requests := input.RequestItems["HomeTimelines"]
+			batches = append(batches, len(requests))
+
+			// DynamoDB leaves the last items unprocessed while throttled
+			output := &dynamodb.BatchWriteItemOutput{}
+			if left := min(unprocessed, len(requests)); left > 0 {
+				unprocessed -= left
+				output.UnprocessedItems = map[string][]types.WriteRequest{
+					"HomeTimelines": requests[len(requests)-left:],
+				}
+			}
+			return output, nil
+		},
+	}
+
+	requests := func(n int) []types.WriteRequest {
+		requests := make([]types.WriteRequest, n)
+		for i := range requests {
+			requests[i] = types.WriteRequest{PutRequest: &types.PutRequest{Item: map[string]types.AttributeValue{
+				"UserID":  &types.AttributeValueMemberS{Value: strconv.Itoa(i)},
+				"TweetID": &types.AttributeValueMemberN{Value: "1"},
+			}}}
+		}
+		return requests
+	}
+	reset := func() {
+		batches, unprocessed = nil, 0
+	}
+
+	t.Run("should write in batches of at most 25 items", func(t *testing.T) {
+		reset()
+		err := batchWrite(context.Background(), mockDynamoDBClient, "HomeTimelines", requests(60))
+		assert.NoError(t, err)
+		assert.Equal(t, []int{25, 25, 10}, batches)
+	})
+
+	t.Run("should write unprocessed items again", func(t *testing.T) {
+		reset()
+		unprocessed = 3
+		err := batchWrite(context.Background(), mockDynamoDBClient, "HomeTimelines", requests(10))
+		assert.NoError(t, err)
+		assert.Equal(t, []int{10, 3}, batches)
+	})
+
+	t.Run("should give up after the last attempt", func(t *testing.T) {
+		reset()
+		unprocessed = 1000
+		err := batchWrite(context.Background(), mockDynamoDBClient, "HomeTimelines", requests(10))
+		assert.ErrorIs(t, err, errUnprocessedItems)
+		assert.Len(t, batches, batchWriteAttempts)
+	})
+}
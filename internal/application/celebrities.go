@@ -0,0 +1,193 @@
+package application
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Tweets of celebrities are not fanned out; their followers merge them into
+// their timeline at read time. The UserTimelines item of every user lists
+// the celebrities they follow in FollowedCelebrities, so a timeline read
+// costs one item rather than one per followed user. A celebrity's own item
+// is flagged with Celebrity once they cross the threshold, along with the
+// CelebrityJob listing them for every follower in the background, and with
+// CelebrityListed once that job is done. The flags are never cleared: the
+// tweets posted while the author was a celebrity were never fanned out, so
+// they keep being merged if the author drops below the threshold.
+
+// markCelebrity flags a user as a celebrity and enqueues the job adding
+// them to the list of every follower, unless that was already done. The
+// user is flagged in the same transaction, so users following them from
+// then on add them to their own list.
+func (s *DynamoRedisTweetService) markCelebrity(ctx context.Context, userID string) error {
+	result, err := s.DynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("UserTimelines"),
+		Key: map[string]types.AttributeValue{
+			"UserID": &types.AttributeValueMemberS{Value: userID},
+		},
+		ProjectionExpression: aws.String("CelebrityListed, CelebrityJob"),
+	})
+	if err != nil {
+		return err
+	}
+	if listed, ok := result.Item["CelebrityListed"].(*types.AttributeValueMemberBOOL); ok && listed.Value {
+		return nil
+	}
+	if _, ok := result.Item["CelebrityJob"]; ok {
+		return nil
+	}
+
+	j, err := s.newJob(jobListCelebrity, map[string]types.AttributeValue{
+		"UserID": &types.AttributeValueMemberS{Value: userID},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = transactWrite(ctx, s.DynamoDBClient, []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName: aws.String("UserTimelines"),
+				Key: map[string]types.AttributeValue{
+					"UserID": &types.AttributeValueMemberS{Value: userID},
+				},
+				UpdateExpression:    aws.String("SET Celebrity = :true, CelebrityJob = :jobID"),
+				ConditionExpression: aws.String("attribute_not_exists(CelebrityListed) AND attribute_not_exists(CelebrityJob)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":true":  &types.AttributeValueMemberBOOL{Value: true},
+					":jobID": &types.AttributeValueMemberS{Value: j.ID},
+				},
+			},
+		},
+		j.item(),
+	})
+	// Another tweet of the user enqueued the job first
+	if cancellationReason(err, 0) == "ConditionalCheckFailed" {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	s.wakeJobs()
+	return nil
+}
+
+// listCelebrityStep adds a celebrity to the list of a page of their
+// followers, in a single transaction, and flags them with CelebrityListed
+// after the last page
+func (s *DynamoRedisTweetService) listCelebrityStep(ctx context.Context, j *job) (bool, error) {
+	celebrityID := stringAttr(j.Data, "UserID")
+
+	followers, lastKey, err := s.followerIDsPage(ctx, celebrityID, j.Cursor)
+	if err != nil {
+		return false, err
+	}
+
+	if len(followers) > 0 {
+		items := make([]types.TransactWriteItem, 0, len(followers))
+		for _, followerID := range followers {
+			items = append(items, types.TransactWriteItem{
+				Update: followedCelebritiesUpdate(followerID, celebrityID, "ADD"),
+			})
+		}
+		if err := transactWrite(ctx, s.DynamoDBClient, items); err != nil {
+			return false, err
+		}
+	}
+
+	if len(lastKey) > 0 {
+		j.Cursor = lastKey
+		return false, nil
+	}
+
+	_, err = s.DynamoDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("UserTimelines"),
+		Key: map[string]types.AttributeValue{
+			"UserID": &types.AttributeValueMemberS{Value: celebrityID},
+		},
+		UpdateExpression: aws.String("SET CelebrityListed = :true REMOVE CelebrityJob"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":true": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	})
+	return err == nil, err
+}
+
+// isCelebrityFlagged reports whether a user has ever been a celebrity
+func isCelebrityFlagged(ctx context.Context, client DynamoDBClient, userID string) (bool, error) {
+	result, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("UserTimelines"),
+		Key: map[string]types.AttributeValue{
+			"UserID": &types.AttributeValueMemberS{Value: userID},
+		},
+		ProjectionExpression: aws.String("Celebrity"),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	celebrity, ok := result.Item["Celebrity"].(*types.AttributeValueMemberBOOL)
+	return ok && celebrity.Value, nil
+}
+
+// addFollowedCelebrity adds a celebrity to the celebrities a user follows
+func addFollowedCelebrity(ctx context.Context, client DynamoDBClient, userID, celebrityID string) error {
+	return updateFollowedCelebrities(ctx, client, userID, celebrityID, "ADD")
+}
+
+// removeFollowedCelebrity removes a celebrity from the celebrities a user
+// follows, if they are there
+func removeFollowedCelebrity(ctx context.Context, client DynamoDBClient, userID, celebrityID string) error {
+	return updateFollowedCelebrities(ctx, client, userID, celebrityID, "DELETE")
+}
+
+// updateFollowedCelebrities adds or deletes a celebrity in the set of
+// celebrities a user follows
+func updateFollowedCelebrities(ctx context.Context, client DynamoDBClient, userID, celebrityID, action string) error {
+	update := followedCelebritiesUpdate(userID, celebrityID, action)
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 update.TableName,
+		Key:                       update.Key,
+		UpdateExpression:          update.UpdateExpression,
+		ExpressionAttributeValues: update.ExpressionAttributeValues,
+	})
+	return err
+}
+
+// followedCelebritiesUpdate returns the update adding or deleting a
+// celebrity in the set of celebrities a user follows
+func followedCelebritiesUpdate(userID, celebrityID, action string) *types.Update {
+	return &types.Update{
+		TableName: aws.String("UserTimelines"),
+		Key: map[string]types.AttributeValue{
+			"UserID": &types.AttributeValueMemberS{Value: userID},
+		},
+		UpdateExpression: aws.String(action + " FollowedCelebrities :celebrity"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":celebrity": &types.AttributeValueMemberSS{Value: []string{celebrityID}},
+		},
+	}
+}
+
+// getFollowedCelebrities retrieves the celebrities a user follows
+func getFollowedCelebrities(ctx context.Context, client DynamoDBClient, userID string) ([]string, error) {
+	result, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("UserTimelines"),
+		Key: map[string]types.AttributeValue{
+			"UserID": &types.AttributeValueMemberS{Value: userID},
+		},
+		ProjectionExpression: aws.String("FollowedCelebrities"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	celebrities, ok := result.Item["FollowedCelebrities"].(*types.AttributeValueMemberSS)
+	if !ok {
+		return nil, nil
+	}
+	return celebrities.Value, nil
+}
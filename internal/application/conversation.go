@@ -0,0 +1,83 @@
+package application
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+)
+
+// conversationsIndex is the Tweets index keyed by conversation root and
+// sorted by timestamp
+const conversationsIndex = "ConversationIDIndex"
+
+// GetConversation retrieves the whole conversation a tweet belongs to, as a
+// tree under the tweet that started it. It returns domain.ErrIndexNotReady
+// while the index of conversations is being built.
+func (s *DynamoRedisTweetService) GetConversation(ctx context.Context, tweetID string) (domain.ConversationNode, error) {
+	if !indexReady(s.ConversationsIndexReady) {
+		return domain.ConversationNode{}, domain.ErrIndexNotReady
+	}
+
+	ctx, cancel := s.Timeouts.read(ctx)
+	defer cancel()
+
+	tweet, err := s.GetTweet(ctx, tweetID)
+	if err != nil {
+		return domain.ConversationNode{}, err
+	}
+
+	root := tweet
+	if rootID := domain.ConversationRootID(tweet); rootID != tweet.TweetID {
+		root, err = s.GetTweet(ctx, rootID)
+		if errors.Is(err, domain.ErrTweetNotFound) {
+			// The conversation outlives a deleted root; show it from the
+			// requested tweet instead
+			root = tweet
+		} else if err != nil {
+			return domain.ConversationNode{}, err
+		}
+	}
+
+	tweets, err := s.queryConversation(ctx, domain.ConversationRootID(tweet))
+	if err != nil {
+		return domain.ConversationNode{}, err
+	}
+
+	return domain.BuildConversationTree(root, tweets), nil
+}
+
+// queryConversation retrieves every tweet of a conversation, oldest first
+func (s *DynamoRedisTweetService) queryConversation(ctx context.Context, conversationID string) ([]domain.Tweet, error) {
+	var tweets []domain.Tweet
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := s.DynamoDBClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String("Tweets"),
+			IndexName:              aws.String(conversationsIndex),
+			KeyConditionExpression: aws.String("ConversationID = :conversationID"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":conversationID": &types.AttributeValueMemberS{Value: conversationID},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Items {
+			if isDeletedItem(item) {
+				continue
+			}
+			tweets = append(tweets, tweetFromItem(item))
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return tweets, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
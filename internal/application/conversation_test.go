@@ -0,0 +1,102 @@
+package application
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConversations(t *testing.T) {
+	tweets := map[string]map[string]types.AttributeValue{}
+	mockDynamoDBClient := &MockDynamoDBClient{
+		PutItemFunc: func(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			if *input.TableName == "Tweets" {
+				tweets[input.Item["TweetID"].(*types.AttributeValueMemberS).Value] = input.Item
+			}
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			if *input.TableName == "UserTimelines" {
+				// Follower counts
+				return &dynamodb.GetItemOutput{}, nil
+			}
+			return &dynamodb.GetItemOutput{Item: tweets[input.Key["TweetID"].(*types.AttributeValueMemberS).Value]}, nil
+		},
+		UpdateItemFunc: func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			if input.IndexName == nil || *input.IndexName != conversationsIndex {
+				return &dynamodb.QueryOutput{}, nil
+			}
+			conversationID := input.ExpressionAttributeValues[":conversationID"].(*types.AttributeValueMemberS).Value
+			var items []map[string]types.AttributeValue
+			for _, item := range tweets {
+				if item["ConversationID"].(*types.AttributeValueMemberS).Value == conversationID {
+					items = append(items, item)
+				}
+			}
+			return &dynamodb.QueryOutput{Items: items}, nil
+		},
+	}
+	mockRedisClient := &MockRedisClient{
+		GetFunc: func(ctx context.Context, key string) *redis.StringCmd {
+			return redis.NewStringResult("", redis.Nil)
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, mockRedisClient)
+
+	rootID, err := service.PostTweet(context.Background(), "1", "Root")
+	assert.NoError(t, err)
+	replyID, err := service.PostTweet(context.Background(), "2", "Reply", domain.InReplyTo(rootID))
+	assert.NoError(t, err)
+	nestedID, err := service.PostTweet(context.Background(), "1", "Nested reply", domain.InReplyTo(replyID))
+	assert.NoError(t, err)
+
+	t.Run("should store the conversation root of replies", func(t *testing.T) {
+		reply, err := service.GetTweet(context.Background(), nestedID)
+		assert.NoError(t, err)
+		assert.Equal(t, replyID, reply.InReplyToTweetID)
+		assert.Equal(t, rootID, reply.ConversationID)
+
+		root, err := service.GetTweet(context.Background(), rootID)
+		assert.NoError(t, err)
+		assert.Empty(t, root.InReplyToTweetID)
+		assert.Equal(t, rootID, root.ConversationID)
+	})
+
+	t.Run("should not reply to a missing tweet", func(t *testing.T) {
+		_, err := service.PostTweet(context.Background(), "1", "Reply", domain.InReplyTo("404"))
+		assert.Equal(t, domain.ErrReplyToNotFound, err)
+	})
+
+	t.Run("should return the whole conversation from any of its tweets", func(t *testing.T) {
+		conversation, err := service.GetConversation(context.Background(), nestedID)
+		assert.NoError(t, err)
+		assert.Equal(t, rootID, conversation.Tweet.TweetID)
+		assert.Len(t, conversation.Replies, 1)
+		assert.Equal(t, replyID, conversation.Replies[0].Tweet.TweetID)
+		assert.Len(t, conversation.Replies[0].Replies, 1)
+		assert.Equal(t, nestedID, conversation.Replies[0].Replies[0].Tweet.TweetID)
+	})
+
+	t.Run("should return error if tweet not found", func(t *testing.T) {
+		_, err := service.GetConversation(context.Background(), "404")
+		assert.Equal(t, domain.ErrTweetNotFound, err)
+	})
+
+	t.Run("should not read conversations until their index is built", func(t *testing.T) {
+		service.ConversationsIndexReady = new(atomic.Bool)
+		defer func() { service.ConversationsIndexReady = nil }()
+
+		_, err := service.GetConversation(context.Background(), rootID)
+		assert.Equal(t, domain.ErrIndexNotReady, err)
+	})
+}
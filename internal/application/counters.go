@@ -0,0 +1,163 @@
+package application
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/go-redis/redis/v8"
+)
+
+// Counts of a tweet, like its like count, live on the Tweets item and are
+// mirrored to Redis under keys of their own, like likes:<tweetID>, so that
+// counting a like, retweet or quote does not touch the cached tweet. A count is cached from
+// DynamoDB on the first read that misses it and then kept up to date after
+// every write. Writes only add to counts that are already cached, so a
+// count is never cached from a partial value. A write that lands while its
+// count is being cached can still be missed, until the count expires.
+
+// counterCacheTTL is how long a count stays in the Redis cache, which bounds
+// how long a missed write shows
+var counterCacheTTL = time.Minute
+
+// tweetCounters are the counts of a tweet cached apart from it, along with
+// the prefix of their Redis keys and their field of a tweet
+var tweetCounters = []struct {
+	name   string
+	prefix string
+	field  func(tweet *domain.Tweet) *int64
+}{
+	{"LikeCount", "likes:", func(tweet *domain.Tweet) *int64 { return &tweet.LikeCount }},
+	{"RetweetCount", "retweet_count:", func(tweet *domain.Tweet) *int64 { return &tweet.RetweetCount }},
+	{"QuoteCount", "quote_count:", func(tweet *domain.Tweet) *int64 { return &tweet.QuoteCount }},
+}
+
+// incrementIfCached adds ARGV[1] to the count cached under KEYS[1], unless
+// it is not cached
+const incrementIfCached = `if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("INCRBY", KEYS[1], ARGV[1])
+end
+return false`
+
+// counterUpdate returns the transaction item adding delta to a count of a
+// tweet. It fails the transaction if the tweet is deleted.
+func counterUpdate(tweetID, counter string, delta int) *types.Update {
+	return &types.Update{
+		TableName: aws.String("Tweets"),
+		Key: map[string]types.AttributeValue{
+			"TweetID": &types.AttributeValueMemberS{Value: tweetID},
+		},
+		UpdateExpression:    aws.String("ADD #counter :delta"),
+		ConditionExpression: aws.String("attribute_exists(TweetID) AND attribute_not_exists(Deleted)"),
+		ExpressionAttributeNames: map[string]string{
+			"#counter": counter,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":delta": &types.AttributeValueMemberN{Value: strconv.Itoa(delta)},
+		},
+	}
+}
+
+// incrementCachedCounter adds delta to the cached count of a tweet once the
+// count changed in DynamoDB. The count is already stored, so Redis errors
+// are only logged; the count catches up when it expires.
+func (s *DynamoRedisTweetService) incrementCachedCounter(ctx context.Context, tweetID, counter string, delta int) {
+	for _, c := range tweetCounters {
+		if c.name != counter {
+			continue
+		}
+		err := s.RedisClient.Eval(ctx, incrementIfCached, []string{c.prefix + tweetID}, delta).Err()
+		if err != nil && err != redis.Nil {
+			log.Printf("Failed to update cached %s of tweet %s: %v", counter, tweetID, err)
+		}
+	}
+}
+
+// addCounts fills in the current counts of tweets. Retweets show the counts
+// of the original tweet. Counts are read from Redis with a single MGET, and
+// the tweets whose counts are not cached are read from DynamoDB in batches,
+// bypassing the tweet cache, and their counts cached. As in GetTweet, Redis
+// errors fall back to DynamoDB.
+func (s *DynamoRedisTweetService) addCounts(ctx context.Context, tweets []domain.Tweet) error {
+	if len(tweets) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(tweets)*len(tweetCounters))
+	for _, tweet := range tweets {
+		for _, c := range tweetCounters {
+			keys = append(keys, c.prefix+tweet.OriginalID())
+		}
+	}
+	cached, err := s.RedisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		log.Printf("Failed to read cached counts: %v", err)
+	}
+
+	counts := make(map[string]domain.Tweet, len(tweets))
+	var missing []string
+	for i, tweet := range tweets {
+		tweetID := tweet.OriginalID()
+		if _, ok := counts[tweetID]; ok {
+			continue
+		}
+
+		var tweetCounts domain.Tweet
+		complete := true
+		for j, c := range tweetCounters {
+			k := i*len(tweetCounters) + j
+			count, ok := "", false
+			if k < len(cached) {
+				count, ok = cached[k].(string)
+			}
+			if !ok {
+				complete = false
+				break
+			}
+			*c.field(&tweetCounts), _ = strconv.ParseInt(count, 10, 64)
+		}
+		if complete {
+			counts[tweetID] = tweetCounts
+		} else {
+			counts[tweetID] = domain.Tweet{}
+			missing = append(missing, tweetID)
+		}
+	}
+
+	for start := 0; start < len(missing); start += batchGetSize {
+		end := min(start+batchGetSize, len(missing))
+		fetched, err := s.batchGetTweets(ctx, missing[start:end])
+		if err != nil {
+			return err
+		}
+
+		for _, tweet := range fetched {
+			counts[tweet.TweetID] = tweet
+			s.cacheCounts(ctx, tweet)
+		}
+	}
+
+	for i := range tweets {
+		tweetCounts := counts[tweets[i].OriginalID()]
+		for _, c := range tweetCounters {
+			*c.field(&tweets[i]) = *c.field(&tweetCounts)
+		}
+	}
+	return nil
+}
+
+// cacheCounts caches the counts of a tweet read from DynamoDB, unless they
+// are already cached. The cache is only an optimization, so Redis errors are
+// only logged.
+func (s *DynamoRedisTweetService) cacheCounts(ctx context.Context, tweet domain.Tweet) {
+	for _, c := range tweetCounters {
+		err := s.RedisClient.SetNX(ctx, c.prefix+tweet.TweetID, *c.field(&tweet), counterCacheTTL).Err()
+		if err != nil {
+			log.Printf("Failed to cache %s of tweet %s: %v", c.name, tweet.TweetID, err)
+		}
+	}
+}
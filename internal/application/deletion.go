@@ -0,0 +1,285 @@
+package application
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+)
+
+// A deleted tweet is first marked with a Deleted attribute, in the same
+// transaction that enqueues the job cleaning up after it, and reads as
+// missing from then on. The job then runs in phases, each resumed from its
+// cursor after a failure: it deletes the retweets of the tweet, which copy
+// its content, removes the tweet from home timelines and finally deletes it
+// along with its mentions, hashtags and the effects of a reshare.
+
+// Phases of the cleanup of a deleted tweet, kept in the cursor of its job
+const (
+	deletePhaseRetweets  = ""
+	deletePhaseTimelines = "timelines"
+	deletePhaseFinish    = "finish"
+)
+
+// isDeletedItem reports whether a Tweets item is marked as deleted
+func isDeletedItem(item map[string]types.AttributeValue) bool {
+	_, ok := item["Deleted"]
+	return ok
+}
+
+// isDeleted reports whether a tweet is marked as deleted, reading it
+// consistently
+func (s *DynamoRedisTweetService) isDeleted(ctx context.Context, tweetID string) (bool, error) {
+	result, err := s.DynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Tweets"),
+		Key: map[string]types.AttributeValue{
+			"TweetID": &types.AttributeValueMemberS{Value: tweetID},
+		},
+		ProjectionExpression: aws.String("Deleted"),
+		ConsistentRead:       aws.Bool(true),
+	})
+	if err != nil {
+		return false, err
+	}
+	return isDeletedItem(result.Item), nil
+}
+
+// wasFannedOut reports whether a tweet was written to the home timelines of
+// its author's followers, which the tweets of celebrities are not
+func (s *DynamoRedisTweetService) wasFannedOut(ctx context.Context, tweetID string) (bool, error) {
+	result, err := s.DynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Tweets"),
+		Key: map[string]types.AttributeValue{
+			"TweetID": &types.AttributeValueMemberS{Value: tweetID},
+		},
+		ProjectionExpression: aws.String("NotFannedOut"),
+	})
+	if err != nil {
+		return false, err
+	}
+	notFannedOut, ok := result.Item["NotFannedOut"].(*types.AttributeValueMemberBOOL)
+	return !ok || !notFannedOut.Value, nil
+}
+
+// markDeleted marks a tweet as deleted and enqueues the job cleaning up after
+// it, in a single transaction. It returns domain.ErrTweetNotFound if the
+// tweet is already deleted.
+func (s *DynamoRedisTweetService) markDeleted(ctx context.Context, tweet domain.Tweet) error {
+	err := transactWrite(ctx, s.DynamoDBClient, []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName: aws.String("Tweets"),
+				Key: map[string]types.AttributeValue{
+					"TweetID": &types.AttributeValueMemberS{Value: tweet.TweetID},
+				},
+				UpdateExpression:    aws.String("SET Deleted = :true"),
+				ConditionExpression: aws.String("UserID = :userID AND attribute_not_exists(Deleted)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":true":   &types.AttributeValueMemberBOOL{Value: true},
+					":userID": &types.AttributeValueMemberS{Value: tweet.UserID},
+				},
+			},
+		},
+		tweetJob(jobDeleteTweet, tweet).item(),
+	})
+	if cancellationReason(err, 0) == "ConditionalCheckFailed" {
+		return domain.ErrTweetNotFound
+	} else if err != nil {
+		return err
+	}
+
+	s.wakeJobs()
+	return s.invalidateTweet(ctx, tweet.TweetID)
+}
+
+// deleteTweetStep runs the next step of the cleanup of a deleted tweet
+func (s *DynamoRedisTweetService) deleteTweetStep(ctx context.Context, j *job) (bool, error) {
+	tweet, err := j.tweet()
+	if err != nil {
+		return false, err
+	}
+
+	var startKey map[string]types.AttributeValue
+	if key, ok := j.Cursor["Key"].(*types.AttributeValueMemberM); ok {
+		startKey = key.Value
+	}
+
+	switch phase := stringAttr(j.Cursor, "Phase"); phase {
+	case deletePhaseRetweets:
+		lastKey, err := s.deleteRetweetsPage(ctx, tweet, startKey)
+		if err != nil {
+			return false, err
+		}
+		j.Cursor = deleteCursor(deletePhaseRetweets, lastKey)
+		if len(lastKey) == 0 {
+			j.Cursor = deleteCursor(deletePhaseTimelines, nil)
+		}
+		return false, nil
+
+	case deletePhaseTimelines:
+		if startKey == nil {
+			// A fan-out still running would write the tweet back into the
+			// timelines already cleaned up
+			fanningOut, err := s.hasJob(ctx, tweetJobID(jobFanOut, tweet.TweetID))
+			if err != nil {
+				return false, err
+			}
+			if fanningOut {
+				return false, errJobWaiting
+			}
+
+			// The tweets of a celebrity only reached their author's timeline
+			fannedOut, err := s.wasFannedOut(ctx, tweet.TweetID)
+			if err != nil {
+				return false, err
+			}
+			if !fannedOut {
+				j.Cursor = deleteCursor(deletePhaseFinish, nil)
+				return false, s.removeFromHomeTimelines(ctx, tweet, []string{tweet.UserID})
+			}
+		}
+
+		followers, lastKey, err := s.followerIDsPage(ctx, tweet.UserID, startKey)
+		if err != nil {
+			return false, err
+		}
+		j.Cursor = deleteCursor(deletePhaseTimelines, lastKey)
+		if len(lastKey) == 0 {
+			followers = append(followers, tweet.UserID)
+			j.Cursor = deleteCursor(deletePhaseFinish, nil)
+		}
+		return false, s.removeFromHomeTimelines(ctx, tweet, followers)
+
+	case deletePhaseFinish:
+		return true, s.finishDelete(ctx, tweet)
+
+	default:
+		return false, fmt.Errorf("unknown phase %q of a %s job", phase, j.Kind)
+	}
+}
+
+// deleteCursor returns the cursor of the cleanup of a deleted tweet
+func deleteCursor(phase string, key map[string]types.AttributeValue) map[string]types.AttributeValue {
+	cursor := map[string]types.AttributeValue{
+		"Phase": &types.AttributeValueMemberS{Value: phase},
+	}
+	if len(key) > 0 {
+		cursor["Key"] = &types.AttributeValueMemberM{Value: key}
+	}
+	return cursor
+}
+
+// deleteRetweetsPage marks a page of the retweets of a deleted tweet as
+// deleted too, each with a cleanup job of its own, and returns the key to
+// resume from. Retweets already marked are skipped, so a page can be
+// repeated.
+func (s *DynamoRedisTweetService) deleteRetweetsPage(ctx context.Context, tweet domain.Tweet, startKey map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	result, err := s.DynamoDBClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String("Retweets"),
+		KeyConditionExpression: aws.String("TweetID = :tweetID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":tweetID": &types.AttributeValueMemberS{Value: tweet.TweetID},
+		},
+		Limit:             aws.Int32(int32(jobPageSize)),
+		ExclusiveStartKey: startKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range result.Items {
+		retweet := domain.Tweet{
+			TweetID:     stringAttr(item, "RetweetID"),
+			UserID:      stringAttr(item, "UserID"),
+			Type:        domain.TweetTypeRetweet,
+			RetweetOfID: tweet.TweetID,
+		}
+		err := s.markDeleted(ctx, retweet)
+		if err != nil && err != domain.ErrTweetNotFound {
+			return nil, err
+		}
+	}
+	return result.LastEvaluatedKey, nil
+}
+
+// finishDelete deletes a tweet marked as deleted, once it is gone from every
+// timeline, along with its mentions and hashtags, and undoes the effects of
+// a retweet or quote on the tweet it reshared. The Tweets item goes last, in
+// the same transaction as the reshare, so a repeated step does not undo a
+// reshare twice.
+func (s *DynamoRedisTweetService) finishDelete(ctx context.Context, tweet domain.Tweet) error {
+	if err := s.unindexMentions(ctx, tweet); err != nil {
+		return err
+	}
+	if err := s.unindexHashtags(ctx, tweet); err != nil {
+		return err
+	}
+
+	items := []types.TransactWriteItem{
+		{
+			Delete: &types.Delete{
+				TableName: aws.String("Tweets"),
+				Key: map[string]types.AttributeValue{
+					"TweetID": &types.AttributeValueMemberS{Value: tweet.TweetID},
+				},
+				ConditionExpression: aws.String("attribute_exists(Deleted)"),
+			},
+		},
+	}
+	var resharedID, counter string
+	switch {
+	case tweet.IsRetweet():
+		resharedID, counter = tweet.RetweetOfID, "RetweetCount"
+		items = append(items, types.TransactWriteItem{
+			Delete: &types.Delete{
+				TableName: aws.String("Retweets"),
+				Key: map[string]types.AttributeValue{
+					"TweetID": &types.AttributeValueMemberS{Value: tweet.RetweetOfID},
+					"UserID":  &types.AttributeValueMemberS{Value: tweet.UserID},
+				},
+			},
+		})
+	case tweet.QuotedTweetID != "":
+		resharedID, counter = tweet.QuotedTweetID, "QuoteCount"
+	}
+	if counter != "" {
+		items = append(items, types.TransactWriteItem{Update: counterUpdate(resharedID, counter, -1)})
+	}
+
+	err := transactWrite(ctx, s.DynamoDBClient, items)
+	if counter != "" && cancellationReason(err, len(items)-1) == "ConditionalCheckFailed" {
+		// The reshared tweet was deleted, so there is no count left to update
+		counter = ""
+		err = transactWrite(ctx, s.DynamoDBClient, items[:len(items)-1])
+	}
+	if cancellationReason(err, 0) == "ConditionalCheckFailed" {
+		// Finished by an earlier run of the step
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if counter != "" {
+		s.incrementCachedCounter(ctx, resharedID, counter, -1)
+	}
+	return s.invalidateTweet(ctx, tweet.TweetID)
+}
+
+// hasJob reports whether a job is still pending
+func (s *DynamoRedisTweetService) hasJob(ctx context.Context, jobID string) (bool, error) {
+	result, err := s.DynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("Jobs"),
+		Key: map[string]types.AttributeValue{
+			"JobID": &types.AttributeValueMemberS{Value: jobID},
+		},
+		ProjectionExpression: aws.String("JobID"),
+		ConsistentRead:       aws.Bool(true),
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(result.Item) > 0, nil
+}
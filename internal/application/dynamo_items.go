@@ -0,0 +1,139 @@
+package application
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+)
+
+// tweetItem converts a tweet into a Tweets item
+func tweetItem(tweet domain.Tweet) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"TweetID":   &types.AttributeValueMemberS{Value: tweet.TweetID},
+		"UserID":    &types.AttributeValueMemberS{Value: tweet.UserID},
+		"Content":   &types.AttributeValueMemberS{Value: tweet.Content},
+		"Timestamp": &types.AttributeValueMemberN{Value: strconv.FormatInt(tweet.Timestamp, 10)},
+		"Type":      &types.AttributeValueMemberS{Value: string(domain.ParseTweetType(string(tweet.Type)))},
+	}
+	// Optional attributes are left out rather than stored empty, since index
+	// keys such as ConversationID cannot be empty strings
+	optional := map[string]string{
+		"ConversationID":   tweet.ConversationID,
+		"InReplyToTweetID": tweet.InReplyToTweetID,
+		"RetweetOfID":      tweet.RetweetOfID,
+		"QuotedTweetID":    tweet.QuotedTweetID,
+	}
+	for name, value := range optional {
+		if value != "" {
+			item[name] = &types.AttributeValueMemberS{Value: value}
+		}
+	}
+	if len(tweet.Mentions) > 0 {
+		item["Mentions"] = stringListAttr(tweet.Mentions)
+	}
+	if len(tweet.Hashtags) > 0 {
+		item["Hashtags"] = stringListAttr(tweet.Hashtags)
+	}
+	return item
+}
+
+// tweetFromItem converts a Tweets item into a tweet
+func tweetFromItem(item map[string]types.AttributeValue) domain.Tweet {
+	return domain.Tweet{
+		TweetID:          stringAttr(item, "TweetID"),
+		UserID:           stringAttr(item, "UserID"),
+		Content:          stringAttr(item, "Content"),
+		Timestamp:        numberAttr(item, "Timestamp"),
+		Type:             domain.ParseTweetType(stringAttr(item, "Type")),
+		InReplyToTweetID: stringAttr(item, "InReplyToTweetID"),
+		ConversationID:   stringAttr(item, "ConversationID"),
+		RetweetOfID:      stringAttr(item, "RetweetOfID"),
+		QuotedTweetID:    stringAttr(item, "QuotedTweetID"),
+		RetweetCount:     numberAttr(item, "RetweetCount"),
+		QuoteCount:       numberAttr(item, "QuoteCount"),
+		LikeCount:        numberAttr(item, "LikeCount"),
+		Mentions:         stringListValue(item, "Mentions"),
+		Hashtags:         stringListValue(item, "Hashtags"),
+	}
+}
+
+// homeTimelineItem converts a tweet into an item of the given user's
+// materialized home timeline
+func homeTimelineItem(userID string, tweet domain.Tweet) map[string]types.AttributeValue {
+	item := tweetItem(tweet)
+	item["AuthorID"] = item["UserID"]
+	item["UserID"] = &types.AttributeValueMemberS{Value: userID}
+	item["TweetID"] = &types.AttributeValueMemberN{Value: tweet.TweetID}
+	return item
+}
+
+// homeTimelineItemToTweet converts a HomeTimelines item into a tweet
+func homeTimelineItemToTweet(item map[string]types.AttributeValue) domain.Tweet {
+	tweet := tweetFromItem(item)
+	tweet.TweetID = strconv.FormatInt(numberAttr(item, "TweetID"), 10)
+	tweet.UserID = stringAttr(item, "AuthorID")
+	return tweet
+}
+
+// userItem converts a user into a Users item, without their password hash
+func userItem(user domain.User) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"UserID":      &types.AttributeValueMemberS{Value: user.ID},
+		"Handle":      &types.AttributeValueMemberS{Value: user.Handle},
+		"DisplayName": &types.AttributeValueMemberS{Value: user.DisplayName},
+		"CreatedAt":   &types.AttributeValueMemberN{Value: strconv.FormatInt(user.CreatedAt, 10)},
+	}
+}
+
+// userFromItem converts a Users item into a user
+func userFromItem(item map[string]types.AttributeValue) domain.User {
+	return domain.User{
+		ID:          stringAttr(item, "UserID"),
+		Handle:      stringAttr(item, "Handle"),
+		DisplayName: stringAttr(item, "DisplayName"),
+		CreatedAt:   numberAttr(item, "CreatedAt"),
+	}
+}
+
+// stringAttr returns a string attribute of an item, or "" if it is missing
+func stringAttr(item map[string]types.AttributeValue, name string) string {
+	if attr, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return attr.Value
+	}
+	return ""
+}
+
+// numberAttr returns a number attribute of an item, or 0 if it is missing
+func numberAttr(item map[string]types.AttributeValue, name string) int64 {
+	if attr, ok := item[name].(*types.AttributeValueMemberN); ok {
+		n, _ := strconv.ParseInt(attr.Value, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// stringListAttr converts a list of strings into a list attribute
+func stringListAttr(values []string) *types.AttributeValueMemberL {
+	list := make([]types.AttributeValue, len(values))
+	for i, value := range values {
+		list[i] = &types.AttributeValueMemberS{Value: value}
+	}
+	return &types.AttributeValueMemberL{Value: list}
+}
+
+// stringListValue returns a list of strings attribute of an item, or nil if
+// it is missing
+func stringListValue(item map[string]types.AttributeValue, name string) []string {
+	attr, ok := item[name].(*types.AttributeValueMemberL)
+	if !ok {
+		return nil
+	}
+	values := make([]string, 0, len(attr.Value))
+	for _, value := range attr.Value {
+		if s, ok := value.(*types.AttributeValueMemberS); ok {
+			values = append(values, s.Value)
+		}
+	}
+	return values
+}
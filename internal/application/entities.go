@@ -0,0 +1,115 @@
+package application
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+)
+
+// Mentions are kept in the Mentions tweet index, partitioned by the
+// mentioned user, and hashtags in the Hashtags tweet index, partitioned by
+// the normalized tag. Tweets keep their mentions as the handles written in
+// them; each is resolved to a user ID through the Handles table, regardless
+// of case, and mentions of unknown handles are not indexed.
+
+// GetMentions retrieves a page of the tweets that mention a user, newest
+// tweets first
+func (s *DynamoRedisTweetService) GetMentions(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error) {
+	ctx, cancel := s.Timeouts.read(ctx)
+	defer cancel()
+
+	return s.queryTweetIndex(ctx, "Mentions", "UserID", userID, userID, page)
+}
+
+// indexMentions lists a tweet under every user it mentions
+func (s *DynamoRedisTweetService) indexMentions(ctx context.Context, tweet domain.Tweet) error {
+	userIDs, err := s.resolveMentions(ctx, tweet.Mentions)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if err := s.indexTweet(ctx, "Mentions", "UserID", userID, tweet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexMentions removes a tweet from the mentions of every user it
+// mentions
+func (s *DynamoRedisTweetService) unindexMentions(ctx context.Context, tweet domain.Tweet) error {
+	userIDs, err := s.resolveMentions(ctx, tweet.Mentions)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if err := s.unindexTweet(ctx, "Mentions", "UserID", userID, tweet.TweetID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveMentions returns the IDs of the users holding the mentioned
+// handles, without duplicates. Handles nobody holds are left out.
+func (s *DynamoRedisTweetService) resolveMentions(ctx context.Context, handles []string) ([]string, error) {
+	var userIDs []string
+	seen := make(map[string]bool, len(handles))
+	for _, handle := range handles {
+		handle = domain.NormalizeHandle(handle)
+		if seen[handle] {
+			continue
+		}
+		seen[handle] = true
+
+		result, err := s.DynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String("Handles"),
+			Key: map[string]types.AttributeValue{
+				"Handle": &types.AttributeValueMemberS{Value: handle},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if userID := stringAttr(result.Item, "UserID"); userID != "" {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, nil
+}
+
+// indexHashtags lists a tweet under every hashtag in it
+func (s *DynamoRedisTweetService) indexHashtags(ctx context.Context, tweet domain.Tweet) error {
+	for _, tag := range tweet.Hashtags {
+		if err := s.indexTweet(ctx, "Hashtags", "Tag", tag, tweet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexHashtags removes a tweet from every hashtag in it
+func (s *DynamoRedisTweetService) unindexHashtags(ctx context.Context, tweet domain.Tweet) error {
+	for _, tag := range tweet.Hashtags {
+		if err := s.unindexTweet(ctx, "Hashtags", "Tag", tag, tweet.TweetID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetHashtagTimeline retrieves a page of the tweets with a hashtag, newest
+// tweets first. The hashtag matches regardless of case.
+func (s *DynamoRedisTweetService) GetHashtagTimeline(ctx context.Context, tag string, page domain.PageRequest) (domain.TimelinePage, error) {
+	ctx, cancel := s.Timeouts.read(ctx)
+	defer cancel()
+
+	tag, err := domain.ParseHashtag(tag)
+	if err != nil {
+		return domain.TimelinePage{}, err
+	}
+	return s.queryTweetIndex(ctx, "Hashtags", "Tag", tag, "", page)
+}
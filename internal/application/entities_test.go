@@ -0,0 +1,265 @@
+package application
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMentions(t *testing.T) {
+	handles := map[string]string{"bob": "2", "carol": "3"}
+	tweets := map[string]map[string]types.AttributeValue{}
+	mentions := map[string]map[int64]bool{}
+	mockDynamoDBClient := &MockDynamoDBClient{
+		PutItemFunc: func(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			switch *input.TableName {
+			case "Tweets":
+				tweets[input.Item["TweetID"].(*types.AttributeValueMemberS).Value] = input.Item
+			case "Mentions":
+				userID := input.Item["UserID"].(*types.AttributeValueMemberS).Value
+				if mentions[userID] == nil {
+					mentions[userID] = map[int64]bool{}
+				}
+				mentions[userID][numberAttr(input.Item, "TweetID")] = true
+			}
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			switch *input.TableName {
+			case "Tweets":
+				return &dynamodb.GetItemOutput{Item: tweets[input.Key["TweetID"].(*types.AttributeValueMemberS).Value]}, nil
+			case "Handles":
+				// Handles are stored normalized
+				userID, ok := handles[input.Key["Handle"].(*types.AttributeValueMemberS).Value]
+				if !ok {
+					return &dynamodb.GetItemOutput{}, nil
+				}
+				return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+					"UserID": &types.AttributeValueMemberS{Value: userID},
+				}}, nil
+			}
+			return &dynamodb.GetItemOutput{}, nil
+		},
+		UpdateItemFunc: func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			if aws.ToString(input.UpdateExpression) == "SET Deleted = :true" {
+				return markDeletedItem(tweets, input)
+			}
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+		DeleteItemFunc: func(ctx context.Context, input *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+			switch *input.TableName {
+			case "Tweets":
+				delete(tweets, input.Key["TweetID"].(*types.AttributeValueMemberS).Value)
+			case "Mentions":
+				delete(mentions[input.Key["UserID"].(*types.AttributeValueMemberS).Value], numberAttr(input.Key, "TweetID"))
+			}
+			return &dynamodb.DeleteItemOutput{}, nil
+		},
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			if *input.TableName != "Mentions" {
+				return &dynamodb.QueryOutput{}, nil
+			}
+			userID := input.ExpressionAttributeValues[":key"].(*types.AttributeValueMemberS).Value
+			minID := numberAttr(input.ExpressionAttributeValues, ":minID")
+			maxID := numberAttr(input.ExpressionAttributeValues, ":maxID")
+			var ids []int64
+			for id := range mentions[userID] {
+				if id >= minID && id <= maxID {
+					ids = append(ids, id)
+				}
+			}
+			sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+			if len(ids) > int(*input.Limit) {
+				ids = ids[:*input.Limit]
+			}
+			var items []map[string]types.AttributeValue
+			for _, id := range ids {
+				items = append(items, map[string]types.AttributeValue{
+					"UserID":  &types.AttributeValueMemberS{Value: userID},
+					"TweetID": &types.AttributeValueMemberN{Value: strconv.FormatInt(id, 10)},
+				})
+			}
+			return &dynamodb.QueryOutput{Items: items}, nil
+		},
+	}
+	mockRedisClient := &MockRedisClient{
+		GetFunc: func(ctx context.Context, key string) *redis.StringCmd {
+			return redis.NewStringResult("", redis.Nil)
+		},
+		DelFunc: func(ctx context.Context, keys ...string) *redis.IntCmd {
+			return redis.NewIntResult(int64(len(keys)), nil)
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, mockRedisClient)
+
+	firstID, err := service.PostTweet(context.Background(), "1", "Hello @Bob and @carol")
+	assert.NoError(t, err)
+	secondID, err := service.PostTweet(context.Background(), "3", "@BOB @bob again, @nobody")
+	assert.NoError(t, err)
+
+	t.Run("should store the mentions of a tweet as written", func(t *testing.T) {
+		tweet, err := service.GetTweet(context.Background(), firstID)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Bob", "carol"}, tweet.Mentions)
+	})
+
+	t.Run("should index mentions under the user holding the handle", func(t *testing.T) {
+		assert.Len(t, mentions["2"], 2)
+		assert.Len(t, mentions["3"], 1)
+		assert.NotContains(t, mentions, "nobody")
+	})
+
+	t.Run("should page the mentions of a user newest first", func(t *testing.T) {
+		page, err := service.GetMentions(context.Background(), "2", domain.PageRequest{Limit: 1})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 1)
+		assert.Equal(t, secondID, page.Tweets[0].TweetID)
+
+		page, err = service.GetMentions(context.Background(), "2", domain.PageRequest{Limit: 1, Cursor: page.NextCursor})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 1)
+		assert.Equal(t, firstID, page.Tweets[0].TweetID)
+	})
+
+	t.Run("should remove the mentions of a deleted tweet", func(t *testing.T) {
+		err := service.DeleteTweet(context.Background(), "1", firstID)
+		assert.NoError(t, err)
+
+		page, err := service.GetMentions(context.Background(), "3", domain.PageRequest{})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Tweets)
+
+		// The index is cleaned up in the background
+		runAllJobs(t, service)
+		assert.Empty(t, mentions["3"])
+	})
+}
+
+func TestHashtags(t *testing.T) {
+	handles := map[string]string{}
+	tweets := map[string]map[string]types.AttributeValue{}
+	hashtags := map[string]map[int64]bool{}
+	mockDynamoDBClient := &MockDynamoDBClient{
+		PutItemFunc: func(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			switch *input.TableName {
+			case "Tweets":
+				tweets[input.Item["TweetID"].(*types.AttributeValueMemberS).Value] = input.Item
+			case "Hashtags":
+				tag := input.Item["Tag"].(*types.AttributeValueMemberS).Value
+				if hashtags[tag] == nil {
+					hashtags[tag] = map[int64]bool{}
+				}
+				hashtags[tag][numberAttr(input.Item, "TweetID")] = true
+			}
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			switch *input.TableName {
+			case "Tweets":
+				return &dynamodb.GetItemOutput{Item: tweets[input.Key["TweetID"].(*types.AttributeValueMemberS).Value]}, nil
+			case "Handles":
+				// Handles are stored normalized
+				userID, ok := handles[input.Key["Handle"].(*types.AttributeValueMemberS).Value]
+				if !ok {
+					return &dynamodb.GetItemOutput{}, nil
+				}
+				return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+					"UserID": &types.AttributeValueMemberS{Value: userID},
+				}}, nil
+			}
+			return &dynamodb.GetItemOutput{}, nil
+		},
+		UpdateItemFunc: func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			if aws.ToString(input.UpdateExpression) == "SET Deleted = :true" {
+				return markDeletedItem(tweets, input)
+			}
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+		DeleteItemFunc: func(ctx context.Context, input *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+			switch *input.TableName {
+			case "Tweets":
+				delete(tweets, input.Key["TweetID"].(*types.AttributeValueMemberS).Value)
+			case "Hashtags":
+				delete(hashtags[input.Key["Tag"].(*types.AttributeValueMemberS).Value], numberAttr(input.Key, "TweetID"))
+			}
+			return &dynamodb.DeleteItemOutput{}, nil
+		},
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			// Without a viewer the likes of the tweets are never queried
+			assert.NotEqual(t, "Likes", *input.TableName)
+			if *input.TableName != "Hashtags" {
+				return &dynamodb.QueryOutput{}, nil
+			}
+			tag := input.ExpressionAttributeValues[":key"].(*types.AttributeValueMemberS).Value
+			var ids []int64
+			for id := range hashtags[tag] {
+				ids = append(ids, id)
+			}
+			sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+			var items []map[string]types.AttributeValue
+			for _, id := range ids {
+				items = append(items, map[string]types.AttributeValue{
+					"Tag":     &types.AttributeValueMemberS{Value: tag},
+					"TweetID": &types.AttributeValueMemberN{Value: strconv.FormatInt(id, 10)},
+				})
+			}
+			return &dynamodb.QueryOutput{Items: items}, nil
+		},
+	}
+	mockRedisClient := &MockRedisClient{
+		GetFunc: func(ctx context.Context, key string) *redis.StringCmd {
+			return redis.NewStringResult("", redis.Nil)
+		},
+		DelFunc: func(ctx context.Context, keys ...string) *redis.IntCmd {
+			return redis.NewIntResult(int64(len(keys)), nil)
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, mockRedisClient)
+
+	firstID, err := service.PostTweet(context.Background(), "1", "Vamos #Argentina #Fútbol")
+	assert.NoError(t, err)
+	secondID, err := service.PostTweet(context.Background(), "2", "#ARGENTINA campeón")
+	assert.NoError(t, err)
+
+	t.Run("should store the normalized hashtags of a tweet", func(t *testing.T) {
+		tweet, err := service.GetTweet(context.Background(), firstID)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"argentina", "fútbol"}, tweet.Hashtags)
+	})
+
+	t.Run("should list the tweets of a hashtag regardless of case", func(t *testing.T) {
+		page, err := service.GetHashtagTimeline(context.Background(), "#ArGeNtInA", domain.PageRequest{})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 2)
+		assert.Equal(t, secondID, page.Tweets[0].TweetID)
+		assert.Equal(t, firstID, page.Tweets[1].TweetID)
+	})
+
+	t.Run("should reject an invalid hashtag", func(t *testing.T) {
+		_, err := service.GetHashtagTimeline(context.Background(), "no spaces", domain.PageRequest{})
+		assert.ErrorIs(t, err, domain.ErrInvalidHashtag)
+	})
+
+	t.Run("should remove the hashtags of a deleted tweet", func(t *testing.T) {
+		err := service.DeleteTweet(context.Background(), "1", firstID)
+		assert.NoError(t, err)
+
+		page, err := service.GetHashtagTimeline(context.Background(), "FÚTBOL", domain.PageRequest{})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Tweets)
+
+		// The index is cleaned up in the background
+		runAllJobs(t, service)
+		assert.Empty(t, hashtags["fútbol"])
+	})
+}
@@ -0,0 +1,149 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/go-redis/redis/v8"
+)
+
+// isCelebrity reports whether a user with the given follower count is above
+// the celebrity threshold
+func (s *DynamoRedisTweetService) isCelebrity(followerCount int64) bool {
+	return s.CelebrityThreshold > 0 && followerCount > int64(s.CelebrityThreshold)
+}
+
+// fanOutStep pushes a tweet into the home timeline of a page of the
+// author's followers in DynamoDB, in batches, and into any cached home
+// timeline of them in Redis. The author's home timeline is written along
+// with the tweet. The fan-out of a tweet deleted in the meantime stops
+// early; the cleanup of the tweet waits for it.
+func (s *DynamoRedisTweetService) fanOutStep(ctx context.Context, j *job) (bool, error) {
+	tweet, err := j.tweet()
+	if err != nil {
+		return false, err
+	}
+	deleted, err := s.isDeleted(ctx, tweet.TweetID)
+	if err != nil || deleted {
+		return deleted, err
+	}
+
+	followers, lastKey, err := s.followerIDsPage(ctx, tweet.UserID, j.Cursor)
+	if err != nil {
+		return false, err
+	}
+
+	requests := make([]types.WriteRequest, 0, len(followers))
+	for _, followerID := range followers {
+		requests = append(requests, types.WriteRequest{
+			PutRequest: &types.PutRequest{Item: homeTimelineItem(followerID, tweet)},
+		})
+	}
+	if err := batchWrite(ctx, s.DynamoDBClient, "HomeTimelines", requests); err != nil {
+		return false, err
+	}
+
+	for _, followerID := range followers {
+		if err := s.addToCachedTimeline(ctx, followerID, tweet); err != nil {
+			return false, err
+		}
+	}
+
+	j.Cursor = lastKey
+	return len(lastKey) == 0, nil
+}
+
+// addToCachedTimeline adds a tweet to a user's timeline if it is in the cache.
+// Timelines that are not cached are left alone; they are rebuilt from
+// DynamoDB on the next read.
+func (s *DynamoRedisTweetService) addToCachedTimeline(ctx context.Context, userID string, tweet domain.Tweet) error {
+	cachedTimeline, err := s.RedisClient.Get(ctx, "timeline:"+userID).Result()
+	if err == redis.Nil {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var timeline []domain.Tweet
+	err = json.Unmarshal([]byte(cachedTimeline), &timeline)
+	if err != nil {
+		return err
+	}
+
+	// A retried fan-out may have added the tweet already
+	for _, cached := range timeline {
+		if cached.TweetID == tweet.TweetID {
+			return nil
+		}
+	}
+
+	// Add the new tweet to the timeline
+	timeline = append(timeline, tweet)
+
+	// Sort the timeline by tweet ID, which pages are cut by; timestamps
+	// come from the clocks of different instances
+	sort.Slice(timeline, func(i, j int) bool {
+		return tweetIDValue(timeline[i]) > tweetIDValue(timeline[j])
+	})
+
+	// Only the newest tweets are kept in the cache
+	if len(timeline) > timelineCacheSize {
+		timeline = timeline[:timelineCacheSize]
+	}
+
+	// Cache the updated timeline in Redis
+	timelineJSON, err := json.Marshal(timeline)
+	if err != nil {
+		return err
+	}
+	return s.RedisClient.Set(ctx, "timeline:"+userID, timelineJSON, 10*time.Minute).Err()
+}
+
+// getCelebrityTweets retrieves up to limit tweets per celebrity the user
+// follows, with IDs in the range (sinceID, maxID]
+func (s *DynamoRedisTweetService) getCelebrityTweets(ctx context.Context, userID string, sinceID, maxID int64, limit int) ([]domain.Tweet, error) {
+	celebrities, err := getFollowedCelebrities(ctx, s.DynamoDBClient, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var tweets []domain.Tweet
+	for _, celebrityID := range celebrities {
+		celebrityTweets, err := s.queryUserTweets(ctx, celebrityID, sinceID, maxID, limit)
+		if err != nil {
+			return nil, err
+		}
+		tweets = append(tweets, celebrityTweets...)
+	}
+
+	return tweets, nil
+}
+
+// mergeTimelines merges two timelines newest first, dropping duplicate tweets
+func mergeTimelines(a, b []domain.Tweet) []domain.Tweet {
+	if len(b) == 0 {
+		return a
+	}
+
+	merged := make([]domain.Tweet, 0, len(a)+len(b))
+	seen := make(map[string]bool, len(a)+len(b))
+	for _, timeline := range [][]domain.Tweet{a, b} {
+		for _, tweet := range timeline {
+			if seen[tweet.TweetID] {
+				continue
+			}
+			seen[tweet.TweetID] = true
+			merged = append(merged, tweet)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return tweetIDValue(merged[i]) > tweetIDValue(merged[j])
+	})
+
+	return merged
+}
@@ -0,0 +1,252 @@
+package application
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsCelebrity(t *testing.T) {
+	service := NewDynamoRedisTweetService(&MockDynamoDBClient{}, &MockRedisClient{})
+	service.CelebrityThreshold = 2
+
+	assert.False(t, service.isCelebrity(0))
+	assert.False(t, service.isCelebrity(2))
+	assert.True(t, service.isCelebrity(3))
+
+	t.Run("should never treat users as celebrities when the threshold is zero", func(t *testing.T) {
+		service.CelebrityThreshold = 0
+		assert.False(t, service.isCelebrity(1000000))
+	})
+}
+
+func TestPostTweetCelebrity(t *testing.T) {
+	var homeTimelineOwners []string
+	var tweetItems []map[string]types.AttributeValue
+	var flags []string
+	var listedBy []string
+	celebrityListed := false
+	followerQueries := 0
+	mockDynamoDBClient := &MockDynamoDBClient{
+		PutItemFunc: func(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			switch *input.TableName {
+			case "HomeTimelines":
+				homeTimelineOwners = append(homeTimelineOwners, input.Item["UserID"].(*types.AttributeValueMemberS).Value)
+			case "Tweets":
+				tweetItems = append(tweetItems, input.Item)
+			}
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+				"FollowersCount":  &types.AttributeValueMemberN{Value: "3"},
+				"CelebrityListed": &types.AttributeValueMemberBOOL{Value: celebrityListed},
+			}}, nil
+		},
+		UpdateItemFunc: func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			userID := input.Key["UserID"].(*types.AttributeValueMemberS).Value
+			if userID == "star" {
+				flags = append(flags, aws.ToString(input.UpdateExpression))
+			} else {
+				assert.Equal(t, "ADD FollowedCelebrities :celebrity", aws.ToString(input.UpdateExpression))
+				assert.Equal(t, []string{"star"}, input.ExpressionAttributeValues[":celebrity"].(*types.AttributeValueMemberSS).Value)
+				listedBy = append(listedBy, userID)
+			}
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			followerQueries++
+			return &dynamodb.QueryOutput{
+				Items: []map[string]types.AttributeValue{
+					{"UserID": &types.AttributeValueMemberS{Value: "1"}, "FolloweeID": &types.AttributeValueMemberS{Value: "star"}},
+					{"UserID": &types.AttributeValueMemberS{Value: "2"}, "FolloweeID": &types.AttributeValueMemberS{Value: "star"}},
+					{"UserID": &types.AttributeValueMemberS{Value: "3"}, "FolloweeID": &types.AttributeValueMemberS{Value: "star"}},
+				},
+			}, nil
+		},
+	}
+	mockRedisClient := &MockRedisClient{
+		GetFunc: func(ctx context.Context, key string) *redis.StringCmd {
+			return redis.NewStringResult("", redis.Nil)
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, mockRedisClient)
+	reset := func() {
+		homeTimelineOwners, tweetItems, flags, listedBy = nil, nil, nil, nil
+		followerQueries = 0
+	}
+
+	t.Run("should fan out when the author is below the threshold", func(t *testing.T) {
+		reset()
+		service.CelebrityThreshold = 3
+
+		_, err := service.PostTweet(context.Background(), "star", "Hello")
+		assert.NoError(t, err)
+		assert.NoError(t, service.runPendingJobs(context.Background()))
+		assert.Empty(t, flags)
+		assert.ElementsMatch(t, []string{"1", "2", "3", "star"}, homeTimelineOwners)
+		assert.NotContains(t, tweetItems[0], "NotFannedOut")
+	})
+
+	t.Run("should wait to fan out until the followers index is built", func(t *testing.T) {
+		reset()
+		service.CelebrityThreshold = 3
+		wait := jobWaitInterval
+		defer func() { jobWaitInterval = wait }()
+		jobWaitInterval = 0
+		service.FollowersIndexReady = new(atomic.Bool)
+		defer func() { service.FollowersIndexReady = nil }()
+
+		_, err := service.PostTweet(context.Background(), "star", "Hello")
+		assert.NoError(t, err)
+		assert.NoError(t, service.runPendingJobs(context.Background()))
+		assert.Equal(t, []string{"star"}, homeTimelineOwners)
+		assert.Zero(t, followerQueries)
+		assert.Equal(t, 1, mockDynamoDBClient.jobs.len())
+
+		service.FollowersIndexReady.Store(true)
+		runAllJobs(t, service)
+		assert.ElementsMatch(t, []string{"1", "2", "3", "star"}, homeTimelineOwners)
+	})
+
+	t.Run("should only write the author's home timeline when the author is a celebrity", func(t *testing.T) {
+		reset()
+		service.CelebrityThreshold = 2
+
+		_, err := service.PostTweet(context.Background(), "star", "Hello")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"star"}, homeTimelineOwners)
+		// Its deletion skips the followers
+		assert.Contains(t, tweetItems[0], "NotFannedOut")
+
+		// The author is flagged along with the job listing them, without
+		// reading their followers
+		assert.Equal(t, []string{"SET Celebrity = :true, CelebrityJob = :jobID"}, flags)
+		assert.Empty(t, listedBy)
+		assert.Zero(t, followerQueries)
+
+		// The job lists them as a celebrity for every follower
+		assert.NoError(t, service.runPendingJobs(context.Background()))
+		assert.ElementsMatch(t, []string{"1", "2", "3"}, listedBy)
+		assert.Equal(t, "SET CelebrityListed = :true REMOVE CelebrityJob", flags[len(flags)-1])
+		assert.Zero(t, mockDynamoDBClient.jobs.len())
+	})
+
+	t.Run("should not list a celebrity again", func(t *testing.T) {
+		reset()
+		celebrityListed = true
+
+		_, err := service.PostTweet(context.Background(), "star", "Hello")
+		assert.NoError(t, err)
+		assert.Empty(t, flags)
+		assert.Empty(t, listedBy)
+	})
+}
+
+func TestGetTimelineMergesCelebrityTweets(t *testing.T) {
+	mockDynamoDBClient := &MockDynamoDBClient{
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			if *input.TableName == "HomeTimelines" {
+				return &dynamodb.QueryOutput{
+					Items: []map[string]types.AttributeValue{
+						{
+							"UserID":    &types.AttributeValueMemberS{Value: "1"},
+							"TweetID":   &types.AttributeValueMemberN{Value: "30"},
+							"AuthorID":  &types.AttributeValueMemberS{Value: "friend"},
+							"Content":   &types.AttributeValueMemberS{Value: "From a friend"},
+							"Timestamp": &types.AttributeValueMemberN{Value: "30"},
+						},
+						{
+							"UserID":    &types.AttributeValueMemberS{Value: "1"},
+							"TweetID":   &types.AttributeValueMemberN{Value: "10"},
+							"AuthorID":  &types.AttributeValueMemberS{Value: "star"},
+							"Content":   &types.AttributeValueMemberS{Value: "Before I was famous"},
+							"Timestamp": &types.AttributeValueMemberN{Value: "10"},
+						},
+					},
+				}, nil
+			}
+			if aws.ToString(input.IndexName) == userTweetsIndex {
+				// The celebrity's tweets, newest first
+				assert.Equal(t, "star", input.ExpressionAttributeValues[":userID"].(*types.AttributeValueMemberS).Value)
+				assert.False(t, aws.ToBool(input.ScanIndexForward))
+				var items []map[string]types.AttributeValue
+				for _, tweetID := range []string{"20", "10"} {
+					items = append(items, map[string]types.AttributeValue{
+						"TweetID":   &types.AttributeValueMemberS{Value: tweetID},
+						"UserID":    &types.AttributeValueMemberS{Value: "star"},
+						"Content":   &types.AttributeValueMemberS{Value: "Celebrity tweet " + tweetID},
+						"Timestamp": &types.AttributeValueMemberN{Value: tweetID},
+					})
+				}
+				return &dynamodb.QueryOutput{Items: items}, nil
+			}
+			return &dynamodb.QueryOutput{
+				Items: []map[string]types.AttributeValue{
+					{"UserID": &types.AttributeValueMemberS{Value: "1"}, "FolloweeID": &types.AttributeValueMemberS{Value: "friend"}},
+					{"UserID": &types.AttributeValueMemberS{Value: "1"}, "FolloweeID": &types.AttributeValueMemberS{Value: "star"}},
+				},
+			}, nil
+		},
+		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			if *input.TableName == "Tweets" {
+				// Like counts
+				return &dynamodb.GetItemOutput{}, nil
+			}
+			// The user follows a single celebrity
+			assert.Equal(t, "1", input.Key["UserID"].(*types.AttributeValueMemberS).Value)
+			assert.Equal(t, "FollowedCelebrities", aws.ToString(input.ProjectionExpression))
+			return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+				"FollowedCelebrities": &types.AttributeValueMemberSS{Value: []string{"star"}},
+			}}, nil
+		},
+	}
+	mockRedisClient := &MockRedisClient{
+		GetFunc: func(ctx context.Context, key string) *redis.StringCmd {
+			return redis.NewStringResult("", redis.Nil)
+		},
+		SetFunc: func(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+			return redis.NewStatusResult("", nil)
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, mockRedisClient)
+
+	page, err := service.GetTimeline(context.Background(), "1", domain.PageRequest{})
+	timeline := page.Tweets
+	assert.NoError(t, err)
+
+	var tweetIDs []string
+	for _, tweet := range timeline {
+		tweetIDs = append(tweetIDs, tweet.TweetID)
+	}
+	assert.Equal(t, []string{"30", "20", "10"}, tweetIDs)
+}
+
+func TestMergeTimelines(t *testing.T) {
+	a := []domain.Tweet{{TweetID: "3", Timestamp: 3}, {TweetID: "1", Timestamp: 1}}
+	b := []domain.Tweet{{TweetID: "2", Timestamp: 2}, {TweetID: "1", Timestamp: 1}}
+
+	merged := mergeTimelines(a, b)
+	assert.Equal(t, []domain.Tweet{{TweetID: "3", Timestamp: 3}, {TweetID: "2", Timestamp: 2}, {TweetID: "1", Timestamp: 1}}, merged)
+
+	t.Run("should return the first timeline unchanged when there is nothing to merge", func(t *testing.T) {
+		assert.Equal(t, a, mergeTimelines(a, nil))
+	})
+
+	t.Run("should order tweets by ID, which pages are cut by", func(t *testing.T) {
+		// A clock running behind stamped the newer tweet earlier
+		merged := mergeTimelines([]domain.Tweet{{TweetID: "20", Timestamp: 1}}, []domain.Tweet{{TweetID: "10", Timestamp: 2}})
+		assert.Equal(t, "20", merged[0].TweetID)
+		assert.Equal(t, "10", merged[1].TweetID)
+	})
+}
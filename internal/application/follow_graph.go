@@ -0,0 +1,196 @@
+package application
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+)
+
+// The follow graph is directed: every UserFollowers item is a single follow,
+// partitioned by the follower (UserID) and sorted by the followed user
+// (FolloweeID). FolloweeIDIndex inverts it to list the followers of a user.
+const followersIndex = "FolloweeIDIndex"
+
+// Follow counts live on the UserTimelines item of each user, in
+// FollowersCount and FollowingCount. They change in the same transaction as
+// the follow itself, so a page of the graph reads them from a single item
+// instead of counting the whole partition.
+
+// followCountUpdate returns the transaction item adding delta to a follow
+// count of a user
+func followCountUpdate(userID, counter string, delta int) types.TransactWriteItem {
+	return types.TransactWriteItem{
+		Update: &types.Update{
+			TableName: aws.String("UserTimelines"),
+			Key: map[string]types.AttributeValue{
+				"UserID": &types.AttributeValueMemberS{Value: userID},
+			},
+			UpdateExpression: aws.String("ADD #counter :delta"),
+			ExpressionAttributeNames: map[string]string{
+				"#counter": counter,
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":delta": &types.AttributeValueMemberN{Value: strconv.Itoa(delta)},
+			},
+		},
+	}
+}
+
+// getFollowCount retrieves a follow count of a user
+func getFollowCount(ctx context.Context, client DynamoDBClient, userID, counter string) (int64, error) {
+	result, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("UserTimelines"),
+		Key: map[string]types.AttributeValue{
+			"UserID": &types.AttributeValueMemberS{Value: userID},
+		},
+		ProjectionExpression: aws.String("#counter"),
+		ExpressionAttributeNames: map[string]string{
+			"#counter": counter,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return numberAttr(result.Item, counter), nil
+}
+
+// queryFollowing retrieves every user the given user follows
+func queryFollowing(ctx context.Context, client DynamoDBClient, userID string) ([]string, error) {
+	return queryFollowGraph(ctx, client, &dynamodb.QueryInput{
+		TableName:              aws.String("UserFollowers"),
+		KeyConditionExpression: aws.String("UserID = :userID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":userID": &types.AttributeValueMemberS{Value: userID},
+		},
+	}, "FolloweeID")
+}
+
+// queryFollowers retrieves every user following the given user
+func queryFollowers(ctx context.Context, client DynamoDBClient, userID string) ([]string, error) {
+	return queryFollowGraph(ctx, client, &dynamodb.QueryInput{
+		TableName:              aws.String("UserFollowers"),
+		IndexName:              aws.String(followersIndex),
+		KeyConditionExpression: aws.String("FolloweeID = :userID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":userID": &types.AttributeValueMemberS{Value: userID},
+		},
+	}, "UserID")
+}
+
+// queryFollowerIDs retrieves up to limit users following the given user,
+// starting after startKey, along with the key the next page starts after,
+// which is empty on the last page
+func queryFollowerIDs(ctx context.Context, client DynamoDBClient, userID string, startKey map[string]types.AttributeValue, limit int) ([]string, map[string]types.AttributeValue, error) {
+	result, err := client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String("UserFollowers"),
+		IndexName:              aws.String(followersIndex),
+		KeyConditionExpression: aws.String("FolloweeID = :userID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":userID": &types.AttributeValueMemberS{Value: userID},
+		},
+		ExclusiveStartKey: startKey,
+		Limit:             aws.Int32(int32(limit)),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	followers := make([]string, 0, len(result.Items))
+	for _, item := range result.Items {
+		if attr, ok := item["UserID"].(*types.AttributeValueMemberS); ok {
+			followers = append(followers, attr.Value)
+		}
+	}
+	return followers, result.LastEvaluatedKey, nil
+}
+
+// queryFollowGraph runs a query over UserFollowers through every page of
+// results and returns the given attribute of each item
+func queryFollowGraph(ctx context.Context, client DynamoDBClient, input *dynamodb.QueryInput, attribute string) ([]string, error) {
+	var userIDs []string
+	for {
+		result, err := client.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Items {
+			if attr, ok := item[attribute].(*types.AttributeValueMemberS); ok {
+				userIDs = append(userIDs, attr.Value)
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return userIDs, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// queryFollowingPage retrieves a page of the users the given user follows
+func queryFollowingPage(ctx context.Context, client DynamoDBClient, userID string, page domain.PageRequest) (domain.UserPage, error) {
+	return queryFollowGraphPage(ctx, client, &dynamodb.QueryInput{
+		TableName:              aws.String("UserFollowers"),
+		KeyConditionExpression: aws.String("UserID = :userID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":userID": &types.AttributeValueMemberS{Value: userID},
+		},
+	}, "UserID", userID, "FolloweeID", "FollowingCount", page)
+}
+
+// queryFollowersPage retrieves a page of the users following the given user
+func queryFollowersPage(ctx context.Context, client DynamoDBClient, userID string, page domain.PageRequest) (domain.UserPage, error) {
+	return queryFollowGraphPage(ctx, client, &dynamodb.QueryInput{
+		TableName:              aws.String("UserFollowers"),
+		IndexName:              aws.String(followersIndex),
+		KeyConditionExpression: aws.String("FolloweeID = :userID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":userID": &types.AttributeValueMemberS{Value: userID},
+		},
+	}, "FolloweeID", userID, "UserID", "FollowersCount", page)
+}
+
+// queryFollowGraphPage runs a query over UserFollowers and returns a single
+// page of the given attribute, along with the total number of items read from
+// the given follow count. The cursor holds the last returned user ID, which
+// together with the partition key is the key DynamoDB resumes the query from.
+func queryFollowGraphPage(ctx context.Context, client DynamoDBClient, input *dynamodb.QueryInput, partitionAttribute, partitionValue, attribute, counter string, page domain.PageRequest) (domain.UserPage, error) {
+	count, err := getFollowCount(ctx, client, partitionValue, counter)
+	if err != nil {
+		return domain.UserPage{}, err
+	}
+
+	input.Limit = aws.Int32(int32(page.PageSize()))
+	if page.Cursor != "" {
+		lastUserID, err := domain.DecodeCursorKey(page.Cursor)
+		if err != nil {
+			return domain.UserPage{}, err
+		}
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			partitionAttribute: &types.AttributeValueMemberS{Value: partitionValue},
+			attribute:          &types.AttributeValueMemberS{Value: lastUserID},
+		}
+	}
+
+	result, err := client.Query(ctx, input)
+	if err != nil {
+		return domain.UserPage{}, err
+	}
+
+	userPage := domain.UserPage{UserIDs: []string{}, Count: count}
+	for _, item := range result.Items {
+		if attr, ok := item[attribute].(*types.AttributeValueMemberS); ok {
+			userPage.UserIDs = append(userPage.UserIDs, attr.Value)
+		}
+	}
+
+	if lastKey, ok := result.LastEvaluatedKey[attribute].(*types.AttributeValueMemberS); ok {
+		userPage.NextCursor = domain.EncodeCursor(lastKey.Value)
+	}
+
+	return userPage, nil
+}
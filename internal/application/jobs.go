@@ -0,0 +1,378 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+)
+
+// Work that outgrows a request, like listing a celebrity for every
+// follower, runs as a job of the Jobs table. A job is enqueued in the same
+// transaction as the write that needs it, so it is never lost, and runs in
+// steps of one page each. Every step saves a cursor on the job, so a job
+// that fails, or whose instance stops, is resumed from its last page by any
+// instance. An instance leases the jobs it runs; once a lease expires
+// without being renewed, another instance takes the job over, so steps must
+// be safe to repeat.
+
+var (
+	// jobLease is how long an instance holds a job between two steps before
+	// another instance may take it over
+	jobLease = time.Minute
+
+	// jobPollInterval is how often RunJobs looks for pending jobs when none
+	// were enqueued by this instance
+	jobPollInterval = time.Second
+
+	// jobConcurrency is how many jobs an instance runs at once
+	jobConcurrency = 4
+
+	// jobPageSize is how many items a step of a job handles
+	jobPageSize = 100
+
+	// jobWaitInterval is how long a job that has to wait is left alone
+	// before it is tried again
+	jobWaitInterval = 5 * time.Second
+)
+
+// Kinds of jobs
+const (
+	jobListCelebrity = "list-celebrity"
+	jobFanOut        = "fan-out"
+	jobDeleteTweet   = "delete-tweet"
+)
+
+// errJobWaiting is returned by a step that cannot run yet, like the cleanup
+// of a deleted tweet whose fan-out is still running, or a step reading the
+// followers of a user before their index is built. The job is released and
+// tried again after jobWaitInterval.
+var errJobWaiting = errors.New("waiting for another job")
+
+// job is a unit of background work stored in the Jobs table
+type job struct {
+	ID   string
+	Kind string
+
+	// Data holds what the job works on, like the celebrity to list
+	Data map[string]types.AttributeValue
+
+	// Cursor holds where the next step resumes; it is empty before the
+	// first step
+	Cursor map[string]types.AttributeValue
+
+	// lease is when the lease of the instance running the job expires, in
+	// Unix nanoseconds
+	lease int64
+}
+
+// newJob creates a job, to be enqueued with item
+func (s *DynamoRedisTweetService) newJob(kind string, data map[string]types.AttributeValue) (*job, error) {
+	id, _, err := nextTweetID(s.IDs)
+	if err != nil {
+		return nil, err
+	}
+	return &job{ID: id, Kind: kind, Data: data}, nil
+}
+
+// tweetJob creates a job working on a tweet. A tweet has at most one job of
+// each kind, so the ID of the job derives from the tweet's, and other jobs
+// can look it up.
+func tweetJob(kind string, tweet domain.Tweet) *job {
+	return &job{
+		ID:   tweetJobID(kind, tweet.TweetID),
+		Kind: kind,
+		Data: map[string]types.AttributeValue{
+			"Tweet": &types.AttributeValueMemberM{Value: tweetItem(tweet)},
+		},
+	}
+}
+
+// tweetJobID returns the ID of the job of a kind working on a tweet
+func tweetJobID(kind, tweetID string) string {
+	return kind + ":" + tweetID
+}
+
+// tweet returns the tweet a job created by tweetJob works on
+func (j *job) tweet() (domain.Tweet, error) {
+	item, _ := j.Data["Tweet"].(*types.AttributeValueMemberM)
+	if item == nil {
+		return domain.Tweet{}, fmt.Errorf("%s job without a tweet", j.Kind)
+	}
+	return tweetFromItem(item.Value), nil
+}
+
+// item returns the transaction item enqueueing a job. A new job is not
+// leased, so any instance may run it.
+func (j *job) item() types.TransactWriteItem {
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			TableName: aws.String("Jobs"),
+			Item: map[string]types.AttributeValue{
+				"JobID":      &types.AttributeValueMemberS{Value: j.ID},
+				"Kind":       &types.AttributeValueMemberS{Value: j.Kind},
+				"Data":       &types.AttributeValueMemberM{Value: j.Data},
+				"LeaseUntil": &types.AttributeValueMemberN{Value: "0"},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(JobID)"),
+		},
+	}
+}
+
+// jobFromItem converts a Jobs item into a job
+func jobFromItem(item map[string]types.AttributeValue) *job {
+	j := &job{
+		ID:    stringAttr(item, "JobID"),
+		Kind:  stringAttr(item, "Kind"),
+		lease: numberAttr(item, "LeaseUntil"),
+	}
+	if data, ok := item["Data"].(*types.AttributeValueMemberM); ok {
+		j.Data = data.Value
+	}
+	if cursor, ok := item["Cursor"].(*types.AttributeValueMemberM); ok {
+		j.Cursor = cursor.Value
+	}
+	return j
+}
+
+// wakeJobs tells RunJobs that a job was enqueued, so it does not wait for
+// the next poll
+func (s *DynamoRedisTweetService) wakeJobs() {
+	select {
+	case s.jobsQueued <- struct{}{}:
+	default:
+	}
+}
+
+// RunJobs runs pending jobs until ctx is cancelled. Every instance runs it,
+// so the jobs left behind by an instance that stopped are finished by the
+// others.
+func (s *DynamoRedisTweetService) RunJobs(ctx context.Context) {
+	for {
+		if err := s.runPendingJobs(ctx); err != nil {
+			log.Printf("Failed to look for pending jobs: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.jobsQueued:
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// runPendingJobs runs every job that is not leased by another instance,
+// jobConcurrency at a time, and waits for them
+func (s *DynamoRedisTweetService) runPendingJobs(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	running := make(chan struct{}, max(jobConcurrency, 1))
+
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := s.scanPendingJobs(ctx, startKey)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range result.Items {
+			j := jobFromItem(item)
+			claimed, err := s.claimJob(ctx, j)
+			if err != nil {
+				log.Printf("Failed to claim job %s: %v", j.ID, err)
+				continue
+			}
+			if !claimed {
+				continue
+			}
+
+			running <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-running }()
+				s.runJob(ctx, j)
+			}()
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+// scanPendingJobs reads a page of the jobs whose lease expired
+func (s *DynamoRedisTweetService) scanPendingJobs(ctx context.Context, startKey map[string]types.AttributeValue) (*dynamodb.ScanOutput, error) {
+	ctx, cancel := s.Timeouts.read(ctx)
+	defer cancel()
+
+	return s.DynamoDBClient.Scan(ctx, &dynamodb.ScanInput{
+		TableName:        aws.String("Jobs"),
+		FilterExpression: aws.String("LeaseUntil < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().UnixNano(), 10)},
+		},
+		ExclusiveStartKey: startKey,
+	})
+}
+
+// claimJob leases a job to this instance, unless another instance leased
+// it first
+func (s *DynamoRedisTweetService) claimJob(ctx context.Context, j *job) (bool, error) {
+	ctx, cancel := s.Timeouts.write(ctx)
+	defer cancel()
+
+	now := time.Now().UnixNano()
+	lease := now + int64(jobLease)
+	_, err := s.DynamoDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("Jobs"),
+		Key: map[string]types.AttributeValue{
+			"JobID": &types.AttributeValueMemberS{Value: j.ID},
+		},
+		UpdateExpression:    aws.String("SET LeaseUntil = :lease"),
+		ConditionExpression: aws.String("LeaseUntil < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":lease": &types.AttributeValueMemberN{Value: strconv.FormatInt(lease, 10)},
+			":now":   &types.AttributeValueMemberN{Value: strconv.FormatInt(now, 10)},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		// Leased by another instance, or finished since the scan
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	j.lease = lease
+	return true, nil
+}
+
+// runJob runs the steps of a leased job until it is done. A failed step is
+// logged and left for the lease to expire, so the job is retried from its
+// last cursor later on.
+func (s *DynamoRedisTweetService) runJob(ctx context.Context, j *job) {
+	for ctx.Err() == nil {
+		done, err := s.runJobStep(ctx, j)
+		if errors.Is(err, errJobWaiting) {
+			if err := s.releaseJob(ctx, j); err != nil {
+				log.Printf("Failed to release %s job %s: %v", j.Kind, j.ID, err)
+			}
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to run %s job %s: %v", j.Kind, j.ID, err)
+			return
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// runJobStep runs the next step of a job, bounded by the write timeout, and
+// then saves its cursor, or deletes the job once it is done
+func (s *DynamoRedisTweetService) runJobStep(ctx context.Context, j *job) (bool, error) {
+	ctx, cancel := s.Timeouts.write(ctx)
+	defer cancel()
+
+	var done bool
+	var err error
+	switch j.Kind {
+	case jobListCelebrity:
+		done, err = s.listCelebrityStep(ctx, j)
+	case jobFanOut:
+		done, err = s.fanOutStep(ctx, j)
+	case jobDeleteTweet:
+		done, err = s.deleteTweetStep(ctx, j)
+	default:
+		// Left for an instance that knows the kind, like a newer version
+		// during a deploy
+		return false, fmt.Errorf("unknown kind of job %q", j.Kind)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if done {
+		return true, s.finishJob(ctx, j)
+	}
+	return false, s.saveJob(ctx, j)
+}
+
+// saveJob saves the cursor of a job and renews its lease, as long as this
+// instance still holds it
+func (s *DynamoRedisTweetService) saveJob(ctx context.Context, j *job) error {
+	lease := time.Now().UnixNano() + int64(jobLease)
+	_, err := s.DynamoDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("Jobs"),
+		Key: map[string]types.AttributeValue{
+			"JobID": &types.AttributeValueMemberS{Value: j.ID},
+		},
+		UpdateExpression:    aws.String("SET #cursor = :cursor, LeaseUntil = :lease"),
+		ConditionExpression: aws.String("LeaseUntil = :held"),
+		// CURSOR is a reserved word
+		ExpressionAttributeNames: map[string]string{
+			"#cursor": "Cursor",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":cursor": &types.AttributeValueMemberM{Value: j.Cursor},
+			":lease":  &types.AttributeValueMemberN{Value: strconv.FormatInt(lease, 10)},
+			":held":   &types.AttributeValueMemberN{Value: strconv.FormatInt(j.lease, 10)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	j.lease = lease
+	return nil
+}
+
+// releaseJob cuts the lease of a job short, as long as this instance still
+// holds it, so that any instance may run it again after jobWaitInterval
+func (s *DynamoRedisTweetService) releaseJob(ctx context.Context, j *job) error {
+	ctx, cancel := s.Timeouts.write(ctx)
+	defer cancel()
+
+	lease := time.Now().Add(jobWaitInterval).UnixNano()
+	_, err := s.DynamoDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("Jobs"),
+		Key: map[string]types.AttributeValue{
+			"JobID": &types.AttributeValueMemberS{Value: j.ID},
+		},
+		UpdateExpression:    aws.String("SET LeaseUntil = :lease"),
+		ConditionExpression: aws.String("LeaseUntil = :held"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":lease": &types.AttributeValueMemberN{Value: strconv.FormatInt(lease, 10)},
+			":held":  &types.AttributeValueMemberN{Value: strconv.FormatInt(j.lease, 10)},
+		},
+	})
+	return err
+}
+
+// finishJob deletes a job that is done, as long as this instance still
+// holds it
+func (s *DynamoRedisTweetService) finishJob(ctx context.Context, j *job) error {
+	_, err := s.DynamoDBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("Jobs"),
+		Key: map[string]types.AttributeValue{
+			"JobID": &types.AttributeValueMemberS{Value: j.ID},
+		},
+		ConditionExpression: aws.String("LeaseUntil = :held"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":held": &types.AttributeValueMemberN{Value: strconv.FormatInt(j.lease, 10)},
+		},
+	})
+	return err
+}
@@ -0,0 +1,216 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// jobTable keeps the Jobs table of a MockDynamoDBClient in memory. It
+// understands the conditions the job runner writes with.
+type jobTable struct {
+	mu    sync.Mutex
+	items map[string]map[string]types.AttributeValue
+}
+
+func (t *jobTable) put(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.items == nil {
+		t.items = make(map[string]map[string]types.AttributeValue)
+	}
+	id := stringAttr(input.Item, "JobID")
+	if _, ok := t.items[id]; ok {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	item := make(map[string]types.AttributeValue, len(input.Item))
+	for name, value := range input.Item {
+		item[name] = value
+	}
+	t.items[id] = item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (t *jobTable) get(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return &dynamodb.GetItemOutput{Item: t.items[stringAttr(input.Key, "JobID")]}, nil
+}
+
+func (t *jobTable) update(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	item, ok := t.items[stringAttr(input.Key, "JobID")]
+	if !ok || !t.leaseMatches(item, input.ConditionExpression, input.ExpressionAttributeValues) {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	item["LeaseUntil"] = input.ExpressionAttributeValues[":lease"]
+	if cursor, ok := input.ExpressionAttributeValues[":cursor"]; ok {
+		item["Cursor"] = cursor
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (t *jobTable) delete(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := stringAttr(input.Key, "JobID")
+	item, ok := t.items[id]
+	if !ok || !t.leaseMatches(item, input.ConditionExpression, input.ExpressionAttributeValues) {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	delete(t.items, id)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (t *jobTable) scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var items []map[string]types.AttributeValue
+	for _, item := range t.items {
+		if numberAttr(item, "LeaseUntil") < numberAttr(input.ExpressionAttributeValues, ":now") {
+			items = append(items, item)
+		}
+	}
+	return &dynamodb.ScanOutput{Items: items}, nil
+}
+
+// leaseMatches evaluates the condition on the lease of a job
+func (t *jobTable) leaseMatches(item map[string]types.AttributeValue, condition *string, values map[string]types.AttributeValue) bool {
+	lease := numberAttr(item, "LeaseUntil")
+	switch aws.ToString(condition) {
+	case "LeaseUntil < :now":
+		return lease < numberAttr(values, ":now")
+	case "LeaseUntil = :held":
+		return lease == numberAttr(values, ":held")
+	}
+	return true
+}
+
+// len returns the number of jobs in the table
+func (t *jobTable) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.items)
+}
+
+// runAllJobs runs pending jobs until none are left, including the jobs they
+// enqueue or that wait for one another
+func runAllJobs(t *testing.T, service *DynamoRedisTweetService) {
+	t.Helper()
+	wait := jobWaitInterval
+	defer func() { jobWaitInterval = wait }()
+	jobWaitInterval = 0
+
+	jobs := &service.DynamoDBClient.(*MockDynamoDBClient).jobs
+	for i := 0; i < 10 && jobs.len() > 0; i++ {
+		assert.NoError(t, service.runPendingJobs(context.Background()))
+	}
+	assert.Zero(t, jobs.len())
+}
+
+func TestRunPendingJobs(t *testing.T) {
+	lease := jobLease
+	t.Cleanup(func() { jobLease = lease })
+
+	// Two pages of followers
+	pages := map[string][]string{"": {"1", "2"}, "2": {"3"}}
+	var listedBy []string
+	var listed bool
+	var failures int
+	mockDynamoDBClient := &MockDynamoDBClient{
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			assert.Equal(t, followersIndex, aws.ToString(input.IndexName))
+			page := pages[stringAttr(input.ExclusiveStartKey, "UserID")]
+			output := &dynamodb.QueryOutput{}
+			for _, followerID := range page {
+				output.Items = append(output.Items, map[string]types.AttributeValue{
+					"UserID":     &types.AttributeValueMemberS{Value: followerID},
+					"FolloweeID": &types.AttributeValueMemberS{Value: "star"},
+				})
+			}
+			if _, ok := pages[page[len(page)-1]]; ok {
+				output.LastEvaluatedKey = output.Items[len(output.Items)-1]
+			}
+			return output, nil
+		},
+		UpdateItemFunc: func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			userID := stringAttr(input.Key, "UserID")
+			if userID == "star" {
+				listed = true
+				return &dynamodb.UpdateItemOutput{}, nil
+			}
+			if userID == "3" && failures > 0 {
+				failures--
+				return nil, errors.New("throttled")
+			}
+			listedBy = append(listedBy, userID)
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+	}
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, &MockRedisClient{})
+	service.IDs = fixedIDGenerator{id: 7}
+
+	enqueue := func() {
+		listedBy, listed = nil, false
+		j, err := service.newJob(jobListCelebrity, map[string]types.AttributeValue{
+			"UserID": &types.AttributeValueMemberS{Value: "star"},
+		})
+		assert.NoError(t, err)
+		_, err = mockDynamoDBClient.PutItem(context.Background(), &dynamodb.PutItemInput{
+			TableName: j.item().Put.TableName,
+			Item:      j.item().Put.Item,
+		})
+		assert.NoError(t, err)
+	}
+
+	t.Run("should run a job page by page and delete it once done", func(t *testing.T) {
+		enqueue()
+
+		assert.NoError(t, service.runPendingJobs(context.Background()))
+		assert.Equal(t, []string{"1", "2", "3"}, listedBy)
+		assert.True(t, listed)
+		assert.Zero(t, mockDynamoDBClient.jobs.len())
+	})
+
+	t.Run("should resume a failed job from its last page", func(t *testing.T) {
+		enqueue()
+		failures = 1
+		// The lease of the failed job expires right away
+		jobLease = 0
+
+		assert.NoError(t, service.runPendingJobs(context.Background()))
+		assert.Equal(t, []string{"1", "2"}, listedBy)
+		assert.False(t, listed)
+		assert.Equal(t, 1, mockDynamoDBClient.jobs.len())
+
+		assert.NoError(t, service.runPendingJobs(context.Background()))
+		assert.Equal(t, []string{"1", "2", "3"}, listedBy)
+		assert.True(t, listed)
+		assert.Zero(t, mockDynamoDBClient.jobs.len())
+	})
+
+	t.Run("should leave jobs leased by another instance alone", func(t *testing.T) {
+		jobLease = lease
+		enqueue()
+		leaseUntil := strconv.FormatInt(time.Now().Add(time.Minute).UnixNano(), 10)
+		mockDynamoDBClient.jobs.items["7"]["LeaseUntil"] = &types.AttributeValueMemberN{Value: leaseUntil}
+
+		assert.NoError(t, service.runPendingJobs(context.Background()))
+		assert.Empty(t, listedBy)
+		assert.Equal(t, 1, mockDynamoDBClient.jobs.len())
+	})
+}
@@ -0,0 +1,192 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+)
+
+// Likes are stored in the Likes tweet index, partitioned by the user who
+// liked the tweet, so the likes of a user within a range of tweets take a
+// single query. Like counts live on the Tweets item, updated in the same
+// transaction as the Likes item, and are mirrored to likes:<tweetID> in Redis
+// for cheap reads.
+
+// LikeTweet likes a tweet as the given user. Liking a retweet likes the
+// original tweet, and liking a tweet again has no effect.
+func (s *DynamoRedisTweetService) LikeTweet(ctx context.Context, userID, tweetID string) error {
+	ctx, cancel := s.Timeouts.write(ctx)
+	defer cancel()
+
+	tweet, err := s.GetTweet(ctx, tweetID)
+	if err != nil {
+		return err
+	}
+	tweetID = tweet.OriginalID()
+
+	err = transactWrite(ctx, s.DynamoDBClient, []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				TableName: aws.String("Likes"),
+				Item: map[string]types.AttributeValue{
+					"UserID":  &types.AttributeValueMemberS{Value: userID},
+					"TweetID": &types.AttributeValueMemberN{Value: tweetID},
+					"LikedAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().UnixNano(), 10)},
+				},
+				ConditionExpression: aws.String("attribute_not_exists(UserID)"),
+			},
+		},
+		{Update: counterUpdate(tweetID, "LikeCount", 1)},
+	})
+	switch {
+	case cancellationReason(err, 0) == "ConditionalCheckFailed":
+		// Already liked
+		return nil
+	case cancellationReason(err, 1) == "ConditionalCheckFailed":
+		// Deleted since it was read
+		return domain.ErrTweetNotFound
+	case err != nil:
+		return err
+	}
+
+	s.incrementCachedCounter(ctx, tweetID, "LikeCount", 1)
+	return nil
+}
+
+// UnlikeTweet removes the like of the given user from a tweet. Unliking a
+// tweet that is not liked has no effect.
+func (s *DynamoRedisTweetService) UnlikeTweet(ctx context.Context, userID, tweetID string) error {
+	ctx, cancel := s.Timeouts.write(ctx)
+	defer cancel()
+
+	tweet, err := s.GetTweet(ctx, tweetID)
+	if err == nil {
+		tweetID = tweet.OriginalID()
+	} else if !errors.Is(err, domain.ErrTweetNotFound) {
+		return err
+	}
+	if _, err := strconv.ParseInt(tweetID, 10, 64); err != nil {
+		return domain.ErrInvalidTweetID
+	}
+
+	items := []types.TransactWriteItem{
+		{
+			Delete: &types.Delete{
+				TableName: aws.String("Likes"),
+				Key: map[string]types.AttributeValue{
+					"UserID":  &types.AttributeValueMemberS{Value: userID},
+					"TweetID": &types.AttributeValueMemberN{Value: tweetID},
+				},
+				ConditionExpression: aws.String("attribute_exists(UserID)"),
+			},
+		},
+		{Update: counterUpdate(tweetID, "LikeCount", -1)},
+	}
+	err = transactWrite(ctx, s.DynamoDBClient, items)
+	if cancellationReason(err, 0) != "ConditionalCheckFailed" && cancellationReason(err, 1) == "ConditionalCheckFailed" {
+		// The tweet was deleted, so there is no count left to update
+		err = transactWrite(ctx, s.DynamoDBClient, items[:1])
+	}
+	if cancellationReason(err, 0) == "ConditionalCheckFailed" {
+		// Not liked
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	s.incrementCachedCounter(ctx, tweetID, "LikeCount", -1)
+	return nil
+}
+
+// GetLikedTweets retrieves a page of the tweets liked by a user, newest
+// tweets first
+func (s *DynamoRedisTweetService) GetLikedTweets(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error) {
+	ctx, cancel := s.Timeouts.read(ctx)
+	defer cancel()
+
+	return s.queryTweetIndex(ctx, "Likes", "UserID", userID, userID, page)
+}
+
+// addLikes fills in the current counts of tweets and whether the viewer
+// liked them, unless there is no viewer. Retweets show the likes of the
+// original tweet. Timelines hold copies of the tweets, so the counts are
+// read from the cached counts.
+func (s *DynamoRedisTweetService) addLikes(ctx context.Context, viewerID string, tweets []domain.Tweet) error {
+	if len(tweets) == 0 {
+		return nil
+	}
+
+	if err := s.addCounts(ctx, tweets); err != nil {
+		return err
+	}
+
+	liked := make(map[string]bool)
+	if viewerID != "" {
+		var err error
+		liked, err = s.getLikedTweetIDs(ctx, viewerID, tweets)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range tweets {
+		tweets[i].Liked = liked[tweets[i].OriginalID()]
+	}
+	return nil
+}
+
+// getLikedTweetIDs returns which of the given tweets a user liked, querying
+// the user's likes between the oldest and newest of them
+func (s *DynamoRedisTweetService) getLikedTweetIDs(ctx context.Context, userID string, tweets []domain.Tweet) (map[string]bool, error) {
+	var minID, maxID int64
+	for _, tweet := range tweets {
+		id, err := strconv.ParseInt(tweet.OriginalID(), 10, 64)
+		if err != nil {
+			continue
+		}
+		if minID == 0 || id < minID {
+			minID = id
+		}
+		if id > maxID {
+			maxID = id
+		}
+	}
+
+	liked := make(map[string]bool)
+	if maxID == 0 {
+		return liked, nil
+	}
+
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := s.DynamoDBClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String("Likes"),
+			KeyConditionExpression: aws.String("UserID = :userID AND TweetID BETWEEN :minID AND :maxID"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":userID": &types.AttributeValueMemberS{Value: userID},
+				":minID":  &types.AttributeValueMemberN{Value: strconv.FormatInt(minID, 10)},
+				":maxID":  &types.AttributeValueMemberN{Value: strconv.FormatInt(maxID, 10)},
+			},
+			ProjectionExpression: aws.String("TweetID"),
+			ExclusiveStartKey:    startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Items {
+			liked[strconv.FormatInt(numberAttr(item, "TweetID"), 10)] = true
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return liked, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
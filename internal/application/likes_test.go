@@ -0,0 +1,209 @@
+package application
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLikes(t *testing.T) {
+	tweets := map[string]map[string]types.AttributeValue{}
+	for _, id := range []string{"10", "20", "30"} {
+		tweets[id] = tweetItem(domain.Tweet{TweetID: id, UserID: "2", Content: "Tweet " + id, Timestamp: 1, Type: domain.TweetTypeOriginal})
+	}
+	likes := map[string]map[int64]bool{}
+	mockDynamoDBClient := &MockDynamoDBClient{
+		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			if *input.TableName != "Tweets" {
+				return &dynamodb.GetItemOutput{}, nil
+			}
+			return &dynamodb.GetItemOutput{Item: tweets[input.Key["TweetID"].(*types.AttributeValueMemberS).Value]}, nil
+		},
+		PutItemFunc: func(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			userID := input.Item["UserID"].(*types.AttributeValueMemberS).Value
+			tweetID := numberAttr(input.Item, "TweetID")
+			if likes[userID][tweetID] {
+				return nil, &types.ConditionalCheckFailedException{}
+			}
+			if likes[userID] == nil {
+				likes[userID] = map[int64]bool{}
+			}
+			likes[userID][tweetID] = true
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		DeleteItemFunc: func(ctx context.Context, input *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+			userID := input.Key["UserID"].(*types.AttributeValueMemberS).Value
+			tweetID := numberAttr(input.Key, "TweetID")
+			if !likes[userID][tweetID] {
+				return nil, &types.ConditionalCheckFailedException{}
+			}
+			delete(likes[userID], tweetID)
+			return &dynamodb.DeleteItemOutput{}, nil
+		},
+		UpdateItemFunc: func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			item, ok := tweets[input.Key["TweetID"].(*types.AttributeValueMemberS).Value]
+			if !ok {
+				return nil, &types.ConditionalCheckFailedException{}
+			}
+			delta, _ := strconv.ParseInt(input.ExpressionAttributeValues[":delta"].(*types.AttributeValueMemberN).Value, 10, 64)
+			count := &types.AttributeValueMemberN{Value: strconv.FormatInt(numberAttr(item, "LikeCount")+delta, 10)}
+			item["LikeCount"] = count
+			return &dynamodb.UpdateItemOutput{Attributes: map[string]types.AttributeValue{"LikeCount": count}}, nil
+		},
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			switch *input.TableName {
+			case "Likes":
+				userID := input.ExpressionAttributeValues[":key"]
+				if userID == nil {
+					userID = input.ExpressionAttributeValues[":userID"]
+				}
+				minID := numberAttr(input.ExpressionAttributeValues, ":minID")
+				maxID := numberAttr(input.ExpressionAttributeValues, ":maxID")
+				var ids []int64
+				for id := range likes[userID.(*types.AttributeValueMemberS).Value] {
+					if id >= minID && id <= maxID {
+						ids = append(ids, id)
+					}
+				}
+				sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+				if input.Limit != nil && len(ids) > int(*input.Limit) {
+					ids = ids[:*input.Limit]
+				}
+				var items []map[string]types.AttributeValue
+				for _, id := range ids {
+					items = append(items, map[string]types.AttributeValue{
+						"UserID":  userID,
+						"TweetID": &types.AttributeValueMemberN{Value: strconv.FormatInt(id, 10)},
+					})
+				}
+				return &dynamodb.QueryOutput{Items: items}, nil
+			case "HomeTimelines":
+				var items []map[string]types.AttributeValue
+				for _, id := range []string{"30", "20", "10"} {
+					items = append(items, homeTimelineItem("1", tweetFromItem(tweets[id])))
+				}
+				return &dynamodb.QueryOutput{Items: items}, nil
+			}
+			return &dynamodb.QueryOutput{}, nil
+		},
+	}
+	cache := map[string]string{}
+	mockRedisClient := &MockRedisClient{
+		GetFunc: func(ctx context.Context, key string) *redis.StringCmd {
+			return redis.NewStringResult("", redis.Nil)
+		},
+		SetFunc: func(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+			cache[key] = redisValue(value)
+			return redis.NewStatusResult("OK", nil)
+		},
+		DelFunc: func(ctx context.Context, keys ...string) *redis.IntCmd {
+			for _, key := range keys {
+				delete(cache, key)
+			}
+			return redis.NewIntResult(int64(len(keys)), nil)
+		},
+		MGetFunc: func(ctx context.Context, keys ...string) *redis.SliceCmd {
+			values := make([]interface{}, len(keys))
+			for i, key := range keys {
+				if value, ok := cache[key]; ok {
+					values[i] = value
+				}
+			}
+			return redis.NewSliceResult(values, nil)
+		},
+		EvalFunc: func(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+			assert.Equal(t, incrementIfCached, script)
+			value, ok := cache[keys[0]]
+			if !ok {
+				return redis.NewCmdResult(nil, redis.Nil)
+			}
+			count, _ := strconv.ParseInt(value, 10, 64)
+			count += int64(args[0].(int))
+			cache[keys[0]] = strconv.FormatInt(count, 10)
+			return redis.NewCmdResult(count, nil)
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, mockRedisClient)
+
+	t.Run("should count each like once", func(t *testing.T) {
+		assert.NoError(t, service.LikeTweet(context.Background(), "1", "20"))
+		assert.NoError(t, service.LikeTweet(context.Background(), "1", "20"))
+		assert.NoError(t, service.LikeTweet(context.Background(), "3", "20"))
+
+		tweet, err := service.GetTweet(context.Background(), "20")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), tweet.LikeCount)
+		assert.Equal(t, "2", cache["likes:20"])
+		assert.Equal(t, int64(2), numberAttr(tweets["20"], "LikeCount"))
+	})
+
+	t.Run("should update the cached count instead of the cached tweet", func(t *testing.T) {
+		cached := cache[tweetCacheKey("20")]
+		assert.NoError(t, service.LikeTweet(context.Background(), "4", "20"))
+
+		assert.Equal(t, "3", cache["likes:20"])
+		assert.Equal(t, cached, cache[tweetCacheKey("20")])
+
+		assert.NoError(t, service.UnlikeTweet(context.Background(), "4", "20"))
+		assert.Equal(t, "2", cache["likes:20"])
+	})
+
+	t.Run("should not like a missing tweet", func(t *testing.T) {
+		assert.Equal(t, domain.ErrTweetNotFound, service.LikeTweet(context.Background(), "1", "404"))
+	})
+
+	t.Run("should flag the tweets the viewer liked in the timeline", func(t *testing.T) {
+		page, err := service.GetTimeline(context.Background(), "1", domain.PageRequest{})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 3)
+		for _, tweet := range page.Tweets {
+			assert.Equal(t, tweet.TweetID == "20", tweet.Liked, tweet.TweetID)
+		}
+		assert.Equal(t, int64(2), page.Tweets[1].LikeCount)
+	})
+
+	t.Run("should list liked tweets newest first", func(t *testing.T) {
+		assert.NoError(t, service.LikeTweet(context.Background(), "1", "10"))
+		assert.NoError(t, service.LikeTweet(context.Background(), "1", "30"))
+
+		page, err := service.GetLikedTweets(context.Background(), "1", domain.PageRequest{Limit: 2})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 2)
+		assert.Equal(t, "30", page.Tweets[0].TweetID)
+		assert.Equal(t, "20", page.Tweets[1].TweetID)
+		assert.True(t, page.Tweets[0].Liked)
+
+		page, err = service.GetLikedTweets(context.Background(), "1", domain.PageRequest{Limit: 2, Cursor: page.NextCursor})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 1)
+		assert.Equal(t, "10", page.Tweets[0].TweetID)
+		assert.Empty(t, page.NextCursor)
+	})
+
+	t.Run("should unlike idempotently", func(t *testing.T) {
+		assert.NoError(t, service.UnlikeTweet(context.Background(), "1", "20"))
+		assert.NoError(t, service.UnlikeTweet(context.Background(), "1", "20"))
+
+		tweet, err := service.GetTweet(context.Background(), "20")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), tweet.LikeCount)
+
+		// The cached tweet read by the timeline is invalidated too
+		page, err := service.GetTimeline(context.Background(), "1", domain.PageRequest{})
+		assert.NoError(t, err)
+		for _, tweet := range page.Tweets {
+			if tweet.TweetID == "20" {
+				assert.Equal(t, int64(1), tweet.LikeCount)
+			}
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package application
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordCost is the bcrypt cost passwords are hashed with
+var PasswordCost = bcrypt.DefaultCost
+
+// hashPassword returns the bcrypt hash stored for a password
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// dummyPasswordHash is compared against when a handle does not exist, so
+// logging in takes as long for unknown handles as for wrong passwords
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+
+// checkPassword reports whether a password matches a stored hash. An empty
+// hash, for an unknown user, never matches.
+func checkPassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
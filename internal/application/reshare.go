@@ -0,0 +1,95 @@
+package application
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+)
+
+// Retweet reshares a tweet as the given user. Retweeting a retweet reshares
+// the original tweet, and each user can retweet a tweet only once.
+func (s *DynamoRedisTweetService) Retweet(ctx context.Context, userID, tweetID string) (string, error) {
+	ctx, cancel := s.Timeouts.write(ctx)
+	defer cancel()
+
+	original, err := s.GetTweet(ctx, tweetID)
+	if err != nil {
+		return "", err
+	}
+	if original.IsRetweet() {
+		original, err = s.GetTweet(ctx, original.RetweetOfID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	retweetID, id, err := nextTweetID(s.IDs)
+	if err != nil {
+		return "", err
+	}
+
+	// The Retweets table holds a single retweet per user and tweet. The
+	// marker and the count commit along with the retweet, so a failed
+	// retweet never leaves the user unable to retweet again, and the count
+	// fails the retweet if the original was deleted in the meantime, whose
+	// cleanup could miss it.
+	err = s.publishTweet(ctx, domain.Tweet{
+		TweetID:     retweetID,
+		UserID:      userID,
+		Content:     original.Content,
+		Timestamp:   tweetTimestamp(id),
+		Type:        domain.TweetTypeRetweet,
+		RetweetOfID: original.TweetID,
+	}, types.TransactWriteItem{
+		Put: &types.Put{
+			TableName: aws.String("Retweets"),
+			Item: map[string]types.AttributeValue{
+				"TweetID":   &types.AttributeValueMemberS{Value: original.TweetID},
+				"UserID":    &types.AttributeValueMemberS{Value: userID},
+				"RetweetID": &types.AttributeValueMemberS{Value: retweetID},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(UserID)"),
+		},
+	}, types.TransactWriteItem{
+		Update: counterUpdate(original.TweetID, "RetweetCount", 1),
+	})
+	switch {
+	case cancellationReason(err, publishedItems) == "ConditionalCheckFailed":
+		return "", domain.ErrAlreadyRetweeted
+	case cancellationReason(err, publishedItems+1) == "ConditionalCheckFailed":
+		return "", domain.ErrTweetNotFound
+	case err != nil:
+		return "", err
+	}
+
+	s.incrementCachedCounter(ctx, original.TweetID, "RetweetCount", 1)
+	return retweetID, nil
+}
+
+// incrementCounter atomically adds delta to a counter of a tweet, and to its
+// cached copy. Counters of deleted tweets are left alone.
+func (s *DynamoRedisTweetService) incrementCounter(ctx context.Context, tweetID, counter string, delta int) error {
+	update := counterUpdate(tweetID, counter, delta)
+	_, err := s.DynamoDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 update.TableName,
+		Key:                       update.Key,
+		UpdateExpression:          update.UpdateExpression,
+		ConditionExpression:       update.ConditionExpression,
+		ExpressionAttributeNames:  update.ExpressionAttributeNames,
+		ExpressionAttributeValues: update.ExpressionAttributeValues,
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return nil
+		}
+		return err
+	}
+
+	s.incrementCachedCounter(ctx, tweetID, counter, delta)
+	return nil
+}
@@ -0,0 +1,214 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReshares(t *testing.T) {
+	tweets := map[string]map[string]types.AttributeValue{}
+	retweets := map[string]string{}
+	var putErr error
+	var homeTimeline []map[string]types.AttributeValue
+	mockDynamoDBClient := &MockDynamoDBClient{
+		PutItemFunc: func(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			switch *input.TableName {
+			case "Tweets":
+				tweets[input.Item["TweetID"].(*types.AttributeValueMemberS).Value] = input.Item
+			case "Retweets":
+				key := input.Item["TweetID"].(*types.AttributeValueMemberS).Value + "/" + input.Item["UserID"].(*types.AttributeValueMemberS).Value
+				if _, ok := retweets[key]; ok {
+					return nil, &types.ConditionalCheckFailedException{}
+				}
+				if putErr != nil {
+					return nil, putErr
+				}
+				retweets[key] = input.Item["RetweetID"].(*types.AttributeValueMemberS).Value
+			case "HomeTimelines":
+				if input.Item["UserID"].(*types.AttributeValueMemberS).Value == "3" {
+					homeTimeline = append([]map[string]types.AttributeValue{input.Item}, homeTimeline...)
+				}
+			}
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			if *input.TableName != "Tweets" {
+				return &dynamodb.GetItemOutput{}, nil
+			}
+			return &dynamodb.GetItemOutput{Item: tweets[input.Key["TweetID"].(*types.AttributeValueMemberS).Value]}, nil
+		},
+		UpdateItemFunc: func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			if aws.ToString(input.UpdateExpression) == "SET Deleted = :true" {
+				return markDeletedItem(tweets, input)
+			}
+			if *input.TableName == "Tweets" {
+				item, ok := tweets[input.Key["TweetID"].(*types.AttributeValueMemberS).Value]
+				if !ok || isDeletedItem(item) {
+					return nil, &types.ConditionalCheckFailedException{}
+				}
+				counter := input.ExpressionAttributeNames["#counter"]
+				delta, _ := strconv.ParseInt(input.ExpressionAttributeValues[":delta"].(*types.AttributeValueMemberN).Value, 10, 64)
+				item[counter] = &types.AttributeValueMemberN{Value: strconv.FormatInt(numberAttr(item, counter)+delta, 10)}
+			}
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+		DeleteItemFunc: func(ctx context.Context, input *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+			switch *input.TableName {
+			case "Tweets":
+				delete(tweets, input.Key["TweetID"].(*types.AttributeValueMemberS).Value)
+			case "Retweets":
+				delete(retweets, input.Key["TweetID"].(*types.AttributeValueMemberS).Value+"/"+input.Key["UserID"].(*types.AttributeValueMemberS).Value)
+			}
+			return &dynamodb.DeleteItemOutput{}, nil
+		},
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			switch {
+			case *input.TableName == "HomeTimelines":
+				return &dynamodb.QueryOutput{Items: homeTimeline}, nil
+			case *input.TableName == "Retweets":
+				tweetID := input.ExpressionAttributeValues[":tweetID"].(*types.AttributeValueMemberS).Value
+				var items []map[string]types.AttributeValue
+				for key, retweetID := range retweets {
+					if strings.HasPrefix(key, tweetID+"/") {
+						items = append(items, map[string]types.AttributeValue{
+							"TweetID":   &types.AttributeValueMemberS{Value: tweetID},
+							"UserID":    &types.AttributeValueMemberS{Value: strings.TrimPrefix(key, tweetID+"/")},
+							"RetweetID": &types.AttributeValueMemberS{Value: retweetID},
+						})
+					}
+				}
+				return &dynamodb.QueryOutput{Items: items}, nil
+			case input.IndexName != nil && *input.IndexName == followersIndex:
+				// User 3 follows everyone
+				return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{
+					{"UserID": &types.AttributeValueMemberS{Value: "3"}},
+				}}, nil
+			}
+			return &dynamodb.QueryOutput{}, nil
+		},
+	}
+	mockRedisClient := &MockRedisClient{
+		GetFunc: func(ctx context.Context, key string) *redis.StringCmd {
+			return redis.NewStringResult("", redis.Nil)
+		},
+		SetFunc: func(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+			return redis.NewStatusResult("", nil)
+		},
+		DelFunc: func(ctx context.Context, keys ...string) *redis.IntCmd {
+			return redis.NewIntResult(int64(len(keys)), nil)
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, mockRedisClient)
+	service.CelebrityThreshold = 0
+
+	originalID, err := service.PostTweet(context.Background(), "1", "Original")
+	assert.NoError(t, err)
+	retweetID, err := service.Retweet(context.Background(), "2", originalID)
+	assert.NoError(t, err)
+
+	t.Run("should attribute retweets to the resharer", func(t *testing.T) {
+		retweet, err := service.GetTweet(context.Background(), retweetID)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.TweetTypeRetweet, retweet.Type)
+		assert.Equal(t, "2", retweet.UserID)
+		assert.Equal(t, originalID, retweet.RetweetOfID)
+		assert.Equal(t, "Original", retweet.Content)
+	})
+
+	t.Run("should count reshares on the original", func(t *testing.T) {
+		_, err := service.PostTweet(context.Background(), "2", "Look at this", domain.Quoting(originalID))
+		assert.NoError(t, err)
+
+		original, err := service.GetTweet(context.Background(), originalID)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), original.RetweetCount)
+		assert.Equal(t, int64(1), original.QuoteCount)
+	})
+
+	t.Run("should not retweet a tweet twice", func(t *testing.T) {
+		_, err := service.Retweet(context.Background(), "2", originalID)
+		assert.Equal(t, domain.ErrAlreadyRetweeted, err)
+
+		_, err = service.Retweet(context.Background(), "2", retweetID)
+		assert.Equal(t, domain.ErrAlreadyRetweeted, err)
+	})
+
+	t.Run("should not quote a missing tweet", func(t *testing.T) {
+		_, err := service.PostTweet(context.Background(), "2", "Look at this", domain.Quoting("404"))
+		assert.Equal(t, domain.ErrQuotedNotFound, err)
+	})
+
+	t.Run("should hide retweets of tweets already in the timeline", func(t *testing.T) {
+		runAllJobs(t, service)
+
+		page, err := service.GetTimeline(context.Background(), "3", domain.PageRequest{})
+		assert.NoError(t, err)
+
+		var tweetIDs []string
+		for _, tweet := range page.Tweets {
+			tweetIDs = append(tweetIDs, tweet.TweetID)
+			assert.False(t, tweet.IsRetweet())
+		}
+		assert.Contains(t, tweetIDs, originalID)
+		assert.Len(t, tweetIDs, 2)
+	})
+
+	t.Run("should undo the retweet when it is deleted", func(t *testing.T) {
+		err := service.DeleteTweet(context.Background(), "2", retweetID)
+		assert.NoError(t, err)
+		runAllJobs(t, service)
+
+		original, err := service.GetTweet(context.Background(), originalID)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), original.RetweetCount)
+
+		_, err = service.Retweet(context.Background(), "2", originalID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should let the user retweet again after a failed retweet", func(t *testing.T) {
+		tweetID, err := service.PostTweet(context.Background(), "1", "Try again")
+		assert.NoError(t, err)
+
+		putErr = errors.New("throttled")
+		_, err = service.Retweet(context.Background(), "2", tweetID)
+		putErr = nil
+		assert.Error(t, err)
+
+		_, err = service.Retweet(context.Background(), "2", tweetID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should delete the retweets of a deleted tweet", func(t *testing.T) {
+		tweetID, err := service.PostTweet(context.Background(), "1", "Soon gone")
+		assert.NoError(t, err)
+		retweetID, err := service.Retweet(context.Background(), "2", tweetID)
+		assert.NoError(t, err)
+
+		err = service.DeleteTweet(context.Background(), "1", tweetID)
+		assert.NoError(t, err)
+
+		// Nobody can retweet it while its retweets are cleaned up
+		_, err = service.Retweet(context.Background(), "3", retweetID)
+		assert.Equal(t, domain.ErrTweetNotFound, err)
+
+		runAllJobs(t, service)
+		_, err = service.GetTweet(context.Background(), retweetID)
+		assert.Equal(t, domain.ErrTweetNotFound, err)
+		assert.NotContains(t, retweets, tweetID+"/2")
+		assert.NotContains(t, tweets, retweetID)
+		assert.NotContains(t, tweets, tweetID)
+	})
+}
@@ -0,0 +1,39 @@
+package application
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts bound how long a service operation may take, on top of any
+// deadline of the caller, so a slow backend cannot hold a request forever.
+// Reads and writes have separate budgets; zero disables a timeout.
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+}
+
+// DefaultTimeouts are the timeouts services are created with
+var DefaultTimeouts = Timeouts{
+	Read:  2 * time.Second,
+	Write: 5 * time.Second,
+}
+
+// read returns a context for a read operation, bounded by the read timeout
+func (t Timeouts) read(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.Read)
+}
+
+// write returns a context for a write operation, bounded by the write
+// timeout
+func (t Timeouts) write(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.Write)
+}
+
+// withTimeout returns a context that is done after timeout, or when ctx is
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
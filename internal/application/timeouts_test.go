@@ -0,0 +1,122 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingDynamoDBClient returns a client whose calls block until their
+// context is done, like a backend that never answers
+func blockingDynamoDBClient(started chan<- struct{}) *MockDynamoDBClient {
+	block := func(ctx context.Context) error {
+		if started != nil {
+			started <- struct{}{}
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return &MockDynamoDBClient{
+		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return nil, block(ctx)
+		},
+		PutItemFunc: func(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			return nil, block(ctx)
+		},
+	}
+}
+
+// missingRedisClient returns a cache that never has the key asked for
+func missingRedisClient() *MockRedisClient {
+	return &MockRedisClient{
+		GetFunc: func(ctx context.Context, key string) *redis.StringCmd {
+			return redis.NewStringResult("", redis.Nil)
+		},
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	t.Run("should abort an in-flight read when the request is cancelled", func(t *testing.T) {
+		started := make(chan struct{}, 1)
+		service := NewDynamoRedisTweetService(blockingDynamoDBClient(started), missingRedisClient())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+
+		_, err := service.GetTweet(ctx, "1")
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("should abort an in-flight write when the request is cancelled", func(t *testing.T) {
+		started := make(chan struct{}, 1)
+		service := NewDynamoDBUserService(blockingDynamoDBClient(started), &MockRedisClient{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+
+		err := service.FollowUser(ctx, "1", "2")
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("should give up on a read after the read timeout", func(t *testing.T) {
+		service := NewDynamoRedisTweetService(blockingDynamoDBClient(nil), missingRedisClient())
+		service.Timeouts = Timeouts{Read: 10 * time.Millisecond, Write: time.Hour}
+
+		start := time.Now()
+		_, err := service.GetTweet(context.Background(), "1")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("should give up on a write after the write timeout", func(t *testing.T) {
+		service := NewDynamoDBUserService(blockingDynamoDBClient(nil), &MockRedisClient{})
+		service.Timeouts = Timeouts{Read: time.Hour, Write: 10 * time.Millisecond}
+
+		err := service.FollowUser(context.Background(), "1", "2")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("should not set a deadline when the timeout is zero", func(t *testing.T) {
+		var hasDeadline bool
+		client := &MockDynamoDBClient{
+			GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				_, hasDeadline = ctx.Deadline()
+				return &dynamodb.GetItemOutput{}, nil
+			},
+		}
+		service := NewDynamoRedisTweetService(client, missingRedisClient())
+		service.Timeouts = Timeouts{}
+
+		_, err := service.GetTweet(context.Background(), "1")
+		assert.Error(t, err)
+		assert.False(t, hasDeadline)
+	})
+
+	t.Run("should keep an earlier deadline of the caller", func(t *testing.T) {
+		var deadline time.Time
+		client := &MockDynamoDBClient{
+			GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+				deadline, _ = ctx.Deadline()
+				return &dynamodb.GetItemOutput{}, nil
+			},
+		}
+		service := NewDynamoRedisTweetService(client, missingRedisClient())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+		defer cancel()
+		want, _ := ctx.Deadline()
+
+		service.GetTweet(ctx, "1")
+		assert.Equal(t, want, deadline)
+	})
+}
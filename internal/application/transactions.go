@@ -0,0 +1,108 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	// transactionAttempts is how many times a transaction is tried while it
+	// keeps conflicting with other writes
+	transactionAttempts = 3
+
+	// transactionBackoff is how long to wait before retrying a conflicting
+	// transaction, doubled on every retry
+	transactionBackoff = 25 * time.Millisecond
+
+	// followUpAttempts is how many times a step that follows a committed
+	// transaction is tried
+	followUpAttempts = 3
+)
+
+// transactWrite commits items atomically in a single DynamoDB transaction.
+// A transaction cancelled only because it conflicted with another write to
+// the same items is retried with exponential backoff; any other cancellation
+// is returned.
+func transactWrite(ctx context.Context, client DynamoDBClient, items []types.TransactWriteItem) error {
+	backoff := transactionBackoff
+	for attempt := 1; ; attempt++ {
+		_, err := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: items,
+		})
+		if err == nil || attempt >= transactionAttempts || !isTransactionConflict(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// isTransactionConflict reports whether a transaction was cancelled only
+// because it conflicted with another write
+func isTransactionConflict(err error) bool {
+	var cancelled *types.TransactionCanceledException
+	if !errors.As(err, &cancelled) {
+		return false
+	}
+
+	conflict := false
+	for _, reason := range cancelled.CancellationReasons {
+		switch aws.ToString(reason.Code) {
+		case "", "None":
+		case "TransactionConflict":
+			conflict = true
+		default:
+			return false
+		}
+	}
+	return conflict
+}
+
+// cancellationReason returns why the item at index was rejected when err is
+// a cancelled transaction, like "ConditionalCheckFailed", or "" otherwise
+func cancellationReason(err error, index int) string {
+	var cancelled *types.TransactionCanceledException
+	if !errors.As(err, &cancelled) || index >= len(cancelled.CancellationReasons) {
+		return ""
+	}
+	return aws.ToString(cancelled.CancellationReasons[index].Code)
+}
+
+// afterCommit runs a step that follows a committed transaction, like fanning
+// out the tweet it stored. The transaction already succeeded, so a failing
+// step is retried with backoff and then logged instead of failing the
+// request; steps must be safe to repeat. The step runs to the end even if
+// the caller gives up on the request.
+func (s *DynamoRedisTweetService) afterCommit(ctx context.Context, step, tweetID string, fn func(context.Context) error) {
+	ctx, cancel := s.Timeouts.write(context.WithoutCancel(ctx))
+	defer cancel()
+
+	backoff := transactionBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return
+		}
+		if attempt >= followUpAttempts || ctx.Err() != nil {
+			log.Printf("Failed to %s tweet %s: %v", step, tweetID, err)
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,197 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// transactionCanceled returns the error of a transaction cancelled for the
+// given reasons, one per item
+func transactionCanceled(codes ...string) error {
+	reasons := make([]types.CancellationReason, len(codes))
+	for i, code := range codes {
+		reasons[i].Code = aws.String(code)
+	}
+	return &types.TransactionCanceledException{CancellationReasons: reasons}
+}
+
+func TestPostTweetTransaction(t *testing.T) {
+	backoff := transactionBackoff
+	transactionBackoff = time.Millisecond
+	t.Cleanup(func() { transactionBackoff = backoff })
+
+	var transactions [][]types.TransactWriteItem
+	var puts []string
+	var putErr error
+	var transactErrs []error
+	var mockDynamoDBClient *MockDynamoDBClient
+	mockDynamoDBClient = &MockDynamoDBClient{
+		TransactWriteItemsFunc: func(ctx context.Context, input *dynamodb.TransactWriteItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			transactions = append(transactions, input.TransactItems)
+			if len(transactErrs) > 0 {
+				err := transactErrs[0]
+				transactErrs = transactErrs[1:]
+				return nil, err
+			}
+			// Enqueue the jobs of the transaction
+			for _, item := range input.TransactItems {
+				if item.Put != nil && aws.ToString(item.Put.TableName) == "Jobs" {
+					mockDynamoDBClient.jobs.put(&dynamodb.PutItemInput{TableName: item.Put.TableName, Item: item.Put.Item})
+				}
+			}
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+		PutItemFunc: func(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			puts = append(puts, aws.ToString(input.TableName)+":"+input.Item["UserID"].(*types.AttributeValueMemberS).Value)
+			if putErr != nil {
+				return nil, putErr
+			}
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			// The author has a single follower
+			return &dynamodb.QueryOutput{
+				Items: []map[string]types.AttributeValue{
+					{
+						"UserID":     &types.AttributeValueMemberS{Value: "2"},
+						"FolloweeID": &types.AttributeValueMemberS{Value: "1"},
+					},
+				},
+			}, nil
+		},
+	}
+	mockRedisClient := &MockRedisClient{
+		GetFunc: func(ctx context.Context, key string) *redis.StringCmd {
+			return redis.NewStringResult("", redis.Nil)
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, mockRedisClient)
+	reset := func(errs ...error) {
+		transactions, puts, putErr, transactErrs = nil, nil, nil, errs
+		mockDynamoDBClient.jobs.items = nil
+	}
+
+	t.Run("should commit the tweet and the author's timeline in one transaction", func(t *testing.T) {
+		reset()
+		tweetID, err := service.PostTweet(context.Background(), "1", "Hello World")
+		assert.NoError(t, err)
+
+		assert.Len(t, transactions, 1)
+		items := transactions[0]
+		assert.Len(t, items, 3)
+		assert.Equal(t, "Tweets", aws.ToString(items[0].Put.TableName))
+		assert.Equal(t, tweetID, items[0].Put.Item["TweetID"].(*types.AttributeValueMemberS).Value)
+		assert.Equal(t, "attribute_not_exists(TweetID)", aws.ToString(items[0].Put.ConditionExpression))
+		assert.Equal(t, "HomeTimelines", aws.ToString(items[1].Put.TableName))
+		assert.Equal(t, "1", items[1].Put.Item["UserID"].(*types.AttributeValueMemberS).Value)
+
+		// The fan-out is enqueued along with the tweet
+		assert.Equal(t, "Jobs", aws.ToString(items[2].Put.TableName))
+		assert.Equal(t, jobFanOut, items[2].Put.Item["Kind"].(*types.AttributeValueMemberS).Value)
+		assert.Empty(t, puts)
+
+		// Only the follower's home timeline is written by the job
+		assert.NoError(t, service.runPendingJobs(context.Background()))
+		assert.Equal(t, []string{"HomeTimelines:2"}, puts)
+	})
+
+	t.Run("should write nothing else when the transaction fails", func(t *testing.T) {
+		reset(errors.New("connection reset"))
+		_, err := service.PostTweet(context.Background(), "1", "Hello World")
+		assert.Error(t, err)
+		assert.Len(t, transactions, 1)
+		assert.Empty(t, puts)
+		assert.Zero(t, mockDynamoDBClient.jobs.len())
+	})
+
+	t.Run("should keep the fan-out job until it succeeds", func(t *testing.T) {
+		lease := jobLease
+		jobLease = 0
+		defer func() { jobLease = lease }()
+
+		reset()
+		putErr = errors.New("connection reset")
+		tweetID, err := service.PostTweet(context.Background(), "1", "Hello World")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, tweetID)
+
+		assert.NoError(t, service.runPendingJobs(context.Background()))
+		assert.Len(t, puts, 1)
+		assert.Equal(t, 1, mockDynamoDBClient.jobs.len())
+
+		putErr = nil
+		assert.NoError(t, service.runPendingJobs(context.Background()))
+		assert.Equal(t, []string{"HomeTimelines:2", "HomeTimelines:2"}, puts)
+		assert.Zero(t, mockDynamoDBClient.jobs.len())
+	})
+
+	t.Run("should retry a transaction that conflicts with another write", func(t *testing.T) {
+		reset(transactionCanceled("None", "TransactionConflict"))
+		_, err := service.PostTweet(context.Background(), "1", "Hello World")
+		assert.NoError(t, err)
+		assert.Len(t, transactions, 2)
+		assert.NoError(t, service.runPendingJobs(context.Background()))
+		assert.Equal(t, []string{"HomeTimelines:2"}, puts)
+	})
+
+	t.Run("should give up after the last attempt", func(t *testing.T) {
+		conflict := transactionCanceled("None", "TransactionConflict")
+		reset(conflict, conflict, conflict, conflict)
+		_, err := service.PostTweet(context.Background(), "1", "Hello World")
+		var cancelled *types.TransactionCanceledException
+		assert.ErrorAs(t, err, &cancelled)
+		assert.Len(t, transactions, transactionAttempts)
+		assert.Empty(t, puts)
+	})
+
+	t.Run("should not retry a duplicate tweet ID", func(t *testing.T) {
+		reset(transactionCanceled("ConditionalCheckFailed", "None"))
+		_, err := service.PostTweet(context.Background(), "1", "Hello World")
+		assert.ErrorIs(t, err, domain.ErrDuplicateTweetID)
+		assert.Len(t, transactions, 1)
+	})
+
+	t.Run("should stop retrying when the request is cancelled", func(t *testing.T) {
+		transactionBackoff = time.Hour
+		defer func() { transactionBackoff = time.Millisecond }()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		mockDynamoDBClient.TransactWriteItemsFunc = func(ctx context.Context, input *dynamodb.TransactWriteItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			cancel()
+			return nil, transactionCanceled("None", "TransactionConflict")
+		}
+
+		_, err := service.PostTweet(ctx, "1", "Hello World")
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestIsTransactionConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		conflict bool
+	}{
+		{"conflict", transactionCanceled("None", "TransactionConflict"), true},
+		{"failed condition", transactionCanceled("ConditionalCheckFailed", "TransactionConflict"), false},
+		{"throttling", transactionCanceled("ThrottlingError"), false},
+		{"no reasons", transactionCanceled(), false},
+		{"other error", errors.New("connection reset"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run("should tell apart "+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.conflict, isTransactionConflict(tt.err))
+		})
+	}
+}
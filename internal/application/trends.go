@@ -0,0 +1,130 @@
+package application
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// RecentTrendBucket is the size of the time buckets the recent window of
+	// trends is counted in
+	RecentTrendBucket = 5 * time.Minute
+	// BaselineTrendBucket is the size of the time buckets the baseline window
+	// of trends is counted in
+	BaselineTrendBucket = time.Hour
+)
+
+// TrendsRedisClient is the part of the Redis client the trends use
+type TrendsRedisClient interface {
+	ZIncrBy(ctx context.Context, key string, increment float64, member string) *redis.FloatCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+	ZRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd
+}
+
+// RedisTrendService implements TrendService using Redis. Every use of a
+// hashtag is counted in a sorted set per time bucket, both in small buckets
+// for the recent window and in large buckets for the baseline window, so
+// the windows slide one bucket at a time and old buckets simply expire.
+type RedisTrendService struct {
+	RedisClient TrendsRedisClient
+	Windows     domain.TrendWindows
+	Clock       domain.Clock
+	Timeouts    Timeouts
+}
+
+// NewRedisTrendService creates a new RedisTrendService with the default
+// trend windows
+func NewRedisTrendService(redisClient TrendsRedisClient) *RedisTrendService {
+	return &RedisTrendService{
+		RedisClient: redisClient,
+		Windows:     domain.DefaultTrendWindows,
+		Clock:       time.Now,
+		Timeouts:    DefaultTimeouts,
+	}
+}
+
+// RecordHashtags counts one use of each hashtag at the current time
+func (s *RedisTrendService) RecordHashtags(ctx context.Context, hashtags []string) error {
+	ctx, cancel := s.Timeouts.write(ctx)
+	defer cancel()
+
+	now := s.Clock()
+	buckets := []struct {
+		size time.Duration
+		ttl  time.Duration
+	}{
+		{RecentTrendBucket, s.Windows.Recent + RecentTrendBucket},
+		{BaselineTrendBucket, s.Windows.Baseline + BaselineTrendBucket},
+	}
+
+	for _, bucket := range buckets {
+		key := trendBucketKey(bucket.size, now)
+		for _, hashtag := range hashtags {
+			if err := s.RedisClient.ZIncrBy(ctx, key, 1, hashtag).Err(); err != nil {
+				return err
+			}
+		}
+		if err := s.RedisClient.Expire(ctx, key, bucket.ttl).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTrends ranks the hashtags used in the recent window by how much faster
+// they are used than in the baseline window
+func (s *RedisTrendService) GetTrends(ctx context.Context, limit int) ([]domain.Trend, error) {
+	ctx, cancel := s.Timeouts.read(ctx)
+	defer cancel()
+
+	now := s.Clock()
+
+	counts, err := s.countHashtags(ctx, RecentTrendBucket, s.Windows.Recent, now)
+	if err != nil {
+		return nil, err
+	}
+	baselines, err := s.countHashtags(ctx, BaselineTrendBucket, s.Windows.Baseline, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Windows.RankTrends(counts, baselines, domain.TrendsLimit(limit)), nil
+}
+
+// countHashtags adds up the uses of every hashtag in the buckets of a size
+// that cover the window ending now
+func (s *RedisTrendService) countHashtags(ctx context.Context, size, window time.Duration, now time.Time) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for i := time.Duration(0); i < window; i += size {
+		uses, err := s.RedisClient.ZRangeWithScores(ctx, trendBucketKey(size, now.Add(-i)), 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, use := range uses {
+			counts[use.Member.(string)] += int64(use.Score)
+		}
+	}
+	return counts, nil
+}
+
+// trendBucketKey returns the key of the bucket of a size that contains t
+func trendBucketKey(size time.Duration, t time.Time) string {
+	start := t.Truncate(size).Unix()
+	return "trends:" + strconv.FormatInt(int64(size/time.Second), 10) + ":" + strconv.FormatInt(start, 10)
+}
+
+// recordTrends counts the hashtags of a posted tweet. Trends are best effort:
+// the tweet is already saved, so a failure is only logged.
+func recordTrends(ctx context.Context, trends domain.TrendService, tweet domain.Tweet) {
+	if trends == nil || len(tweet.Hashtags) == 0 {
+		return
+	}
+	if err := trends.RecordHashtags(ctx, tweet.Hashtags); err != nil {
+		log.Printf("Failed to record trends for hashtags %v: %v", tweet.Hashtags, err)
+	}
+}
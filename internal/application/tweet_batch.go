@@ -0,0 +1,136 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+)
+
+var (
+	// batchGetSize is the most keys DynamoDB reads in a single BatchGetItem
+	batchGetSize = 100
+
+	// batchGetAttempts is how many times a batch is read while DynamoDB keeps
+	// leaving keys unprocessed
+	batchGetAttempts = 5
+
+	// batchGetBackoff is how long to wait before reading the unprocessed keys
+	// of a batch again, doubled on every retry
+	batchGetBackoff = 25 * time.Millisecond
+)
+
+// errUnprocessedKeys is returned when DynamoDB still leaves keys of a batch
+// unprocessed after the last attempt
+var errUnprocessedKeys = errors.New("tweets left unprocessed by DynamoDB")
+
+// getTweets retrieves many tweets at once, keyed by ID; tweets that do not
+// exist are missing from the map. Cached tweets are read from Redis with a
+// single MGET and the rest from DynamoDB in batches, then cached. As in
+// GetTweet, Redis errors fall back to DynamoDB.
+func (s *DynamoRedisTweetService) getTweets(ctx context.Context, tweetIDs []string) (map[string]domain.Tweet, error) {
+	tweets := make(map[string]domain.Tweet, len(tweetIDs))
+	if len(tweetIDs) == 0 {
+		return tweets, nil
+	}
+
+	keys := make([]string, len(tweetIDs))
+	for i, tweetID := range tweetIDs {
+		keys[i] = tweetCacheKey(tweetID)
+	}
+	cached, err := s.RedisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		log.Printf("Failed to read cached tweets: %v", err)
+	}
+
+	var missing []string
+	for i, tweetID := range tweetIDs {
+		if _, ok := tweets[tweetID]; ok {
+			continue
+		}
+		if i < len(cached) {
+			if cachedTweet, ok := cached[i].(string); ok {
+				var tweet domain.Tweet
+				if err := json.Unmarshal([]byte(cachedTweet), &tweet); err == nil {
+					tweets[tweetID] = tweet
+					continue
+				}
+			}
+		}
+		missing = append(missing, tweetID)
+	}
+
+	for start := 0; start < len(missing); start += batchGetSize {
+		end := min(start+batchGetSize, len(missing))
+		fetched, err := s.batchGetTweets(ctx, missing[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tweet := range fetched {
+			tweets[tweet.TweetID] = tweet
+			s.cacheTweet(ctx, tweet)
+		}
+	}
+
+	return tweets, nil
+}
+
+// batchGetTweets reads up to batchGetSize distinct tweets from DynamoDB with
+// BatchGetItem. The keys DynamoDB leaves unprocessed, when the table is
+// throttled, are read again with exponential backoff.
+func (s *DynamoRedisTweetService) batchGetTweets(ctx context.Context, tweetIDs []string) ([]domain.Tweet, error) {
+	keys := make([]map[string]types.AttributeValue, 0, len(tweetIDs))
+	seen := make(map[string]bool, len(tweetIDs))
+	for _, tweetID := range tweetIDs {
+		if seen[tweetID] {
+			continue
+		}
+		seen[tweetID] = true
+		keys = append(keys, map[string]types.AttributeValue{
+			"TweetID": &types.AttributeValueMemberS{Value: tweetID},
+		})
+	}
+
+	var tweets []domain.Tweet
+	backoff := batchGetBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := s.DynamoDBClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{
+				"Tweets": {Keys: keys},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Responses["Tweets"] {
+			// Like getTweetFromDynamoDB, items without a timestamp are not
+			// tweets, and deleted tweets are missing
+			if _, ok := item["Timestamp"].(*types.AttributeValueMemberN); !ok || isDeletedItem(item) {
+				continue
+			}
+			tweets = append(tweets, tweetFromItem(item))
+		}
+
+		keys = result.UnprocessedKeys["Tweets"].Keys
+		if len(keys) == 0 {
+			return tweets, nil
+		}
+		if attempt >= batchGetAttempts {
+			return nil, errUnprocessedKeys
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,245 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// storedTweetItem returns the Tweets item of a stored tweet
+func storedTweetItem(tweetID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"TweetID":   &types.AttributeValueMemberS{Value: tweetID},
+		"UserID":    &types.AttributeValueMemberS{Value: "1"},
+		"Content":   &types.AttributeValueMemberS{Value: "tweet " + tweetID},
+		"Timestamp": &types.AttributeValueMemberN{Value: tweetID},
+	}
+}
+
+// batchGetStore answers BatchGetItem from the tweets with the given IDs,
+// recording the keys of every request
+func batchGetStore(requests *[][]string, exists func(tweetID string) bool) func(ctx context.Context, input *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	return func(ctx context.Context, input *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+		var ids []string
+		var items []map[string]types.AttributeValue
+		for _, key := range input.RequestItems["Tweets"].Keys {
+			tweetID := stringAttr(key, "TweetID")
+			ids = append(ids, tweetID)
+			if exists(tweetID) {
+				items = append(items, storedTweetItem(tweetID))
+			}
+		}
+		*requests = append(*requests, ids)
+		return &dynamodb.BatchGetItemOutput{
+			Responses: map[string][]map[string]types.AttributeValue{"Tweets": items},
+		}, nil
+	}
+}
+
+func TestGetTweets(t *testing.T) {
+	backoff := batchGetBackoff
+	batchGetBackoff = time.Millisecond
+	t.Cleanup(func() { batchGetBackoff = backoff })
+
+	var requests [][]string
+	var cachedKeys []string
+	mockDynamoDBClient := &MockDynamoDBClient{
+		BatchGetItemFunc: batchGetStore(&requests, func(tweetID string) bool { return tweetID != "404" }),
+	}
+	mockRedisClient := &MockRedisClient{
+		MGetFunc: func(ctx context.Context, keys ...string) *redis.SliceCmd {
+			// Only tweet 1 is cached
+			values := make([]interface{}, len(keys))
+			for i, key := range keys {
+				if key == tweetCacheKey("1") {
+					tweetJSON, _ := json.Marshal(domain.Tweet{TweetID: "1", Content: "cached"})
+					values[i] = string(tweetJSON)
+				}
+			}
+			return redis.NewSliceResult(values, nil)
+		},
+		SetFunc: func(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+			cachedKeys = append(cachedKeys, key)
+			return redis.NewStatusResult("OK", nil)
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, mockRedisClient)
+	reset := func() {
+		requests, cachedKeys = nil, nil
+	}
+
+	t.Run("should read cached tweets from Redis and batch the rest", func(t *testing.T) {
+		reset()
+		tweets, err := service.getTweets(context.Background(), []string{"1", "2", "404", "3", "2"})
+		assert.NoError(t, err)
+
+		assert.Len(t, tweets, 3)
+		assert.Equal(t, "cached", tweets["1"].Content)
+		assert.Equal(t, "tweet 2", tweets["2"].Content)
+		assert.Equal(t, "tweet 3", tweets["3"].Content)
+		assert.NotContains(t, tweets, "404")
+
+		assert.Equal(t, [][]string{{"2", "404", "3"}}, requests)
+		assert.ElementsMatch(t, []string{tweetCacheKey("2"), tweetCacheKey("3")}, cachedKeys)
+	})
+
+	t.Run("should read at most 100 tweets per batch", func(t *testing.T) {
+		reset()
+		ids := make([]string, 250)
+		for i := range ids {
+			ids[i] = strconv.Itoa(1000 + i)
+		}
+
+		tweets, err := service.getTweets(context.Background(), ids)
+		assert.NoError(t, err)
+		assert.Len(t, tweets, 250)
+
+		assert.Len(t, requests, 3)
+		assert.Len(t, requests[0], 100)
+		assert.Len(t, requests[1], 100)
+		assert.Len(t, requests[2], 50)
+	})
+
+	t.Run("should not read anything without IDs", func(t *testing.T) {
+		reset()
+		tweets, err := service.getTweets(context.Background(), nil)
+		assert.NoError(t, err)
+		assert.Empty(t, tweets)
+		assert.Empty(t, requests)
+	})
+
+	t.Run("should read every tweet from DynamoDB when Redis fails", func(t *testing.T) {
+		reset()
+		mockRedisClient.MGetFunc = func(ctx context.Context, keys ...string) *redis.SliceCmd {
+			return redis.NewSliceResult(nil, errors.New("connection refused"))
+		}
+
+		tweets, err := service.getTweets(context.Background(), []string{"1", "2"})
+		assert.NoError(t, err)
+		assert.Len(t, tweets, 2)
+		assert.Equal(t, [][]string{{"1", "2"}}, requests)
+	})
+}
+
+func TestBatchGetTweetsUnprocessedKeys(t *testing.T) {
+	backoff := batchGetBackoff
+	batchGetBackoff = time.Millisecond
+	t.Cleanup(func() { batchGetBackoff = backoff })
+
+	// Each call processes only the first key and leaves the rest unprocessed
+	var requests [][]string
+	mockDynamoDBClient := &MockDynamoDBClient{
+		BatchGetItemFunc: func(ctx context.Context, input *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+			keys := input.RequestItems["Tweets"].Keys
+			var ids []string
+			for _, key := range keys {
+				ids = append(ids, stringAttr(key, "TweetID"))
+			}
+			requests = append(requests, ids)
+
+			output := &dynamodb.BatchGetItemOutput{
+				Responses: map[string][]map[string]types.AttributeValue{
+					"Tweets": {storedTweetItem(ids[0])},
+				},
+			}
+			if len(keys) > 1 {
+				output.UnprocessedKeys = map[string]types.KeysAndAttributes{
+					"Tweets": {Keys: keys[1:]},
+				}
+			}
+			return output, nil
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, &MockRedisClient{})
+
+	t.Run("should read the unprocessed keys again", func(t *testing.T) {
+		requests = nil
+		tweets, err := service.batchGetTweets(context.Background(), []string{"1", "2", "3"})
+		assert.NoError(t, err)
+		assert.Len(t, tweets, 3)
+		assert.Equal(t, [][]string{{"1", "2", "3"}, {"2", "3"}, {"3"}}, requests)
+	})
+
+	t.Run("should give up after the last attempt", func(t *testing.T) {
+		requests = nil
+		ids := make([]string, batchGetAttempts+1)
+		for i := range ids {
+			ids[i] = strconv.Itoa(i + 1)
+		}
+
+		_, err := service.batchGetTweets(context.Background(), ids)
+		assert.ErrorIs(t, err, errUnprocessedKeys)
+		assert.Len(t, requests, batchGetAttempts)
+	})
+
+	t.Run("should stop retrying when the request is cancelled", func(t *testing.T) {
+		batchGetBackoff = time.Hour
+		defer func() { batchGetBackoff = time.Millisecond }()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := service.batchGetTweets(ctx, []string{"1", "2"})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+// BenchmarkHydrateTweets compares reading a page of tweets one by one with
+// reading them in a batch, against a fake DynamoDB with a fixed round-trip
+// latency and an empty cache
+func BenchmarkHydrateTweets(b *testing.B) {
+	const latency = time.Millisecond
+
+	ids := make([]string, 50)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i + 1)
+	}
+
+	fakeDynamoDBClient := &MockDynamoDBClient{
+		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			time.Sleep(latency)
+			return &dynamodb.GetItemOutput{Item: storedTweetItem(stringAttr(input.Key, "TweetID"))}, nil
+		},
+		BatchGetItemFunc: func(ctx context.Context, input *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+			time.Sleep(latency)
+			var items []map[string]types.AttributeValue
+			for _, key := range input.RequestItems["Tweets"].Keys {
+				items = append(items, storedTweetItem(stringAttr(key, "TweetID")))
+			}
+			return &dynamodb.BatchGetItemOutput{
+				Responses: map[string][]map[string]types.AttributeValue{"Tweets": items},
+			}, nil
+		},
+	}
+	service := NewDynamoRedisTweetService(fakeDynamoDBClient, &MockRedisClient{})
+	ctx := context.Background()
+
+	b.Run("GetTweet", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, id := range ids {
+				if _, err := service.GetTweet(ctx, id); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("BatchGetItem", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := service.getTweets(ctx, ids); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package application
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+)
+
+// Tweet index tables list tweets under a key, such as the tweets that
+// mention a user. They are partitioned by the key and sorted by TweetID, so
+// they page the same way as the home timeline.
+
+// indexTweet lists a tweet under a key of a tweet index table
+func (s *DynamoRedisTweetService) indexTweet(ctx context.Context, table, keyAttr, key string, tweet domain.Tweet) error {
+	_, err := s.DynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item: map[string]types.AttributeValue{
+			keyAttr:    &types.AttributeValueMemberS{Value: key},
+			"TweetID":  &types.AttributeValueMemberN{Value: tweet.TweetID},
+			"AuthorID": &types.AttributeValueMemberS{Value: tweet.UserID},
+		},
+	})
+	return err
+}
+
+// unindexTweet removes a tweet from a key of a tweet index table
+func (s *DynamoRedisTweetService) unindexTweet(ctx context.Context, table, keyAttr, key, tweetID string) error {
+	_, err := s.DynamoDBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			keyAttr:   &types.AttributeValueMemberS{Value: key},
+			"TweetID": &types.AttributeValueMemberN{Value: tweetID},
+		},
+	})
+	return err
+}
+
+// queryTweetIndex retrieves a page of the tweets listed under a key of a
+// tweet index table, newest tweets first, as seen by the given viewer
+func (s *DynamoRedisTweetService) queryTweetIndex(ctx context.Context, table, keyAttr, key, viewerID string, page domain.PageRequest) (domain.TimelinePage, error) {
+	sinceID, maxID, err := page.IDRange()
+	if err != nil {
+		return domain.TimelinePage{}, err
+	}
+	limit := page.PageSize()
+
+	result, err := s.DynamoDBClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		KeyConditionExpression: aws.String("#key = :key AND TweetID BETWEEN :minID AND :maxID"),
+		ExpressionAttributeNames: map[string]string{
+			"#key": keyAttr,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":key":   &types.AttributeValueMemberS{Value: key},
+			":minID": &types.AttributeValueMemberN{Value: strconv.FormatInt(sinceID+1, 10)},
+			":maxID": &types.AttributeValueMemberN{Value: strconv.FormatInt(maxID, 10)},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(int32(limit)),
+	})
+	if err != nil {
+		return domain.TimelinePage{}, err
+	}
+
+	tweetIDs := make([]string, len(result.Items))
+	for i, item := range result.Items {
+		tweetIDs[i] = strconv.FormatInt(numberAttr(item, "TweetID"), 10)
+	}
+	found, err := s.getTweets(ctx, tweetIDs)
+	if err != nil {
+		return domain.TimelinePage{}, err
+	}
+
+	var lastTweetID string
+	tweets := make([]domain.Tweet, 0, len(tweetIDs))
+	for _, tweetID := range tweetIDs {
+		lastTweetID = tweetID
+		if tweet, ok := found[tweetID]; ok {
+			tweets = append(tweets, tweet)
+		}
+	}
+
+	indexPage := domain.NewTimelinePage(tweets, limit)
+	// Deleted tweets are skipped, so the page may come up short while there
+	// are more tweets to fetch
+	if len(result.Items) == limit {
+		indexPage.NextCursor = domain.EncodeCursor(lastTweetID)
+	}
+
+	if err := s.addLikes(ctx, viewerID, indexPage.Tweets); err != nil {
+		return domain.TimelinePage{}, err
+	}
+	return indexPage, nil
+}
@@ -3,25 +3,73 @@ package application
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
-	"sort"
+	"math"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/freischarler/desafio-twitter/internal/snowflake"
 	"github.com/go-redis/redis/v8"
 )
 
 var (
-	MaxTweetLength = 280
+	// timelineCacheSize is the number of newest tweets of a home timeline kept
+	// in the Redis cache
+	timelineCacheSize = 200
+
+	// tweetCacheTTL is how long a tweet stays in the Redis cache after it is
+	// read
+	tweetCacheTTL = 10 * time.Minute
+
+	// tweetTombstoneTTL is how long a changed or deleted tweet cannot be
+	// cached again. It outlasts the reads in flight when the tweet changed,
+	// which the read timeout bounds, so none of them can cache a stale copy.
+	tweetTombstoneTTL = 30 * time.Second
+
+	// DefaultCelebrityThreshold is the follower count above which a user's
+	// tweets are no longer fanned out on write
+	DefaultCelebrityThreshold = 10000
 )
 
 type RedisClient interface {
 	Get(ctx context.Context, key string) *redis.StringCmd
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	MGet(ctx context.Context, keys ...string) *redis.SliceCmd
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+}
+
+// IDGenerator generates the IDs of new tweets and users, time ordered and
+// unique across instances
+type IDGenerator interface {
+	Next() (int64, error)
+}
+
+// defaultIDs generates IDs for services not given an IDGenerator, as worker
+// 0
+var defaultIDs, _ = snowflake.NewGenerator(0)
+
+// nextTweetID returns the ID of a new tweet
+func nextTweetID(ids IDGenerator) (string, int64, error) {
+	id, err := ids.Next()
+	if err != nil {
+		return "", 0, err
+	}
+	return strconv.FormatInt(id, 10), id, nil
+}
+
+// tweetTimestamp returns the timestamp of a new tweet, in Unix nanoseconds:
+// the time in its ID, so that indexes sorted by timestamp order tweets like
+// their IDs
+func tweetTimestamp(id int64) int64 {
+	return snowflake.Time(id).UnixNano()
 }
 
 type DynamoDBClient interface {
@@ -29,100 +77,276 @@ type DynamoDBClient interface {
 	GetItem(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
 	UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
 	Query(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	Scan(ctx context.Context, input *dynamodb.ScanInput, opts ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
 }
 
 // DynamoRedisTweetService implements TweetService using DynamoDB and Redis
 type DynamoRedisTweetService struct {
 	DynamoDBClient DynamoDBClient
 	RedisClient    RedisClient
-	Ctx            context.Context
+
+	// CelebrityThreshold is the follower count above which a user is treated
+	// as a celebrity: their tweets are merged into GetTimeline at read time
+	// instead of being fanned out on write. Zero disables the hybrid mode.
+	CelebrityThreshold int
+
+	// Trends, when set, counts the hashtags of every posted tweet
+	Trends domain.TrendService
+
+	// Timeouts bound each operation, on top of the caller's context
+	Timeouts Timeouts
+
+	// IDs generates the IDs of new tweets
+	IDs IDGenerator
+
+	// UserTweetsIndexReady, when set, reports whether the Tweets index sorted
+	// by timestamp is built; until then the tweets of a user are read from
+	// the legacy index. Nil means the index is built.
+	UserTweetsIndexReady *atomic.Bool
+
+	// ConversationsIndexReady, when set, reports whether the Tweets index of
+	// conversations is built; until then conversations cannot be read. Nil
+	// means the index is built.
+	ConversationsIndexReady *atomic.Bool
+
+	// FollowersIndexReady, when set, reports whether the UserFollowers index
+	// of followers is built; until then the jobs reading followers wait.
+	// Nil means the index is built.
+	FollowersIndexReady *atomic.Bool
+
+	// jobsQueued wakes RunJobs when a job is enqueued
+	jobsQueued chan struct{}
 }
 
 // NewDynamoRedisTweetService creates a new DynamoRedisTweetService
 func NewDynamoRedisTweetService(dynamoDBClient DynamoDBClient, redisClient RedisClient) *DynamoRedisTweetService {
 	return &DynamoRedisTweetService{
-		DynamoDBClient: dynamoDBClient,
-		RedisClient:    redisClient,
-		Ctx:            context.TODO(),
+		DynamoDBClient:     dynamoDBClient,
+		RedisClient:        redisClient,
+		CelebrityThreshold: DefaultCelebrityThreshold,
+		Timeouts:           DefaultTimeouts,
+		IDs:                defaultIDs,
+		jobsQueued:         make(chan struct{}, 1),
 	}
 }
 
-// PostTweet posts a new tweet
-func (s *DynamoRedisTweetService) PostTweet(userID, tweet string) (string, error) {
-	if len(tweet) > MaxTweetLength {
-		return "", domain.ErrTweetTooLong
+// PostTweet posts a new tweet. A reply must point to an existing tweet and
+// joins that tweet's conversation; a quote tweet must point to an existing
+// tweet and counts as a reshare of it.
+func (s *DynamoRedisTweetService) PostTweet(ctx context.Context, userID, tweet string, opts ...domain.PostOption) (string, error) {
+	ctx, cancel := s.Timeouts.write(ctx)
+	defer cancel()
+
+	tweet, err := domain.ValidateTweet(tweet)
+	if err != nil {
+		return "", err
+	}
+	options := domain.NewPostOptions(opts...)
+
+	tweetID, id, err := nextTweetID(s.IDs)
+	if err != nil {
+		return "", err
 	}
 
-	tweetID := strconv.FormatInt(time.Now().UnixNano(), 10)
+	newTweet := domain.Tweet{
+		TweetID:        tweetID,
+		UserID:         userID,
+		Content:        tweet,
+		Timestamp:      tweetTimestamp(id),
+		Type:           domain.TweetTypeOriginal,
+		ConversationID: tweetID,
+		Mentions:       domain.ExtractMentions(tweet),
+		Hashtags:       domain.ExtractHashtags(tweet),
+	}
+	if options.InReplyToTweetID != "" {
+		parent, err := s.GetTweet(ctx, options.InReplyToTweetID)
+		if errors.Is(err, domain.ErrTweetNotFound) {
+			return "", domain.ErrReplyToNotFound
+		} else if err != nil {
+			return "", err
+		}
+		newTweet.InReplyToTweetID = parent.TweetID
+		newTweet.ConversationID = domain.ConversationRootID(parent)
+	}
+	if options.QuotedTweetID != "" {
+		quoted, err := s.GetTweet(ctx, options.QuotedTweetID)
+		if errors.Is(err, domain.ErrTweetNotFound) {
+			return "", domain.ErrQuotedNotFound
+		} else if err != nil {
+			return "", err
+		}
+		newTweet.Type = domain.TweetTypeQuote
+		newTweet.QuotedTweetID = quoted.OriginalID()
+	}
 
-	_, err := s.DynamoDBClient.PutItem(s.Ctx, &dynamodb.PutItemInput{
-		TableName: aws.String("Tweets"),
-		Item: map[string]types.AttributeValue{
-			"TweetID":   &types.AttributeValueMemberS{Value: tweetID},
-			"UserID":    &types.AttributeValueMemberS{Value: userID},
-			"Content":   &types.AttributeValueMemberS{Value: tweet},
-			"Timestamp": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().UnixNano(), 10)},
-		},
+	if err := s.publishTweet(ctx, newTweet); err != nil {
+		return "", err
+	}
+
+	// The tweet is stored; from here on failures are logged, so a client
+	// never retries and posts it twice
+	s.afterCommit(ctx, "index mentions of", tweetID, func(ctx context.Context) error {
+		return s.indexMentions(ctx, newTweet)
+	})
+	s.afterCommit(ctx, "index hashtags of", tweetID, func(ctx context.Context) error {
+		return s.indexHashtags(ctx, newTweet)
 	})
+	recordTrends(ctx, s.Trends, newTweet)
+
+	if newTweet.QuotedTweetID != "" {
+		// Not retried, as a retry could count the quote twice
+		if err := s.incrementCounter(ctx, newTweet.QuotedTweetID, "QuoteCount", 1); err != nil {
+			log.Printf("Failed to count quote %s of tweet %s: %v", tweetID, newTweet.QuotedTweetID, err)
+		}
+	}
+
+	return tweetID, nil
+}
+
+// publishedItems is the number of items publishTweet commits for every
+// tweet
+const publishedItems = 2
+
+// publishTweet stores a new tweet and enqueues its fan-out to the author's
+// followers, or flags the author as a celebrity past the threshold. The
+// tweet and its entry in the author's home timeline commit in a single
+// transaction, so a tweet is never stored without showing up in its author's
+// timeline. The tweet is only stored if no tweet has its ID yet, so a
+// duplicate ID can never overwrite a tweet. The fan-out is a job committed in
+// the same transaction, so it runs in the background and resumes after a
+// failure. Extra items, like the marker of a retweet, commit in the same
+// transaction after the first publishedItems.
+func (s *DynamoRedisTweetService) publishTweet(ctx context.Context, tweet domain.Tweet, extra ...types.TransactWriteItem) error {
+	followersCount, err := getFollowCount(ctx, s.DynamoDBClient, tweet.UserID, "FollowersCount")
 	if err != nil {
-		return "", err
+		return err
+	}
+	celebrity := s.isCelebrity(followersCount)
+
+	// Celebrity tweets only reach the author's own home timeline; followers
+	// get them merged in when they read their timeline. They are flagged
+	// with NotFannedOut, so their deletion skips the followers too.
+	item := tweetItem(tweet)
+	if celebrity {
+		item["NotFannedOut"] = &types.AttributeValueMemberBOOL{Value: true}
+	} else {
+		extra = append(extra, tweetJob(jobFanOut, tweet).item())
 	}
 
-	_, err = s.DynamoDBClient.UpdateItem(s.Ctx, &dynamodb.UpdateItemInput{
-		TableName: aws.String("UserTimelines"),
-		Key: map[string]types.AttributeValue{
-			"UserID": &types.AttributeValueMemberS{Value: userID},
+	err = transactWrite(ctx, s.DynamoDBClient, append([]types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				TableName:           aws.String("Tweets"),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(TweetID)"),
+			},
 		},
-		UpdateExpression: aws.String("SET Tweets = list_append(if_not_exists(Tweets, :empty_list), :tweet_id)"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":tweet_id":   &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberS{Value: tweetID}}},
-			":empty_list": &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+		{
+			// The author sees their own tweets in their home timeline
+			Put: &types.Put{
+				TableName: aws.String("HomeTimelines"),
+				Item:      homeTimelineItem(tweet.UserID, tweet),
+			},
 		},
+	}, extra...))
+	if cancellationReason(err, 0) == "ConditionalCheckFailed" {
+		return domain.ErrDuplicateTweetID
+	} else if err != nil {
+		return err
+	}
+
+	if celebrity {
+		s.afterCommit(ctx, "flag the celebrity author of", tweet.TweetID, func(ctx context.Context) error {
+			return s.markCelebrity(ctx, tweet.UserID)
+		})
+	} else {
+		s.wakeJobs()
+	}
+
+	s.afterCommit(ctx, "cache", tweet.TweetID, func(ctx context.Context) error {
+		return s.addToCachedTimeline(ctx, tweet.UserID, tweet)
 	})
+	return nil
+}
+
+// GetTweet retrieves a tweet by its ID, along with its current counts
+func (s *DynamoRedisTweetService) GetTweet(ctx context.Context, tweetID string) (domain.Tweet, error) {
+	ctx, cancel := s.Timeouts.read(ctx)
+	defer cancel()
+
+	tweet, err := s.readTweet(ctx, tweetID)
 	if err != nil {
-		return "", err
+		return domain.Tweet{}, err
 	}
 
-	// Check if the user's timeline is in the cache
-	cachedTimeline, err := s.RedisClient.Get(s.Ctx, "timeline:"+userID).Result()
+	tweets := []domain.Tweet{tweet}
+	if err := s.addCounts(ctx, tweets); err != nil {
+		return domain.Tweet{}, err
+	}
+	return tweets[0], nil
+}
+
+// readTweet reads a tweet through a Redis cache so that hot tweets do not
+// hit DynamoDB on every read; the cache is only an optimization, so Redis
+// errors fall back to DynamoDB. The counts of a cached tweet may be stale.
+func (s *DynamoRedisTweetService) readTweet(ctx context.Context, tweetID string) (domain.Tweet, error) {
+	cachedTweet, err := s.RedisClient.Get(ctx, tweetCacheKey(tweetID)).Result()
 	if err == nil {
-		// If found in cache, update the cached timeline with the new tweet
-		var timeline []domain.Tweet
-		err = json.Unmarshal([]byte(cachedTimeline), &timeline)
-		if err != nil {
-			return "", err
+		var tweet domain.Tweet
+		if err := json.Unmarshal([]byte(cachedTweet), &tweet); err == nil {
+			return tweet, nil
 		}
+	} else if err != redis.Nil {
+		log.Printf("Failed to read cached tweet %s: %v", tweetID, err)
+	}
 
-		// Add the new tweet to the timeline
-		timeline = append(timeline, domain.Tweet{
-			TweetID:   tweetID,
-			UserID:    userID,
-			Content:   tweet,
-			Timestamp: time.Now().UnixNano(),
-		})
+	tweet, err := s.getTweetFromDynamoDB(ctx, tweetID)
+	if err != nil {
+		return domain.Tweet{}, err
+	}
 
-		// Sort the timeline by timestamp
-		sort.Slice(timeline, func(i, j int) bool {
-			return timeline[i].Timestamp > timeline[j].Timestamp
-		})
+	s.cacheTweet(ctx, tweet)
+	return tweet, nil
+}
 
-		// Cache the updated timeline in Redis
-		timelineJSON, err := json.Marshal(timeline)
-		if err != nil {
-			return "", err
-		}
-		err = s.RedisClient.Set(s.Ctx, "timeline:"+userID, timelineJSON, 10*time.Minute).Err()
-		if err != nil {
-			return "", err
-		}
+// cacheTweet caches a tweet read from DynamoDB, unless it is already cached
+// or was invalidated while it was read. The cache is only an optimization,
+// so errors are only logged.
+func (s *DynamoRedisTweetService) cacheTweet(ctx context.Context, tweet domain.Tweet) {
+	tweetJSON, err := json.Marshal(tweet)
+	if err == nil {
+		err = s.RedisClient.SetNX(ctx, tweetCacheKey(tweet.TweetID), tweetJSON, tweetCacheTTL).Err()
 	}
+	if err != nil {
+		log.Printf("Failed to cache tweet %s: %v", tweet.TweetID, err)
+	}
+}
 
-	return tweetID, nil
+// invalidateTweet replaces a cached tweet with a tombstone after it changes.
+// Unlike deleting the key, the tombstone keeps a reader that fetched the
+// tweet before the change from caching its stale copy.
+func (s *DynamoRedisTweetService) invalidateTweet(ctx context.Context, tweetID string) error {
+	return s.RedisClient.Set(ctx, tweetCacheKey(tweetID), tweetTombstone, tweetTombstoneTTL).Err()
 }
 
-// GetTweet retrieves a tweet by its ID
-func (s *DynamoRedisTweetService) GetTweet(tweetID string) (domain.Tweet, error) {
-	result, err := s.DynamoDBClient.GetItem(s.Ctx, &dynamodb.GetItemInput{
+// tweetTombstone is cached in place of a changed tweet; it is not valid JSON,
+// so readers take it as a miss
+const tweetTombstone = "tombstone"
+
+// tweetCacheKey returns the Redis key a tweet is cached under. The JSON
+// cache has its own prefix, since tweet:<tweetID> holds the hashes of
+// RedisTweetService.
+func tweetCacheKey(tweetID string) string {
+	return "tweet:json:" + tweetID
+}
+
+// getTweetFromDynamoDB retrieves a tweet by its ID from DynamoDB
+func (s *DynamoRedisTweetService) getTweetFromDynamoDB(ctx context.Context, tweetID string) (domain.Tweet, error) {
+	result, err := s.DynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String("Tweets"),
 		Key: map[string]types.AttributeValue{
 			"TweetID": &types.AttributeValueMemberS{Value: tweetID},
@@ -136,33 +360,128 @@ func (s *DynamoRedisTweetService) GetTweet(tweetID string) (domain.Tweet, error)
 		return domain.Tweet{}, domain.ErrTweetNotFound
 	}
 
-	timestampAttr, ok := result.Item["Timestamp"].(*types.AttributeValueMemberN)
-	if !ok || timestampAttr == nil {
+	if _, ok := result.Item["Timestamp"].(*types.AttributeValueMemberN); !ok || isDeletedItem(result.Item) {
 		return domain.Tweet{}, domain.ErrTweetNotFound
 	}
-	timestamp, _ := strconv.ParseInt(timestampAttr.Value, 10, 64)
 
-	tweet := domain.Tweet{
-		TweetID:   tweetID,
-		UserID:    result.Item["UserID"].(*types.AttributeValueMemberS).Value,
-		Content:   result.Item["Content"].(*types.AttributeValueMemberS).Value,
-		Timestamp: timestamp,
-	}
+	tweet := tweetFromItem(result.Item)
+	tweet.TweetID = tweetID
 
 	return tweet, nil
 }
 
-// GetTimeline retrieves the timeline for a user
-// GetTimeline retrieves the timeline for a user
-func (s *DynamoRedisTweetService) GetTimeline(userID string) ([]domain.Tweet, error) {
+// DeleteTweet deletes a tweet posted by the user. The tweet reads as
+// missing right away; its retweets and its copies in home timelines are
+// cleaned up by a background job.
+func (s *DynamoRedisTweetService) DeleteTweet(ctx context.Context, userID, tweetID string) error {
+	ctx, cancel := s.Timeouts.write(ctx)
+	defer cancel()
+
+	tweet, err := s.GetTweet(ctx, tweetID)
+	if err != nil {
+		return err
+	}
+	if tweet.UserID != userID {
+		return domain.ErrNotTweetOwner
+	}
+
+	return s.markDeleted(ctx, tweet)
+}
+
+// removeFromHomeTimelines removes a tweet from the materialized home
+// timelines of the given users, in batches, and drops their cached
+// timelines
+func (s *DynamoRedisTweetService) removeFromHomeTimelines(ctx context.Context, tweet domain.Tweet, userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	requests := make([]types.WriteRequest, 0, len(userIDs))
+	cacheKeys := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		requests = append(requests, types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{
+				Key: map[string]types.AttributeValue{
+					"UserID":  &types.AttributeValueMemberS{Value: userID},
+					"TweetID": &types.AttributeValueMemberN{Value: tweet.TweetID},
+				},
+			},
+		})
+		cacheKeys = append(cacheKeys, "timeline:"+userID)
+	}
+	if err := batchWrite(ctx, s.DynamoDBClient, "HomeTimelines", requests); err != nil {
+		return err
+	}
+
+	return s.RedisClient.Del(ctx, cacheKeys...).Err()
+}
+
+// GetTimeline retrieves a page of the timeline for a user, merging the
+// materialized home timeline with the tweets of any celebrities the user
+// follows
+func (s *DynamoRedisTweetService) GetTimeline(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error) {
+	ctx, cancel := s.Timeouts.read(ctx)
+	defer cancel()
+
+	sinceID, maxID, err := page.IDRange()
+	if err != nil {
+		return domain.TimelinePage{}, err
+	}
+	limit := page.PageSize()
+
+	timeline, err := s.getHomeTimeline(ctx, userID, sinceID, maxID, limit)
+	if err != nil {
+		return domain.TimelinePage{}, err
+	}
+
+	celebrityTweets, err := s.getCelebrityTweets(ctx, userID, sinceID, maxID, limit)
+	if err != nil {
+		return domain.TimelinePage{}, err
+	}
+
+	timeline = mergeTimelines(timeline, celebrityTweets)
+	if len(timeline) > limit {
+		timeline = timeline[:limit]
+	}
+
+	timelinePage := domain.NewTimelinePage(timeline, limit)
+	if err := s.addLikes(ctx, userID, timelinePage.Tweets); err != nil {
+		return domain.TimelinePage{}, err
+	}
+	return timelinePage, nil
+}
+
+// getHomeTimeline retrieves a page of the materialized home timeline for a
+// user. The newest tweets are served from the Redis cache; older pages are
+// queried from DynamoDB.
+func (s *DynamoRedisTweetService) getHomeTimeline(ctx context.Context, userID string, sinceID, maxID int64, limit int) ([]domain.Tweet, error) {
+	head, err := s.getCachedHomeTimeline(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	timeline := filterTimeline(head, sinceID, maxID, limit)
+
+	// The cache holds the newest tweets without gaps, so it covers the page
+	// unless the page may continue past the oldest cached tweet
+	if len(timeline) == limit || len(head) < timelineCacheSize || tweetIDValue(head[len(head)-1]) <= sinceID {
+		return timeline, nil
+	}
+
+	return s.getTimelineFromDynamoDB(ctx, userID, sinceID, maxID, limit)
+}
+
+// getCachedHomeTimeline retrieves the newest tweets of the home timeline for a
+// user from the Redis cache, rebuilding the cache from DynamoDB on a miss
+func (s *DynamoRedisTweetService) getCachedHomeTimeline(ctx context.Context, userID string) ([]domain.Tweet, error) {
 	// Try to get the timeline from Redis cache
-	cachedTimeline, err := s.RedisClient.Get(s.Ctx, "timeline:"+userID).Result()
+	cachedTimeline, err := s.RedisClient.Get(ctx, "timeline:"+userID).Result()
 	if err == redis.Nil {
 		// Log cache miss
 		log.Printf("Cache miss for user timeline: %s", userID)
 
 		// If not found in cache, get it from DynamoDB
-		timeline, err := s.getTimelineFromDynamoDB(userID)
+		timeline, err := s.getTimelineFromDynamoDB(ctx, userID, 0, math.MaxInt64, timelineCacheSize)
 		if err != nil {
 			return nil, err
 		}
@@ -177,7 +496,7 @@ func (s *DynamoRedisTweetService) GetTimeline(userID string) ([]domain.Tweet, er
 		if err != nil {
 			return nil, err
 		}
-		err = s.RedisClient.Set(s.Ctx, "timeline:"+userID, timelineJSON, 10*time.Minute).Err()
+		err = s.RedisClient.Set(ctx, "timeline:"+userID, timelineJSON, 10*time.Minute).Err()
 		if err != nil {
 			return nil, err
 		}
@@ -200,78 +519,81 @@ func (s *DynamoRedisTweetService) GetTimeline(userID string) ([]domain.Tweet, er
 	return timeline, nil
 }
 
-// getTimelineFromDynamoDB retrieves the timeline for a user from DynamoDB
-func (s *DynamoRedisTweetService) getTimelineFromDynamoDB(userID string) ([]domain.Tweet, error) {
-	// Get the list of users the user is following
-	following, err := s.getFollowing(userID)
+// getTimelineFromDynamoDB retrieves up to limit tweets of the materialized
+// home timeline for a user from DynamoDB, newest first, with IDs in the
+// range (sinceID, maxID]
+func (s *DynamoRedisTweetService) getTimelineFromDynamoDB(ctx context.Context, userID string, sinceID, maxID int64, limit int) ([]domain.Tweet, error) {
+	result, err := s.DynamoDBClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String("HomeTimelines"),
+		KeyConditionExpression: aws.String("UserID = :userID AND TweetID BETWEEN :minID AND :maxID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":userID": &types.AttributeValueMemberS{Value: userID},
+			":minID":  &types.AttributeValueMemberN{Value: strconv.FormatInt(sinceID+1, 10)},
+			":maxID":  &types.AttributeValueMemberN{Value: strconv.FormatInt(maxID, 10)},
+		},
+		// Newest tweets first
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(int32(limit)),
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Add the user themselves to the list
-	following = append(following, userID)
-
-	var timeline []domain.Tweet
-
-	// Get the tweets for each user in the following list
-	for _, followeeID := range following {
-		result, err := s.DynamoDBClient.GetItem(s.Ctx, &dynamodb.GetItemInput{
-			TableName: aws.String("UserTimelines"),
-			Key: map[string]types.AttributeValue{
-				"UserID": &types.AttributeValueMemberS{Value: followeeID},
-			},
-		})
-		if err != nil {
-			return nil, err
-		}
+	timeline := make([]domain.Tweet, 0, len(result.Items))
+	for _, item := range result.Items {
+		timeline = append(timeline, homeTimelineItemToTweet(item))
+	}
 
-		if result.Item == nil || result.Item["Tweets"] == nil {
-			continue
-		}
+	return timeline, nil
+}
 
-		tweetsAttr, ok := result.Item["Tweets"].(*types.AttributeValueMemberL)
-		if !ok || tweetsAttr == nil || len(tweetsAttr.Value) == 0 {
-			continue
+// filterTimeline returns up to limit tweets of a timeline with IDs in the
+// range (sinceID, maxID]
+func filterTimeline(timeline []domain.Tweet, sinceID, maxID int64, limit int) []domain.Tweet {
+	filtered := make([]domain.Tweet, 0, limit)
+	for _, tweet := range timeline {
+		if len(filtered) == limit {
+			break
 		}
-
-		tweetIDs := tweetsAttr.Value
-
-		for _, tweetIDAttr := range tweetIDs {
-			tweetID := tweetIDAttr.(*types.AttributeValueMemberS).Value
-			tweet, err := s.GetTweet(tweetID)
-			if err != nil {
-				continue
-			}
-			timeline = append(timeline, tweet)
+		id := tweetIDValue(tweet)
+		if id > sinceID && id <= maxID {
+			filtered = append(filtered, tweet)
 		}
 	}
+	return filtered
+}
 
-	// Sort the timeline by timestamp
-	sort.Slice(timeline, func(i, j int) bool {
-		return timeline[i].Timestamp > timeline[j].Timestamp
-	})
+// indexReady reports whether an index flagged by ready is built, where a nil
+// flag means it is
+func indexReady(ready *atomic.Bool) bool {
+	return ready == nil || ready.Load()
+}
 
-	return timeline, nil
+// tweetIDValue returns the numeric value of a tweet ID. Tweet IDs are time
+// ordered, so comparing them orders tweets chronologically.
+func tweetIDValue(tweet domain.Tweet) int64 {
+	id, _ := strconv.ParseInt(tweet.TweetID, 10, 64)
+	return id
 }
 
 // getFollowing retrieves the list of users the user is following from DynamoDB
-func (s *DynamoRedisTweetService) getFollowing(userID string) ([]string, error) {
-	result, err := s.DynamoDBClient.Query(s.Ctx, &dynamodb.QueryInput{
-		TableName:              aws.String("UserFollowers"),
-		KeyConditionExpression: aws.String("UserID = :userID"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":userID": &types.AttributeValueMemberS{Value: userID},
-		},
-	})
-	if err != nil {
-		return nil, err
-	}
+func (s *DynamoRedisTweetService) getFollowing(ctx context.Context, userID string) ([]string, error) {
+	return queryFollowing(ctx, s.DynamoDBClient, userID)
+}
 
-	var following []string
-	for _, item := range result.Items {
-		followeeID := item["FolloweeID"].(*types.AttributeValueMemberS).Value
-		following = append(following, followeeID)
+// getFollowers retrieves the followers of a user from DynamoDB
+func (s *DynamoRedisTweetService) getFollowers(ctx context.Context, userID string) ([]string, error) {
+	if !indexReady(s.FollowersIndexReady) {
+		return nil, domain.ErrIndexNotReady
 	}
+	return queryFollowers(ctx, s.DynamoDBClient, userID)
+}
 
-	return following, nil
+// followerIDsPage retrieves a page of the followers of a user for a job,
+// which waits while the index of followers is built
+func (s *DynamoRedisTweetService) followerIDsPage(ctx context.Context, userID string, startKey map[string]types.AttributeValue) ([]string, map[string]types.AttributeValue, error) {
+	if !indexReady(s.FollowersIndexReady) {
+		return nil, nil, errJobWaiting
+	}
+	return queryFollowerIDs(ctx, s.DynamoDBClient, userID, startKey, jobPageSize)
 }
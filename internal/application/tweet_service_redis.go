@@ -2,8 +2,10 @@ package application
 
 import (
 	"context"
+	"errors"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/freischarler/desafio-twitter/internal/domain"
@@ -13,45 +15,304 @@ import (
 // RedisTweetService implements TweetService using Redis
 type RedisTweetService struct {
 	RedisClient *redis.Client
-	Ctx         context.Context
+
+	// Trends, when set, counts the hashtags of every posted tweet
+	Trends domain.TrendService
+
+	// IDs generates the IDs of new tweets
+	IDs IDGenerator
 }
 
 // NewRedisTweetService creates a new RedisTweetService
 func NewRedisTweetService(redisClient *redis.Client) *RedisTweetService {
 	return &RedisTweetService{
 		RedisClient: redisClient,
-		Ctx:         context.Background(),
+		IDs:         defaultIDs,
+	}
+}
+
+// legacyUserTweetsPrefix prefixes the lists that held the tweet IDs of each
+// user before they became sorted sets under userTweetsKey
+const legacyUserTweetsPrefix = "user:timeline:"
+
+// userTweetsKey is the sorted set of the tweets posted by a user, scored by
+// tweet ID
+func userTweetsKey(userID string) string {
+	return "user:tweets:" + userID
+}
+
+// MigrateUserTweets converts the legacy lists of tweet IDs of each user into
+// the sorted sets read by GetTimeline, deleting each list once converted. It
+// can run while the service is serving requests and can be run again.
+func (s *RedisTweetService) MigrateUserTweets(ctx context.Context) error {
+	iter := s.RedisClient.Scan(ctx, 0, legacyUserTweetsPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		keyType, err := s.RedisClient.Type(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if keyType != "list" {
+			continue
+		}
+
+		tweetIDs, err := s.RedisClient.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		members := make([]*redis.Z, 0, len(tweetIDs))
+		for _, tweetID := range tweetIDs {
+			id, err := strconv.ParseInt(tweetID, 10, 64)
+			if err != nil {
+				continue
+			}
+			members = append(members, &redis.Z{Score: float64(id), Member: tweetID})
+		}
+
+		if len(members) > 0 {
+			userID := strings.TrimPrefix(key, legacyUserTweetsPrefix)
+			if err := s.RedisClient.ZAdd(ctx, userTweetsKey(userID), members...).Err(); err != nil {
+				return err
+			}
+		}
+		if err := s.RedisClient.Del(ctx, key).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// PostTweet posts a new tweet. A reply must point to an existing tweet and
+// joins that tweet's conversation; a quote tweet must point to an existing
+// tweet and counts as a reshare of it.
+func (s *RedisTweetService) PostTweet(ctx context.Context, userID, tweet string, opts ...domain.PostOption) (string, error) {
+	tweet, err := domain.ValidateTweet(tweet)
+	if err != nil {
+		return "", err
+	}
+	options := domain.NewPostOptions(opts...)
+
+	newTweet := domain.Tweet{
+		UserID:   userID,
+		Content:  tweet,
+		Type:     domain.TweetTypeOriginal,
+		Mentions: domain.ExtractMentions(tweet),
+		Hashtags: domain.ExtractHashtags(tweet),
+	}
+	if options.InReplyToTweetID != "" {
+		parent, err := s.GetTweet(ctx, options.InReplyToTweetID)
+		if errors.Is(err, domain.ErrTweetNotFound) {
+			return "", domain.ErrReplyToNotFound
+		} else if err != nil {
+			return "", err
+		}
+		newTweet.InReplyToTweetID = parent.TweetID
+		newTweet.ConversationID = domain.ConversationRootID(parent)
+	}
+	if options.QuotedTweetID != "" {
+		quoted, err := s.GetTweet(ctx, options.QuotedTweetID)
+		if errors.Is(err, domain.ErrTweetNotFound) {
+			return "", domain.ErrQuotedNotFound
+		} else if err != nil {
+			return "", err
+		}
+		newTweet.Type = domain.TweetTypeQuote
+		newTweet.QuotedTweetID = quoted.OriginalID()
+	}
+
+	tweetID, err := s.saveTweet(ctx, newTweet)
+	if err != nil {
+		return "", err
+	}
+	recordTrends(ctx, s.Trends, newTweet)
+
+	if newTweet.QuotedTweetID != "" {
+		if err := s.incrementCounter(ctx, newTweet.QuotedTweetID, "quoteCount", 1); err != nil {
+			return "", err
+		}
+	}
+
+	return tweetID, nil
+}
+
+// Retweet reshares a tweet as the given user. Retweeting a retweet reshares
+// the original tweet, and each user can retweet a tweet only once.
+func (s *RedisTweetService) Retweet(ctx context.Context, userID, tweetID string) (string, error) {
+	original, err := s.GetTweet(ctx, tweetID)
+	if err != nil {
+		return "", err
+	}
+	if original.IsRetweet() {
+		original, err = s.GetTweet(ctx, original.RetweetOfID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// retweets:<tweetID> holds the users who retweeted a tweet, and
+	// retweetIDsKey the ID of each of their retweets
+	added, err := s.RedisClient.SAdd(ctx, "retweets:"+original.TweetID, userID).Result()
+	if err != nil {
+		return "", err
+	}
+	if added == 0 {
+		return "", domain.ErrAlreadyRetweeted
+	}
+
+	retweetID, err := s.saveTweet(ctx, domain.Tweet{
+		UserID:      userID,
+		Content:     original.Content,
+		Type:        domain.TweetTypeRetweet,
+		RetweetOfID: original.TweetID,
+	})
+	if err != nil {
+		return "", err
+	}
+	err = s.RedisClient.HSet(ctx, retweetIDsKey(original.TweetID), userID, retweetID).Err()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.incrementCounter(ctx, original.TweetID, "retweetCount", 1); err != nil {
+		return "", err
 	}
+
+	return retweetID, nil
 }
 
-// PostTweet posts a new tweet
-func (s *RedisTweetService) PostTweet(userID, tweet string) (string, error) {
-	if len(tweet) > domain.MaxTweetLength {
-		return "", domain.ErrTweetTooLong
+// saveTweet assigns an ID to a new tweet and stores it along with its
+// conversation and its author's timeline
+func (s *RedisTweetService) saveTweet(ctx context.Context, tweet domain.Tweet) (string, error) {
+	tweetID, id, err := nextTweetID(s.IDs)
+	if err != nil {
+		return "", err
 	}
 
-	tweetID := strconv.FormatInt(s.RedisClient.Incr(s.Ctx, "tweetID:counter").Val(), 10)
+	// Claim the ID before storing the tweet, so a duplicate ID can never
+	// overwrite a tweet
+	claimed, err := s.RedisClient.HSetNX(ctx, "tweet:"+tweetID, "userID", tweet.UserID).Result()
+	if err != nil {
+		return "", err
+	}
+	if !claimed {
+		return "", domain.ErrDuplicateTweetID
+	}
 
-	err := s.RedisClient.HSet(s.Ctx, "tweet:"+tweetID, map[string]interface{}{
-		"userID":    userID,
-		"content":   tweet,
+	fields := map[string]interface{}{
+		"content":   tweet.Content,
 		"timestamp": time.Now().UnixNano(),
-	}).Err()
+		"type":      string(tweet.Type),
+	}
+	if tweet.InReplyToTweetID != "" {
+		fields["inReplyToTweetID"] = tweet.InReplyToTweetID
+	}
+	if tweet.RetweetOfID != "" {
+		fields["retweetOfID"] = tweet.RetweetOfID
+	}
+	if tweet.QuotedTweetID != "" {
+		fields["quotedTweetID"] = tweet.QuotedTweetID
+	}
+	if len(tweet.Mentions) > 0 {
+		fields["mentions"] = strings.Join(tweet.Mentions, " ")
+	}
+	if len(tweet.Hashtags) > 0 {
+		fields["hashtags"] = strings.Join(tweet.Hashtags, " ")
+	}
+
+	// Retweets are not part of a conversation; any other tweet without a
+	// conversation starts its own
+	conversationID := tweet.ConversationID
+	if conversationID == "" && !tweet.IsRetweet() {
+		conversationID = tweetID
+	}
+	if conversationID != "" {
+		fields["conversationID"] = conversationID
+	}
+
+	err = s.RedisClient.HSet(ctx, "tweet:"+tweetID, fields).Err()
 	if err != nil {
 		return "", err
 	}
 
-	err = s.RedisClient.RPush(s.Ctx, "user:timeline:"+userID, tweetID).Err()
+	// Conversations are sorted sets of the tweets in them, scored by tweet ID
+	if conversationID != "" {
+		err = s.RedisClient.ZAdd(ctx, "conversation:"+conversationID, &redis.Z{
+			Score:  float64(id),
+			Member: tweetID,
+		}).Err()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// User timelines, mentions and hashtags are sorted sets scored by tweet
+	// ID so they can be paged without loading the whole history
+	mentionedIDs, err := s.resolveMentions(ctx, tweet.Mentions)
 	if err != nil {
 		return "", err
 	}
+	keys := []string{userTweetsKey(tweet.UserID)}
+	for _, userID := range mentionedIDs {
+		keys = append(keys, "user:mentions:"+userID)
+	}
+	for _, tag := range tweet.Hashtags {
+		keys = append(keys, "hashtag:"+tag)
+	}
+	for _, key := range keys {
+		err = s.RedisClient.ZAdd(ctx, key, &redis.Z{
+			Score:  float64(id),
+			Member: tweetID,
+		}).Err()
+		if err != nil {
+			return "", err
+		}
+	}
 
 	return tweetID, nil
 }
 
+// resolveMentions returns the IDs of the users holding the mentioned
+// handles, looked up in the user:handles hash regardless of case. Handles
+// nobody holds are left out.
+func (s *RedisTweetService) resolveMentions(ctx context.Context, handles []string) ([]string, error) {
+	if len(handles) == 0 {
+		return nil, nil
+	}
+	fields := make([]string, len(handles))
+	for i, handle := range handles {
+		fields[i] = domain.NormalizeHandle(handle)
+	}
+	values, err := s.RedisClient.HMGet(ctx, "user:handles", fields...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var userIDs []string
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		userID, ok := value.(string)
+		if !ok || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, nil
+}
+
+// incrementCounter adds delta to a counter of a tweet. Counters of deleted
+// tweets are left alone.
+func (s *RedisTweetService) incrementCounter(ctx context.Context, tweetID, counter string, delta int64) error {
+	exists, err := s.RedisClient.Exists(ctx, "tweet:"+tweetID).Result()
+	if err != nil || exists == 0 {
+		return err
+	}
+	return s.RedisClient.HIncrBy(ctx, "tweet:"+tweetID, counter, delta).Err()
+}
+
 // GetTweet retrieves a tweet by its ID
-func (s *RedisTweetService) GetTweet(tweetID string) (domain.Tweet, error) {
-	tweetData, err := s.RedisClient.HGetAll(s.Ctx, "tweet:"+tweetID).Result()
+func (s *RedisTweetService) GetTweet(ctx context.Context, tweetID string) (domain.Tweet, error) {
+	tweetData, err := s.RedisClient.HGetAll(ctx, "tweet:"+tweetID).Result()
 	if err != nil {
 		return domain.Tweet{}, err
 	}
@@ -61,51 +322,441 @@ func (s *RedisTweetService) GetTweet(tweetID string) (domain.Tweet, error) {
 	}
 
 	timestamp, _ := strconv.ParseInt(tweetData["timestamp"], 10, 64)
+	retweetCount, _ := strconv.ParseInt(tweetData["retweetCount"], 10, 64)
+	quoteCount, _ := strconv.ParseInt(tweetData["quoteCount"], 10, 64)
+	likeCount, _ := strconv.ParseInt(tweetData["likeCount"], 10, 64)
 	tweet := domain.Tweet{
-		UserID:    tweetData["userID"],
-		Content:   tweetData["content"],
-		Timestamp: timestamp,
+		TweetID:          tweetID,
+		UserID:           tweetData["userID"],
+		Content:          tweetData["content"],
+		Timestamp:        timestamp,
+		Type:             domain.ParseTweetType(tweetData["type"]),
+		InReplyToTweetID: tweetData["inReplyToTweetID"],
+		ConversationID:   tweetData["conversationID"],
+		RetweetOfID:      tweetData["retweetOfID"],
+		QuotedTweetID:    tweetData["quotedTweetID"],
+		RetweetCount:     retweetCount,
+		QuoteCount:       quoteCount,
+		LikeCount:        likeCount,
+		Mentions:         strings.Fields(tweetData["mentions"]),
+		Hashtags:         strings.Fields(tweetData["hashtags"]),
 	}
 
 	return tweet, nil
 }
 
-// GetTimeline retrieves the timeline for a user
-func (s *RedisTweetService) GetTimeline(userID string) ([]domain.Tweet, error) {
-	// Fetch the list of followed users
-	following, err := s.RedisClient.SMembers(s.Ctx, "user:following:"+userID).Result()
+// retweetIDsKey is the hash of the retweets of a tweet, from the ID of the
+// user who retweeted it to the ID of the retweet
+func retweetIDsKey(tweetID string) string {
+	return "retweet_ids:" + tweetID
+}
+
+// DeleteTweet deletes a tweet posted by the user, along with its retweets
+func (s *RedisTweetService) DeleteTweet(ctx context.Context, userID, tweetID string) error {
+	tweet, err := s.GetTweet(ctx, tweetID)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	if tweet.UserID != userID {
+		return domain.ErrNotTweetOwner
+	}
+	return s.deleteTweet(ctx, tweet)
+}
 
-	var timeline []domain.Tweet
+// deleteTweet deletes a tweet and everything that refers to it. The retweets
+// go first and the tweet last, so a deletion that fails part way can be
+// retried.
+func (s *RedisTweetService) deleteTweet(ctx context.Context, tweet domain.Tweet) error {
+	tweetID, userID := tweet.TweetID, tweet.UserID
+	if !tweet.IsRetweet() {
+		if err := s.deleteRetweets(ctx, tweetID); err != nil {
+			return err
+		}
+	}
 
-	// Collect tweets from each followed user
-	for _, followeeID := range following {
-		tweetIDs, _ := s.RedisClient.LRange(s.Ctx, "user:timeline:"+followeeID, 0, -1).Result()
-		for _, tweetID := range tweetIDs {
-			tweet, err := s.GetTweet(tweetID)
+	if tweet.ConversationID != "" {
+		err := s.RedisClient.ZRem(ctx, "conversation:"+tweet.ConversationID, tweetID).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	mentionedIDs, err := s.resolveMentions(ctx, tweet.Mentions)
+	if err != nil {
+		return err
+	}
+	for _, mentionedID := range mentionedIDs {
+		err = s.RedisClient.ZRem(ctx, "user:mentions:"+mentionedID, tweetID).Err()
+		if err != nil {
+			return err
+		}
+	}
+	for _, tag := range tweet.Hashtags {
+		err = s.RedisClient.ZRem(ctx, "hashtag:"+tag, tweetID).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Timelines are built on read, so removing the tweet from its author's
+	// timeline removes it from every follower's timeline
+	err = s.RedisClient.ZRem(ctx, userTweetsKey(userID), tweetID).Err()
+	if err != nil {
+		return err
+	}
+
+	// The tweet goes before the reshare is undone, so a retried deletion
+	// does not undo it twice
+	deleted, err := s.RedisClient.Del(ctx, "tweet:"+tweetID).Result()
+	if err != nil || deleted == 0 {
+		return err
+	}
+
+	switch {
+	case tweet.IsRetweet():
+		err = s.RedisClient.SRem(ctx, "retweets:"+tweet.RetweetOfID, userID).Err()
+		if err != nil {
+			return err
+		}
+		err = s.RedisClient.HDel(ctx, retweetIDsKey(tweet.RetweetOfID), userID).Err()
+		if err != nil {
+			return err
+		}
+		return s.incrementCounter(ctx, tweet.RetweetOfID, "retweetCount", -1)
+	case tweet.QuotedTweetID != "":
+		return s.incrementCounter(ctx, tweet.QuotedTweetID, "quoteCount", -1)
+	}
+	return nil
+}
+
+// deleteRetweets deletes the retweets of a tweet. Retweets posted before
+// their IDs were kept in retweetIDsKey are looked up among the later tweets
+// of the user who posted them.
+func (s *RedisTweetService) deleteRetweets(ctx context.Context, tweetID string) error {
+	retweetIDs, err := s.RedisClient.HGetAll(ctx, retweetIDsKey(tweetID)).Result()
+	if err != nil {
+		return err
+	}
+	userIDs, err := s.RedisClient.SMembers(ctx, "retweets:"+tweetID).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		retweetID, ok := retweetIDs[userID]
+		if !ok {
+			retweetID, err = s.findLegacyRetweet(ctx, userID, tweetID)
 			if err != nil {
+				return err
+			}
+			if retweetID == "" {
 				continue
 			}
-			timeline = append(timeline, tweet)
 		}
+
+		retweet, err := s.GetTweet(ctx, retweetID)
+		if err == domain.ErrTweetNotFound {
+			// Deleted by an earlier attempt
+			retweet = domain.Tweet{TweetID: retweetID, UserID: userID, Type: domain.TweetTypeRetweet, RetweetOfID: tweetID}
+		} else if err != nil {
+			return err
+		}
+		if err := s.deleteTweet(ctx, retweet); err != nil {
+			return err
+		}
+	}
+
+	return s.RedisClient.Del(ctx, "retweets:"+tweetID, retweetIDsKey(tweetID)).Err()
+}
+
+// findLegacyRetweet returns the ID of the retweet of a tweet by a user, read
+// from the tweets the user posted after it, or "" if there is none
+func (s *RedisTweetService) findLegacyRetweet(ctx context.Context, userID, tweetID string) (string, error) {
+	id, err := strconv.ParseInt(tweetID, 10, 64)
+	if err != nil {
+		return "", nil
+	}
+
+	ids, err := s.RedisClient.ZRangeByScore(ctx, userTweetsKey(userID), &redis.ZRangeBy{
+		Min: strconv.FormatFloat(float64(id), 'f', -1, 64),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return "", err
+	}
+	for _, candidateID := range ids {
+		retweetOfID, err := s.RedisClient.HGet(ctx, "tweet:"+candidateID, "retweetOfID").Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if retweetOfID == tweetID {
+			return candidateID, nil
+		}
+	}
+	return "", nil
+}
+
+// GetConversation retrieves the whole conversation a tweet belongs to, as a
+// tree under the tweet that started it
+func (s *RedisTweetService) GetConversation(ctx context.Context, tweetID string) (domain.ConversationNode, error) {
+	tweet, err := s.GetTweet(ctx, tweetID)
+	if err != nil {
+		return domain.ConversationNode{}, err
+	}
+
+	root := tweet
+	if rootID := domain.ConversationRootID(tweet); rootID != tweet.TweetID {
+		root, err = s.GetTweet(ctx, rootID)
+		if errors.Is(err, domain.ErrTweetNotFound) {
+			// The conversation outlives a deleted root; show it from the
+			// requested tweet instead
+			root = tweet
+		} else if err != nil {
+			return domain.ConversationNode{}, err
+		}
+	}
+
+	ids, err := s.RedisClient.ZRange(ctx, "conversation:"+domain.ConversationRootID(tweet), 0, -1).Result()
+	if err != nil {
+		return domain.ConversationNode{}, err
+	}
+
+	tweets := make([]domain.Tweet, 0, len(ids))
+	for _, id := range ids {
+		reply, err := s.GetTweet(ctx, id)
+		if err != nil {
+			continue
+		}
+		tweets = append(tweets, reply)
+	}
+
+	return domain.BuildConversationTree(root, tweets), nil
+}
+
+// GetTimeline retrieves a page of the timeline for a user
+func (s *RedisTweetService) GetTimeline(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error) {
+	sinceID, maxID, err := page.IDRange()
+	if err != nil {
+		return domain.TimelinePage{}, err
+	}
+	limit := page.PageSize()
+
+	// Fetch the list of followed users
+	following, err := s.RedisClient.SMembers(ctx, "user:following:"+userID).Result()
+	if err != nil {
+		return domain.TimelinePage{}, err
 	}
 
 	// Include the user's own tweets
-	tweetIDs, _ := s.RedisClient.LRange(s.Ctx, "user:timeline:"+userID, 0, -1).Result()
+	authors := append(following, userID)
+
+	// Collect at most one page of tweet IDs from each author
+	var tweetIDs []int64
+	for _, authorID := range authors {
+		ids, err := s.rangeByID(ctx, userTweetsKey(authorID), sinceID, maxID, limit)
+		if err != nil {
+			return domain.TimelinePage{}, err
+		}
+		for _, id := range ids {
+			tweetID, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				continue
+			}
+			tweetIDs = append(tweetIDs, tweetID)
+		}
+	}
+
+	// Sort tweets newest first and keep a single page
+	sort.Slice(tweetIDs, func(i, j int) bool {
+		return tweetIDs[i] > tweetIDs[j]
+	})
+	if len(tweetIDs) > limit {
+		tweetIDs = tweetIDs[:limit]
+	}
+
+	timeline := make([]domain.Tweet, 0, len(tweetIDs))
 	for _, tweetID := range tweetIDs {
-		tweet, err := s.GetTweet(tweetID)
+		tweet, err := s.GetTweet(ctx, strconv.FormatInt(tweetID, 10))
 		if err != nil {
 			continue
 		}
 		timeline = append(timeline, tweet)
 	}
 
-	// Sort tweets by timestamp
-	sort.Slice(timeline, func(i, j int) bool {
-		return timeline[i].Timestamp > timeline[j].Timestamp
-	})
+	timelinePage := domain.NewTimelinePage(timeline, limit)
+	// Deleted tweets are skipped, so the page may come up short while there
+	// are more tweets to fetch
+	if len(tweetIDs) == limit {
+		timelinePage.NextCursor = domain.EncodeCursor(strconv.FormatInt(tweetIDs[len(tweetIDs)-1], 10))
+	}
+	if err := s.addLiked(ctx, userID, timelinePage.Tweets); err != nil {
+		return domain.TimelinePage{}, err
+	}
+	return timelinePage, nil
+}
+
+// LikeTweet likes a tweet as the given user. Liking a retweet likes the
+// original tweet, and liking a tweet again has no effect.
+func (s *RedisTweetService) LikeTweet(ctx context.Context, userID, tweetID string) error {
+	tweet, err := s.GetTweet(ctx, tweetID)
+	if err != nil {
+		return err
+	}
+	tweetID = tweet.OriginalID()
+
+	id, err := strconv.ParseInt(tweetID, 10, 64)
+	if err != nil {
+		return domain.ErrInvalidTweetID
+	}
+
+	// user:likes:<userID> holds the tweets a user liked, scored by tweet ID
+	added, err := s.RedisClient.ZAdd(ctx, "user:likes:"+userID, &redis.Z{
+		Score:  float64(id),
+		Member: tweetID,
+	}).Result()
+	if err != nil || added == 0 {
+		return err
+	}
+
+	return s.incrementCounter(ctx, tweetID, "likeCount", 1)
+}
+
+// UnlikeTweet removes the like of the given user from a tweet. Unliking a
+// tweet that is not liked has no effect.
+func (s *RedisTweetService) UnlikeTweet(ctx context.Context, userID, tweetID string) error {
+	tweet, err := s.GetTweet(ctx, tweetID)
+	if err == nil {
+		tweetID = tweet.OriginalID()
+	} else if !errors.Is(err, domain.ErrTweetNotFound) {
+		return err
+	}
+
+	removed, err := s.RedisClient.ZRem(ctx, "user:likes:"+userID, tweetID).Result()
+	if err != nil || removed == 0 {
+		return err
+	}
+
+	return s.incrementCounter(ctx, tweetID, "likeCount", -1)
+}
+
+// GetLikedTweets retrieves a page of the tweets liked by a user, newest
+// tweets first
+func (s *RedisTweetService) GetLikedTweets(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error) {
+	return s.getIndexedTweets(ctx, "user:likes:"+userID, userID, page)
+}
+
+// GetHashtagTimeline retrieves a page of the tweets with a hashtag, newest
+// tweets first. The hashtag matches regardless of case.
+func (s *RedisTweetService) GetHashtagTimeline(ctx context.Context, tag string, page domain.PageRequest) (domain.TimelinePage, error) {
+	tag, err := domain.ParseHashtag(tag)
+	if err != nil {
+		return domain.TimelinePage{}, err
+	}
+	return s.getIndexedTweets(ctx, "hashtag:"+tag, "", page)
+}
+
+// GetMentions retrieves a page of the tweets that mention a user, newest
+// tweets first
+func (s *RedisTweetService) GetMentions(ctx context.Context, userID string, page domain.PageRequest) (domain.TimelinePage, error) {
+	return s.getIndexedTweets(ctx, "user:mentions:"+userID, userID, page)
+}
+
+// getIndexedTweets retrieves a page of the tweets in a sorted set scored by
+// tweet ID, newest tweets first, as seen by the given viewer
+func (s *RedisTweetService) getIndexedTweets(ctx context.Context, key, viewerID string, page domain.PageRequest) (domain.TimelinePage, error) {
+	sinceID, maxID, err := page.IDRange()
+	if err != nil {
+		return domain.TimelinePage{}, err
+	}
+	limit := page.PageSize()
 
-	return timeline, nil
+	ids, err := s.rangeByID(ctx, key, sinceID, maxID, limit)
+	if err != nil {
+		return domain.TimelinePage{}, err
+	}
+
+	tweets := make([]domain.Tweet, 0, len(ids))
+	for _, id := range ids {
+		tweet, err := s.GetTweet(ctx, id)
+		if err != nil {
+			continue
+		}
+		tweets = append(tweets, tweet)
+	}
+
+	indexPage := domain.NewTimelinePage(tweets, limit)
+	// Deleted tweets are skipped, so the page may come up short while there
+	// are more tweets to fetch
+	if len(ids) == limit {
+		indexPage.NextCursor = domain.EncodeCursor(ids[len(ids)-1])
+	}
+
+	if err := s.addLiked(ctx, viewerID, indexPage.Tweets); err != nil {
+		return domain.TimelinePage{}, err
+	}
+	return indexPage, nil
+}
+
+// rangeByID returns up to limit members of a sorted set scored by tweet ID,
+// newest first, with IDs after sinceID and up to maxID. Scores are floats,
+// too coarse to tell apart tweets posted close together, so the set is read
+// by rounded score and the exact bounds are applied to the IDs. Members with
+// the same score are still in order, as IDs of the same length sort like
+// their numbers.
+func (s *RedisTweetService) rangeByID(ctx context.Context, key string, sinceID, maxID int64, limit int) ([]string, error) {
+	var ids []string
+	for offset := int64(0); ; offset += int64(limit) {
+		members, err := s.RedisClient.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{
+			Min:    strconv.FormatFloat(float64(sinceID), 'f', -1, 64),
+			Max:    strconv.FormatFloat(float64(maxID), 'f', -1, 64),
+			Offset: offset,
+			Count:  int64(limit),
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range members {
+			id, err := strconv.ParseInt(member, 10, 64)
+			if err != nil || id > maxID {
+				continue
+			}
+			if id <= sinceID {
+				return ids, nil
+			}
+			ids = append(ids, member)
+			if len(ids) == limit {
+				return ids, nil
+			}
+		}
+		if len(members) < limit {
+			return ids, nil
+		}
+	}
+}
+
+// addLiked marks the tweets the viewer liked, unless there is no viewer.
+// Retweets show whether the original tweet is liked.
+func (s *RedisTweetService) addLiked(ctx context.Context, viewerID string, tweets []domain.Tweet) error {
+	if len(tweets) == 0 || viewerID == "" {
+		return nil
+	}
+
+	tweetIDs := make([]string, len(tweets))
+	for i, tweet := range tweets {
+		tweetIDs[i] = tweet.OriginalID()
+	}
+
+	// Scores are tweet IDs, so a zero score means the tweet is not liked
+	scores, err := s.RedisClient.ZMScore(ctx, "user:likes:"+viewerID, tweetIDs...).Result()
+	if err != nil {
+		return err
+	}
+
+	for i := range tweets {
+		tweets[i].Liked = scores[i] != 0
+	}
+	return nil
 }
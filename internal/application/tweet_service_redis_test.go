@@ -2,9 +2,11 @@ package application
 
 import (
 	"context"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/freischarler/desafio-twitter/internal/domain"
 	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
 )
@@ -33,17 +35,18 @@ func TestRedisGetTimeline(t *testing.T) {
 	redisClient.SAdd(context.Background(), "user:following:"+userID, followeeID)
 
 	// Post tweets for User2
-	tweetService.PostTweet(followeeID, "Hello from User2!")
+	tweetService.PostTweet(context.Background(), followeeID, "Hello from User2!")
 	time.Sleep(1 * time.Second) // Ensure different timestamps
-	tweetService.PostTweet(followeeID, "Another tweet from User2!")
+	tweetService.PostTweet(context.Background(), followeeID, "Another tweet from User2!")
 
 	// Post tweets for User1
-	tweetService.PostTweet(userID, "Hello from User1!")
+	tweetService.PostTweet(context.Background(), userID, "Hello from User1!")
 	time.Sleep(1 * time.Second) // Ensure different timestamps
-	tweetService.PostTweet(userID, "Another tweet from User1!")
+	tweetService.PostTweet(context.Background(), userID, "Another tweet from User1!")
 
 	// Get timeline for User1
-	timeline, err := tweetService.GetTimeline(userID)
+	page, err := tweetService.GetTimeline(context.Background(), userID, domain.PageRequest{})
+	timeline := page.Tweets
 	assert.NoError(t, err)
 	assert.Len(t, timeline, 4)
 
@@ -58,6 +61,56 @@ func TestRedisGetTimeline(t *testing.T) {
 	for i, tweet := range timeline {
 		assert.Equal(t, expectedTweets[i], tweet.Content)
 	}
+
+	t.Run("should keep paging past tweets missing from a page", func(t *testing.T) {
+		// The newest tweet is gone while its ID is still indexed, as when
+		// its deletion is cut short
+		redisClient.Del(context.Background(), "tweet:"+timeline[0].TweetID)
+
+		page, err := tweetService.GetTimeline(context.Background(), userID, domain.PageRequest{Limit: 2})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 1)
+		assert.Equal(t, timeline[1].TweetID, page.Tweets[0].TweetID)
+		assert.NotEmpty(t, page.NextCursor)
+
+		page, err = tweetService.GetTimeline(context.Background(), userID, domain.PageRequest{Limit: 2, Cursor: page.NextCursor})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 2)
+		assert.Equal(t, timeline[2].TweetID, page.Tweets[0].TweetID)
+	})
+}
+
+func TestRedisMigrateUserTweets(t *testing.T) {
+	redisClient := setupTestRedisClient()
+	tweetService := NewRedisTweetService(redisClient)
+	ctx := context.Background()
+	redisClient.FlushDB(ctx)
+
+	firstID, _ := tweetService.PostTweet(ctx, "user1", "First")
+	secondID, _ := tweetService.PostTweet(ctx, "user1", "Second")
+
+	// Store the tweet IDs the way they were stored before sorted sets
+	redisClient.Del(ctx, userTweetsKey("user1"))
+	redisClient.RPush(ctx, legacyUserTweetsPrefix+"user1", firstID, secondID)
+
+	t.Run("should convert the legacy lists into sorted sets", func(t *testing.T) {
+		err := tweetService.MigrateUserTweets(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), redisClient.Exists(ctx, legacyUserTweetsPrefix+"user1").Val())
+
+		page, err := tweetService.GetTimeline(ctx, "user1", domain.PageRequest{})
+		assert.NoError(t, err)
+		if assert.Len(t, page.Tweets, 2) {
+			assert.Equal(t, secondID, page.Tweets[0].TweetID)
+			assert.Equal(t, firstID, page.Tweets[1].TweetID)
+		}
+	})
+
+	t.Run("should be safe to run again", func(t *testing.T) {
+		err := tweetService.MigrateUserTweets(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), redisClient.ZCard(ctx, userTweetsKey("user1")).Val())
+	})
 }
 
 func TestRedisGetTimeline_NoFollowing(t *testing.T) {
@@ -71,11 +124,12 @@ func TestRedisGetTimeline_NoFollowing(t *testing.T) {
 	userID := "user1"
 
 	// Post tweets for User1
-	tweetService.PostTweet(userID, "Hello from User1!")
-	tweetService.PostTweet(userID, "Another tweet from User1!")
+	tweetService.PostTweet(context.Background(), userID, "Hello from User1!")
+	tweetService.PostTweet(context.Background(), userID, "Another tweet from User1!")
 
 	// Get timeline for User1
-	timeline, err := tweetService.GetTimeline(userID)
+	page, err := tweetService.GetTimeline(context.Background(), userID, domain.PageRequest{})
+	timeline := page.Tweets
 	assert.NoError(t, err)
 	assert.Len(t, timeline, 2)
 
@@ -101,7 +155,418 @@ func TestRedisGetTimeline_NoTweets(t *testing.T) {
 	userID := "user1"
 
 	// Get timeline for User1
-	timeline, err := tweetService.GetTimeline(userID)
+	page, err := tweetService.GetTimeline(context.Background(), userID, domain.PageRequest{})
+	timeline := page.Tweets
 	assert.NoError(t, err)
 	assert.Len(t, timeline, 0)
 }
+
+func TestRedisGetTimeline_Pagination(t *testing.T) {
+	redisClient := setupTestRedisClient()
+	tweetService := NewRedisTweetService(redisClient)
+
+	// Clean up Redis database before running the test
+	redisClient.FlushDB(context.Background())
+
+	userID := "user1"
+	followeeID := "user2"
+	redisClient.SAdd(context.Background(), "user:following:"+userID, followeeID)
+
+	var tweetIDs []string
+	for i := 0; i < 5; i++ {
+		authorID := userID
+		if i%2 == 0 {
+			authorID = followeeID
+		}
+		tweetID, err := tweetService.PostTweet(context.Background(), authorID, "tweet")
+		assert.NoError(t, err)
+		tweetIDs = append([]string{tweetID}, tweetIDs...)
+	}
+
+	t.Run("should walk the timeline with cursors", func(t *testing.T) {
+		var got []string
+		page := domain.PageRequest{Limit: 2}
+		for {
+			result, err := tweetService.GetTimeline(context.Background(), userID, page)
+			assert.NoError(t, err)
+			for _, tweet := range result.Tweets {
+				got = append(got, tweet.TweetID)
+			}
+			if result.NextCursor == "" {
+				break
+			}
+			page.Cursor = result.NextCursor
+		}
+		assert.Equal(t, tweetIDs, got)
+	})
+
+	t.Run("should honour since_id and max_id", func(t *testing.T) {
+		result, err := tweetService.GetTimeline(context.Background(), userID, domain.PageRequest{SinceID: tweetIDs[4], MaxID: tweetIDs[1]})
+		assert.NoError(t, err)
+		assert.Len(t, result.Tweets, 3)
+		assert.Equal(t, tweetIDs[1], result.Tweets[0].TweetID)
+		assert.Equal(t, tweetIDs[3], result.Tweets[2].TweetID)
+		assert.Empty(t, result.NextCursor)
+	})
+
+	t.Run("should reject invalid cursors", func(t *testing.T) {
+		_, err := tweetService.GetTimeline(context.Background(), userID, domain.PageRequest{Cursor: "!"})
+		assert.Equal(t, domain.ErrInvalidCursor, err)
+	})
+}
+
+func TestRedisDeleteTweet(t *testing.T) {
+	redisClient := setupTestRedisClient()
+	tweetService := NewRedisTweetService(redisClient)
+
+	// Clean up Redis database before running the test
+	redisClient.FlushDB(context.Background())
+
+	redisClient.SAdd(context.Background(), "user:following:user1", "user2")
+	tweetID, err := tweetService.PostTweet(context.Background(), "user2", "Hello from User2!")
+	assert.NoError(t, err)
+
+	t.Run("should not let other users delete the tweet", func(t *testing.T) {
+		err := tweetService.DeleteTweet(context.Background(), "user1", tweetID)
+		assert.Equal(t, domain.ErrNotTweetOwner, err)
+	})
+
+	t.Run("should delete tweet successfully", func(t *testing.T) {
+		err := tweetService.DeleteTweet(context.Background(), "user2", tweetID)
+		assert.NoError(t, err)
+
+		_, err = tweetService.GetTweet(context.Background(), tweetID)
+		assert.Equal(t, domain.ErrTweetNotFound, err)
+
+		page, err := tweetService.GetTimeline(context.Background(), "user1", domain.PageRequest{})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Tweets)
+	})
+}
+
+func TestRedisGetConversation(t *testing.T) {
+	redisClient := setupTestRedisClient()
+	tweetService := NewRedisTweetService(redisClient)
+
+	// Clean up Redis database before running the test
+	redisClient.FlushDB(context.Background())
+
+	rootID, err := tweetService.PostTweet(context.Background(), "user1", "Root")
+	assert.NoError(t, err)
+	replyID, err := tweetService.PostTweet(context.Background(), "user2", "Reply", domain.InReplyTo(rootID))
+	assert.NoError(t, err)
+	nestedID, err := tweetService.PostTweet(context.Background(), "user1", "Nested reply", domain.InReplyTo(replyID))
+	assert.NoError(t, err)
+
+	t.Run("should not reply to a missing tweet", func(t *testing.T) {
+		_, err := tweetService.PostTweet(context.Background(), "user1", "Reply", domain.InReplyTo("404"))
+		assert.Equal(t, domain.ErrReplyToNotFound, err)
+	})
+
+	t.Run("should return the whole conversation from any of its tweets", func(t *testing.T) {
+		conversation, err := tweetService.GetConversation(context.Background(), nestedID)
+		assert.NoError(t, err)
+		assert.Equal(t, rootID, conversation.Tweet.TweetID)
+		assert.Len(t, conversation.Replies, 1)
+		assert.Equal(t, replyID, conversation.Replies[0].Tweet.TweetID)
+		assert.Equal(t, rootID, conversation.Replies[0].Tweet.ConversationID)
+		assert.Len(t, conversation.Replies[0].Replies, 1)
+		assert.Equal(t, nestedID, conversation.Replies[0].Replies[0].Tweet.TweetID)
+	})
+
+	t.Run("should drop deleted replies from the conversation", func(t *testing.T) {
+		err := tweetService.DeleteTweet(context.Background(), "user1", nestedID)
+		assert.NoError(t, err)
+
+		conversation, err := tweetService.GetConversation(context.Background(), rootID)
+		assert.NoError(t, err)
+		assert.Len(t, conversation.Replies, 1)
+		assert.Empty(t, conversation.Replies[0].Replies)
+	})
+}
+
+func TestRedisRetweet(t *testing.T) {
+	redisClient := setupTestRedisClient()
+	tweetService := NewRedisTweetService(redisClient)
+
+	// Clean up Redis database before running the test
+	redisClient.FlushDB(context.Background())
+
+	redisClient.SAdd(context.Background(), "user:following:user3", "user1", "user2")
+	originalID, err := tweetService.PostTweet(context.Background(), "user1", "Original")
+	assert.NoError(t, err)
+	retweetID, err := tweetService.Retweet(context.Background(), "user2", originalID)
+	assert.NoError(t, err)
+	_, err = tweetService.PostTweet(context.Background(), "user2", "Look at this", domain.Quoting(originalID))
+	assert.NoError(t, err)
+
+	t.Run("should attribute retweets to the resharer", func(t *testing.T) {
+		retweet, err := tweetService.GetTweet(context.Background(), retweetID)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.TweetTypeRetweet, retweet.Type)
+		assert.Equal(t, "user2", retweet.UserID)
+		assert.Equal(t, originalID, retweet.RetweetOfID)
+	})
+
+	t.Run("should count reshares on the original", func(t *testing.T) {
+		original, err := tweetService.GetTweet(context.Background(), originalID)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), original.RetweetCount)
+		assert.Equal(t, int64(1), original.QuoteCount)
+	})
+
+	t.Run("should not retweet a tweet twice", func(t *testing.T) {
+		_, err := tweetService.Retweet(context.Background(), "user2", originalID)
+		assert.Equal(t, domain.ErrAlreadyRetweeted, err)
+	})
+
+	t.Run("should hide retweets of tweets already in the timeline", func(t *testing.T) {
+		page, err := tweetService.GetTimeline(context.Background(), "user3", domain.PageRequest{})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 2)
+		for _, tweet := range page.Tweets {
+			assert.False(t, tweet.IsRetweet())
+		}
+	})
+
+	t.Run("should undo the retweet when it is deleted", func(t *testing.T) {
+		err := tweetService.DeleteTweet(context.Background(), "user2", retweetID)
+		assert.NoError(t, err)
+
+		original, err := tweetService.GetTweet(context.Background(), originalID)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), original.RetweetCount)
+	})
+
+	t.Run("should delete the retweets of a deleted tweet", func(t *testing.T) {
+		retweetID, err := tweetService.Retweet(context.Background(), "user3", originalID)
+		assert.NoError(t, err)
+		// A retweet posted before retweet IDs were kept
+		legacyID, err := tweetService.Retweet(context.Background(), "user2", originalID)
+		assert.NoError(t, err)
+		redisClient.HDel(context.Background(), retweetIDsKey(originalID), "user2")
+
+		err = tweetService.DeleteTweet(context.Background(), "user1", originalID)
+		assert.NoError(t, err)
+
+		for _, id := range []string{originalID, retweetID, legacyID} {
+			_, err = tweetService.GetTweet(context.Background(), id)
+			assert.Equal(t, domain.ErrTweetNotFound, err)
+		}
+		page, err := tweetService.GetTimeline(context.Background(), "user3", domain.PageRequest{})
+		assert.NoError(t, err)
+		for _, tweet := range page.Tweets {
+			assert.NotEqual(t, originalID, tweet.OriginalID())
+		}
+		assert.Zero(t, redisClient.Exists(context.Background(), "retweets:"+originalID, retweetIDsKey(originalID)).Val())
+	})
+}
+
+func TestRedisLikes(t *testing.T) {
+	redisClient := setupTestRedisClient()
+	tweetService := NewRedisTweetService(redisClient)
+
+	// Clean up Redis database before running the test
+	redisClient.FlushDB(context.Background())
+
+	redisClient.SAdd(context.Background(), "user:following:user1", "user2")
+	var tweetIDs []string
+	for i := 0; i < 3; i++ {
+		tweetID, err := tweetService.PostTweet(context.Background(), "user2", "Tweet "+strconv.Itoa(i))
+		assert.NoError(t, err)
+		tweetIDs = append(tweetIDs, tweetID)
+	}
+
+	t.Run("should count each like once", func(t *testing.T) {
+		assert.NoError(t, tweetService.LikeTweet(context.Background(), "user1", tweetIDs[1]))
+		assert.NoError(t, tweetService.LikeTweet(context.Background(), "user1", tweetIDs[1]))
+		assert.NoError(t, tweetService.LikeTweet(context.Background(), "user3", tweetIDs[1]))
+
+		tweet, err := tweetService.GetTweet(context.Background(), tweetIDs[1])
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), tweet.LikeCount)
+	})
+
+	t.Run("should flag the tweets the viewer liked in the timeline", func(t *testing.T) {
+		page, err := tweetService.GetTimeline(context.Background(), "user1", domain.PageRequest{})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 3)
+		for _, tweet := range page.Tweets {
+			assert.Equal(t, tweet.TweetID == tweetIDs[1], tweet.Liked)
+		}
+	})
+
+	t.Run("should list liked tweets newest first", func(t *testing.T) {
+		assert.NoError(t, tweetService.LikeTweet(context.Background(), "user1", tweetIDs[2]))
+
+		page, err := tweetService.GetLikedTweets(context.Background(), "user1", domain.PageRequest{Limit: 1})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 1)
+		assert.Equal(t, tweetIDs[2], page.Tweets[0].TweetID)
+
+		page, err = tweetService.GetLikedTweets(context.Background(), "user1", domain.PageRequest{Limit: 1, Cursor: page.NextCursor})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 1)
+		assert.Equal(t, tweetIDs[1], page.Tweets[0].TweetID)
+	})
+
+	t.Run("should unlike idempotently", func(t *testing.T) {
+		assert.NoError(t, tweetService.UnlikeTweet(context.Background(), "user1", tweetIDs[1]))
+		assert.NoError(t, tweetService.UnlikeTweet(context.Background(), "user1", tweetIDs[1]))
+
+		tweet, err := tweetService.GetTweet(context.Background(), tweetIDs[1])
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), tweet.LikeCount)
+	})
+}
+
+func TestRedisMentions(t *testing.T) {
+	redisClient := setupTestRedisClient()
+	tweetService := NewRedisTweetService(redisClient)
+
+	// Clean up Redis database before running the test
+	redisClient.FlushDB(context.Background())
+
+	userService := NewRedisUserService(redisClient)
+	users := make(map[string]string)
+	for _, handle := range []string{"ada", "grace", "alan"} {
+		user, err := userService.Register(context.Background(), domain.Registration{Handle: handle, Password: "correct horse"})
+		assert.NoError(t, err)
+		users[handle] = user.ID
+	}
+
+	firstID, err := tweetService.PostTweet(context.Background(), users["ada"], "Hello @Grace and @alan, not @nobody")
+	assert.NoError(t, err)
+	secondID, err := tweetService.PostTweet(context.Background(), users["alan"], "@grace again")
+	assert.NoError(t, err)
+
+	t.Run("should page the mentions of a user newest first", func(t *testing.T) {
+		page, err := tweetService.GetMentions(context.Background(), users["grace"], domain.PageRequest{Limit: 1})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 1)
+		assert.Equal(t, secondID, page.Tweets[0].TweetID)
+
+		page, err = tweetService.GetMentions(context.Background(), users["grace"], domain.PageRequest{Limit: 1, Cursor: page.NextCursor})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 1)
+		assert.Equal(t, firstID, page.Tweets[0].TweetID)
+	})
+
+	t.Run("should index nothing for unknown handles", func(t *testing.T) {
+		exists, err := redisClient.Exists(context.Background(), "user:mentions:nobody").Result()
+		assert.NoError(t, err)
+		assert.Zero(t, exists)
+	})
+
+	t.Run("should remove the mentions of a deleted tweet", func(t *testing.T) {
+		err := tweetService.DeleteTweet(context.Background(), users["ada"], firstID)
+		assert.NoError(t, err)
+
+		page, err := tweetService.GetMentions(context.Background(), users["alan"], domain.PageRequest{})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Tweets)
+	})
+}
+
+func TestRedisHashtags(t *testing.T) {
+	redisClient := setupTestRedisClient()
+	tweetService := NewRedisTweetService(redisClient)
+
+	// Clean up Redis database before running the test
+	redisClient.FlushDB(context.Background())
+
+	firstID, err := tweetService.PostTweet(context.Background(), "user1", "Vamos #Argentina #Fútbol")
+	assert.NoError(t, err)
+	secondID, err := tweetService.PostTweet(context.Background(), "user2", "#ARGENTINA campeón")
+	assert.NoError(t, err)
+
+	t.Run("should page the tweets of a hashtag newest first regardless of case", func(t *testing.T) {
+		page, err := tweetService.GetHashtagTimeline(context.Background(), "argentina", domain.PageRequest{Limit: 1})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 1)
+		assert.Equal(t, secondID, page.Tweets[0].TweetID)
+
+		page, err = tweetService.GetHashtagTimeline(context.Background(), "#Argentina", domain.PageRequest{Limit: 1, Cursor: page.NextCursor})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tweets, 1)
+		assert.Equal(t, firstID, page.Tweets[0].TweetID)
+		assert.Equal(t, []string{"argentina", "fútbol"}, page.Tweets[0].Hashtags)
+	})
+
+	t.Run("should remove the hashtags of a deleted tweet", func(t *testing.T) {
+		err := tweetService.DeleteTweet(context.Background(), "user1", firstID)
+		assert.NoError(t, err)
+
+		page, err := tweetService.GetHashtagTimeline(context.Background(), "FÚTBOL", domain.PageRequest{})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Tweets)
+	})
+}
+
+func TestRedisTrends(t *testing.T) {
+	redisClient := setupTestRedisClient()
+	trendService := NewRedisTrendService(redisClient)
+	tweetService := NewRedisTweetService(redisClient)
+	tweetService.Trends = trendService
+
+	// Clean up Redis database before running the test
+	redisClient.FlushDB(context.Background())
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	trendService.Clock = func() time.Time { return now }
+
+	// #golang is used all day long, #gophercon only in the last hour
+	for hour := 23; hour >= 1; hour-- {
+		now = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Add(-time.Duration(hour) * time.Hour)
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, trendService.RecordHashtags(context.Background(), []string{"golang"}))
+		}
+	}
+	now = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		_, err := tweetService.PostTweet(context.Background(), "user1", "#Golang y #GopherCon")
+		assert.NoError(t, err)
+	}
+	_, err := tweetService.PostTweet(context.Background(), "user1", "#once")
+	assert.NoError(t, err)
+
+	t.Run("should rank hashtags by velocity rather than count", func(t *testing.T) {
+		trends, err := trendService.GetTrends(context.Background(), 10)
+		assert.NoError(t, err)
+		assert.Len(t, trends, 2)
+		assert.Equal(t, "gophercon", trends[0].Hashtag)
+		assert.Equal(t, "golang", trends[1].Hashtag)
+		assert.Equal(t, int64(5), trends[1].Count)
+		assert.Equal(t, int64(120), trends[1].Baseline)
+	})
+
+	t.Run("should slide the recent window", func(t *testing.T) {
+		now = now.Add(2 * time.Hour)
+
+		trends, err := trendService.GetTrends(context.Background(), 10)
+		assert.NoError(t, err)
+		assert.Empty(t, trends)
+	})
+}
+
+func TestRedisDuplicateTweetID(t *testing.T) {
+	redisClient := setupTestRedisClient()
+	tweetService := NewRedisTweetService(redisClient)
+	tweetService.IDs = fixedIDGenerator{id: 42}
+
+	redisClient.FlushDB(context.Background())
+
+	tweetID, err := tweetService.PostTweet(context.Background(), "user1", "First")
+	assert.NoError(t, err)
+	assert.Equal(t, "42", tweetID)
+
+	t.Run("should not overwrite a tweet with a duplicate ID", func(t *testing.T) {
+		_, err := tweetService.PostTweet(context.Background(), "user2", "Second")
+		assert.ErrorIs(t, err, domain.ErrDuplicateTweetID)
+
+		tweet, err := tweetService.GetTweet(context.Background(), "42")
+		assert.NoError(t, err)
+		assert.Equal(t, "user1", tweet.UserID)
+		assert.Equal(t, "First", tweet.Content)
+	})
+}
@@ -3,10 +3,14 @@ package application
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/freischarler/desafio-twitter/internal/domain"
@@ -19,17 +23,50 @@ type MockDynamoDBClient struct {
 	GetItemFunc    func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
 	UpdateItemFunc func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
 	QueryFunc      func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	DeleteItemFunc func(ctx context.Context, input *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+
+	TransactWriteItemsFunc func(ctx context.Context, input *dynamodb.TransactWriteItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	BatchGetItemFunc       func(ctx context.Context, input *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	BatchWriteItemFunc     func(ctx context.Context, input *dynamodb.BatchWriteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+
+	// jobs holds the Jobs table, so tests need not stub it
+	jobs jobTable
 }
 
 func (m *MockDynamoDBClient) PutItem(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if aws.ToString(input.TableName) == "Jobs" {
+		return m.jobs.put(input)
+	}
 	return m.PutItemFunc(ctx, input, opts...)
 }
 
+// GetItem finds nothing unless GetItemFunc is set, so tests that do not
+// care about follower counts need not stub it
 func (m *MockDynamoDBClient) GetItem(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if aws.ToString(input.TableName) == "Jobs" {
+		return m.jobs.get(input)
+	}
+	if m.GetItemFunc == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
 	return m.GetItemFunc(ctx, input, opts...)
 }
 
+// markDeletedItem marks a tweet of an in-memory Tweets table as deleted,
+// checking the condition of the update like DynamoDB
+func markDeletedItem(tweets map[string]map[string]types.AttributeValue, input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	item, ok := tweets[stringAttr(input.Key, "TweetID")]
+	if !ok || isDeletedItem(item) || stringAttr(item, "UserID") != stringAttr(input.ExpressionAttributeValues, ":userID") {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	item["Deleted"] = input.ExpressionAttributeValues[":true"]
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
 func (m *MockDynamoDBClient) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if aws.ToString(input.TableName) == "Jobs" {
+		return m.jobs.update(input)
+	}
 	return m.UpdateItemFunc(ctx, input, opts...)
 }
 
@@ -37,19 +74,206 @@ func (m *MockDynamoDBClient) Query(ctx context.Context, input *dynamodb.QueryInp
 	return m.QueryFunc(ctx, input, opts...)
 }
 
+func (m *MockDynamoDBClient) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if aws.ToString(input.TableName) == "Jobs" {
+		return m.jobs.delete(input)
+	}
+	return m.DeleteItemFunc(ctx, input, opts...)
+}
+
+// Scan only scans the Jobs table
+func (m *MockDynamoDBClient) Scan(ctx context.Context, input *dynamodb.ScanInput, opts ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return m.jobs.scan(input)
+}
+
+// TransactWriteItems calls TransactWriteItemsFunc if set. Otherwise it
+// writes the items one by one through the other funcs, so tests that do not
+// care about transactions see every write; a failed condition cancels the
+// transaction like DynamoDB does, but earlier writes are not undone.
+func (m *MockDynamoDBClient) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if m.TransactWriteItemsFunc != nil {
+		return m.TransactWriteItemsFunc(ctx, input, opts...)
+	}
+
+	for i, item := range input.TransactItems {
+		var err error
+		switch {
+		case item.Put != nil:
+			_, err = m.PutItem(ctx, &dynamodb.PutItemInput{
+				TableName:                 item.Put.TableName,
+				Item:                      item.Put.Item,
+				ConditionExpression:       item.Put.ConditionExpression,
+				ExpressionAttributeNames:  item.Put.ExpressionAttributeNames,
+				ExpressionAttributeValues: item.Put.ExpressionAttributeValues,
+			})
+		case item.Update != nil:
+			_, err = m.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName:                 item.Update.TableName,
+				Key:                       item.Update.Key,
+				UpdateExpression:          item.Update.UpdateExpression,
+				ConditionExpression:       item.Update.ConditionExpression,
+				ExpressionAttributeNames:  item.Update.ExpressionAttributeNames,
+				ExpressionAttributeValues: item.Update.ExpressionAttributeValues,
+			})
+		case item.Delete != nil:
+			_, err = m.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+				TableName:                 item.Delete.TableName,
+				Key:                       item.Delete.Key,
+				ConditionExpression:       item.Delete.ConditionExpression,
+				ExpressionAttributeNames:  item.Delete.ExpressionAttributeNames,
+				ExpressionAttributeValues: item.Delete.ExpressionAttributeValues,
+			})
+		}
+
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			reasons := make([]types.CancellationReason, len(input.TransactItems))
+			for j := range reasons {
+				reasons[j].Code = aws.String("None")
+			}
+			reasons[i].Code = aws.String("ConditionalCheckFailed")
+			return nil, &types.TransactionCanceledException{CancellationReasons: reasons}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+// BatchGetItem calls BatchGetItemFunc if set. Otherwise it reads the keys
+// one by one through GetItem, so tests that do not care about batching see
+// every read.
+func (m *MockDynamoDBClient) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	if m.BatchGetItemFunc != nil {
+		return m.BatchGetItemFunc(ctx, input, opts...)
+	}
+
+	responses := make(map[string][]map[string]types.AttributeValue)
+	for table, request := range input.RequestItems {
+		for _, key := range request.Keys {
+			result, err := m.GetItem(ctx, &dynamodb.GetItemInput{
+				TableName: aws.String(table),
+				Key:       key,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if result.Item != nil {
+				// DynamoDB always returns the key attributes
+				item := make(map[string]types.AttributeValue, len(result.Item)+len(key))
+				for name, value := range result.Item {
+					item[name] = value
+				}
+				for name, value := range key {
+					item[name] = value
+				}
+				responses[table] = append(responses[table], item)
+			}
+		}
+	}
+	return &dynamodb.BatchGetItemOutput{Responses: responses}, nil
+}
+
+// BatchWriteItem calls BatchWriteItemFunc if set. Otherwise it writes the
+// items one by one through PutItem and DeleteItem, so tests that do not care
+// about batching see every write.
+func (m *MockDynamoDBClient) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	if m.BatchWriteItemFunc != nil {
+		return m.BatchWriteItemFunc(ctx, input, opts...)
+	}
+
+	for table, requests := range input.RequestItems {
+		for _, request := range requests {
+			var err error
+			switch {
+			case request.PutRequest != nil:
+				_, err = m.PutItem(ctx, &dynamodb.PutItemInput{
+					TableName: aws.String(table),
+					Item:      request.PutRequest.Item,
+				})
+			case request.DeleteRequest != nil:
+				_, err = m.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+					TableName: aws.String(table),
+					Key:       request.DeleteRequest.Key,
+				})
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
 type MockRedisClient struct {
-	GetFunc func(ctx context.Context, key string) *redis.StringCmd
-	SetFunc func(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	GetFunc   func(ctx context.Context, key string) *redis.StringCmd
+	SetFunc   func(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNXFunc func(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	DelFunc   func(ctx context.Context, keys ...string) *redis.IntCmd
+	MGetFunc  func(ctx context.Context, keys ...string) *redis.SliceCmd
+	EvalFunc  func(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
 }
 
+// Get misses every key unless GetFunc is set
 func (m *MockRedisClient) Get(ctx context.Context, key string) *redis.StringCmd {
+	if m.GetFunc == nil {
+		return redis.NewStringResult("", redis.Nil)
+	}
 	return m.GetFunc(ctx, key)
 }
 
+// Set succeeds without storing anything unless SetFunc is set, so tests that
+// do not care about the tweet cache need not stub it
 func (m *MockRedisClient) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	if m.SetFunc == nil {
+		return redis.NewStatusResult("OK", nil)
+	}
 	return m.SetFunc(ctx, key, value, expiration)
 }
 
+// SetNX stores through Set unless SetNXFunc is set, so tests that do not
+// care about tombstones see every cached tweet
+func (m *MockRedisClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	if m.SetNXFunc == nil {
+		return redis.NewBoolResult(true, m.Set(ctx, key, value, expiration).Err())
+	}
+	return m.SetNXFunc(ctx, key, value, expiration)
+}
+
+// Del succeeds without deleting anything unless DelFunc is set
+func (m *MockRedisClient) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	if m.DelFunc == nil {
+		return redis.NewIntResult(0, nil)
+	}
+	return m.DelFunc(ctx, keys...)
+}
+
+// MGet reports every key as missing unless MGetFunc is set, so tests that do
+// not care about the tweet cache need not stub it
+func (m *MockRedisClient) MGet(ctx context.Context, keys ...string) *redis.SliceCmd {
+	if m.MGetFunc == nil {
+		return redis.NewSliceResult(make([]interface{}, len(keys)), nil)
+	}
+	return m.MGetFunc(ctx, keys...)
+}
+
+// redisValue formats a value the way Redis stores it
+func redisValue(value interface{}) string {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
+
+// Eval runs nothing unless EvalFunc is set, as if every count it updates
+// were not cached
+func (m *MockRedisClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	if m.EvalFunc == nil {
+		return redis.NewCmdResult(nil, redis.Nil)
+	}
+	return m.EvalFunc(ctx, script, keys, args...)
+}
+
 func TestPostTweet(t *testing.T) {
 	mockDynamoDBClient := &MockDynamoDBClient{
 		PutItemFunc: func(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
@@ -58,6 +282,9 @@ func TestPostTweet(t *testing.T) {
 		UpdateItemFunc: func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 			return &dynamodb.UpdateItemOutput{}, nil
 		},
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			return &dynamodb.QueryOutput{}, nil
+		},
 	}
 	mockRedisClient := &MockRedisClient{
 		GetFunc: func(ctx context.Context, key string) *redis.StringCmd {
@@ -71,23 +298,161 @@ func TestPostTweet(t *testing.T) {
 	service := NewDynamoRedisTweetService(mockDynamoDBClient, mockRedisClient)
 
 	t.Run("should post tweet successfully", func(t *testing.T) {
-		tweetID, err := service.PostTweet("1", "Hello World")
+		tweetID, err := service.PostTweet(context.Background(), "1", "Hello World")
 		assert.NoError(t, err)
 		assert.NotEmpty(t, tweetID)
 	})
 
 	t.Run("should return error if tweet is too long", func(t *testing.T) {
-		longTweet := make([]byte, MaxTweetLength+1)
-		tweetID, err := service.PostTweet("1", string(longTweet))
+		longTweet := strings.Repeat("a", domain.MaxTweetLength+1)
+		tweetID, err := service.PostTweet(context.Background(), "1", longTweet)
 		assert.Error(t, err)
-		assert.Equal(t, domain.ErrTweetTooLong, err)
+		assert.ErrorIs(t, err, domain.ErrTweetTooLong)
 		assert.Empty(t, tweetID)
 	})
+
+	t.Run("should accept a tweet of emoji up to the maximum length", func(t *testing.T) {
+		tweetID, err := service.PostTweet(context.Background(), "1", strings.Repeat("👍🏽", domain.MaxTweetLength))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, tweetID)
+	})
+
+	t.Run("should return error if tweet is blank", func(t *testing.T) {
+		tweetID, err := service.PostTweet(context.Background(), "1", " \n\t ")
+		assert.ErrorIs(t, err, domain.ErrTweetEmpty)
+		assert.Empty(t, tweetID)
+	})
+}
+
+// fixedIDGenerator generates the same ID every time
+type fixedIDGenerator struct {
+	id int64
+}
+
+func (g fixedIDGenerator) Next() (int64, error) {
+	return g.id, nil
+}
+
+func TestPostTweetDuplicateID(t *testing.T) {
+	tweets := map[string]map[string]types.AttributeValue{}
+	mockDynamoDBClient := &MockDynamoDBClient{
+		PutItemFunc: func(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			if aws.ToString(input.TableName) != "Tweets" {
+				return &dynamodb.PutItemOutput{}, nil
+			}
+			tweetID := input.Item["TweetID"].(*types.AttributeValueMemberS).Value
+			if _, exists := tweets[tweetID]; exists && aws.ToString(input.ConditionExpression) == "attribute_not_exists(TweetID)" {
+				return nil, &types.ConditionalCheckFailedException{}
+			}
+			tweets[tweetID] = input.Item
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		UpdateItemFunc: func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			return &dynamodb.QueryOutput{}, nil
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, &MockRedisClient{})
+	service.IDs = fixedIDGenerator{id: 42}
+
+	t.Run("should use the ID from the generator", func(t *testing.T) {
+		tweetID, err := service.PostTweet(context.Background(), "1", "First")
+		assert.NoError(t, err)
+		assert.Equal(t, "42", tweetID)
+	})
+
+	t.Run("should not overwrite a tweet with a duplicate ID", func(t *testing.T) {
+		_, err := service.PostTweet(context.Background(), "2", "Second")
+		assert.ErrorIs(t, err, domain.ErrDuplicateTweetID)
+		assert.Equal(t, "First", tweets["42"]["Content"].(*types.AttributeValueMemberS).Value)
+	})
+}
+
+func TestPostTweetFanOut(t *testing.T) {
+	homeTimelines := map[string]string{}
+	mockDynamoDBClient := &MockDynamoDBClient{
+		PutItemFunc: func(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			if *input.TableName == "HomeTimelines" {
+				userID := input.Item["UserID"].(*types.AttributeValueMemberS).Value
+				homeTimelines[userID] = input.Item["TweetID"].(*types.AttributeValueMemberN).Value
+			}
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		UpdateItemFunc: func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			return &dynamodb.QueryOutput{
+				Items: []map[string]types.AttributeValue{
+					{
+						"UserID":     &types.AttributeValueMemberS{Value: "2"},
+						"FolloweeID": &types.AttributeValueMemberS{Value: "1"},
+					},
+					{
+						"UserID":     &types.AttributeValueMemberS{Value: "3"},
+						"FolloweeID": &types.AttributeValueMemberS{Value: "1"},
+					},
+				},
+			}, nil
+		},
+	}
+
+	cachedTimelines := map[string][]domain.Tweet{
+		"2": {{TweetID: "1", UserID: "4", Content: "Older tweet", Timestamp: 1}},
+	}
+	mockRedisClient := &MockRedisClient{
+		GetFunc: func(ctx context.Context, key string) *redis.StringCmd {
+			timeline, ok := cachedTimelines[key[len("timeline:"):]]
+			if !ok {
+				return redis.NewStringResult("", redis.Nil)
+			}
+			timelineJSON, _ := json.Marshal(timeline)
+			return redis.NewStringResult(string(timelineJSON), nil)
+		},
+		SetFunc: func(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+			var timeline []domain.Tweet
+			json.Unmarshal(value.([]byte), &timeline)
+			cachedTimelines[key[len("timeline:"):]] = timeline
+			return redis.NewStatusResult("", nil)
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, mockRedisClient)
+
+	tweetID, err := service.PostTweet(context.Background(), "1", "Hello followers")
+	assert.NoError(t, err)
+
+	t.Run("should leave the followers to a background job", func(t *testing.T) {
+		assert.Equal(t, map[string]string{"1": tweetID}, homeTimelines)
+		assert.Equal(t, 1, mockDynamoDBClient.jobs.len())
+	})
+
+	assert.NoError(t, service.runPendingJobs(context.Background()))
+
+	t.Run("should write the tweet to every follower's home timeline and the author's", func(t *testing.T) {
+		assert.Equal(t, map[string]string{"1": tweetID, "2": tweetID, "3": tweetID}, homeTimelines)
+	})
+
+	t.Run("should update cached follower timelines only", func(t *testing.T) {
+		assert.Len(t, cachedTimelines, 1)
+		assert.Len(t, cachedTimelines["2"], 2)
+		assert.Equal(t, tweetID, cachedTimelines["2"][0].TweetID)
+		assert.Equal(t, "Hello followers", cachedTimelines["2"][0].Content)
+	})
 }
 
 func TestGetTweet(t *testing.T) {
+	dynamoReads := 0
+	var duringRead func()
 	mockDynamoDBClient := &MockDynamoDBClient{
 		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			dynamoReads++
+			if duringRead != nil {
+				duringRead()
+			}
 			if input.Key["TweetID"].(*types.AttributeValueMemberS).Value == "1" {
 				return &dynamodb.GetItemOutput{
 					Item: map[string]types.AttributeValue{
@@ -101,26 +466,241 @@ func TestGetTweet(t *testing.T) {
 			return &dynamodb.GetItemOutput{}, nil
 		},
 	}
-	mockRedisClient := &MockRedisClient{}
+	cache := map[string]string{}
+	mockRedisClient := &MockRedisClient{
+		GetFunc: func(ctx context.Context, key string) *redis.StringCmd {
+			value, ok := cache[key]
+			if !ok {
+				return redis.NewStringResult("", redis.Nil)
+			}
+			return redis.NewStringResult(value, nil)
+		},
+		SetFunc: func(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+			cache[key] = redisValue(value)
+			return redis.NewStatusResult("OK", nil)
+		},
+		SetNXFunc: func(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+			if _, ok := cache[key]; ok {
+				return redis.NewBoolResult(false, nil)
+			}
+			cache[key] = redisValue(value)
+			return redis.NewBoolResult(true, nil)
+		},
+	}
+
+	mockRedisClient.MGetFunc = func(ctx context.Context, keys ...string) *redis.SliceCmd {
+		values := make([]interface{}, len(keys))
+		for i, key := range keys {
+			if value, ok := cache[key]; ok {
+				values[i] = value
+			}
+		}
+		return redis.NewSliceResult(values, nil)
+	}
 
 	service := NewDynamoRedisTweetService(mockDynamoDBClient, mockRedisClient)
 
 	t.Run("should get tweet successfully", func(t *testing.T) {
-		tweet, err := service.GetTweet("1")
+		tweet, err := service.GetTweet(context.Background(), "1")
 		assert.NoError(t, err)
 		assert.Equal(t, "1", tweet.TweetID)
 		assert.Equal(t, "1", tweet.UserID)
 		assert.Equal(t, "Hello World", tweet.Content)
 	})
 
+	t.Run("should read a cached tweet without hitting DynamoDB", func(t *testing.T) {
+		dynamoReads = 0
+		tweet, err := service.GetTweet(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello World", tweet.Content)
+		assert.Equal(t, 0, dynamoReads)
+		assert.Contains(t, cache, "tweet:json:1")
+	})
+
+	t.Run("should update the cached counts instead of invalidating the tweet", func(t *testing.T) {
+		mockDynamoDBClient.UpdateItemFunc = func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			return &dynamodb.UpdateItemOutput{}, nil
+		}
+		mockRedisClient.EvalFunc = func(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+			count, _ := strconv.ParseInt(cache[keys[0]], 10, 64)
+			cache[keys[0]] = strconv.FormatInt(count+int64(args[0].(int)), 10)
+			return redis.NewCmdResult(count, nil)
+		}
+		cached := cache[tweetCacheKey("1")]
+
+		dynamoReads = 0
+		assert.NoError(t, service.incrementCounter(context.Background(), "1", "RetweetCount", 1))
+		tweet, err := service.GetTweet(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), tweet.RetweetCount)
+		assert.Equal(t, cached, cache[tweetCacheKey("1")])
+		assert.Equal(t, 0, dynamoReads)
+	})
+
+	t.Run("should read the tweet again after it is invalidated", func(t *testing.T) {
+		dynamoReads = 0
+		assert.NoError(t, service.invalidateTweet(context.Background(), "1"))
+		_, err := service.GetTweet(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, dynamoReads)
+	})
+
+	t.Run("should not cache a copy read before the tweet changed", func(t *testing.T) {
+		delete(cache, tweetCacheKey("1"))
+		duringRead = func() {
+			assert.NoError(t, service.invalidateTweet(context.Background(), "1"))
+		}
+		_, err := service.GetTweet(context.Background(), "1")
+		duringRead = nil
+		assert.NoError(t, err)
+		assert.Equal(t, tweetTombstone, cache[tweetCacheKey("1")])
+	})
+
 	t.Run("should return error if tweet not found", func(t *testing.T) {
-		tweet, err := service.GetTweet("2")
+		tweet, err := service.GetTweet(context.Background(), "2")
 		assert.Error(t, err)
 		assert.Equal(t, domain.ErrTweetNotFound, err)
 		assert.Empty(t, tweet.TweetID)
 	})
 }
 
+func TestDeleteTweet(t *testing.T) {
+	tweets := map[string]map[string]types.AttributeValue{
+		"10": {
+			"TweetID":   &types.AttributeValueMemberS{Value: "10"},
+			"UserID":    &types.AttributeValueMemberS{Value: "1"},
+			"Content":   &types.AttributeValueMemberS{Value: "Hello World"},
+			"Timestamp": &types.AttributeValueMemberN{Value: "10"},
+		},
+	}
+	var deletedHomeTweets []string
+	var updatedTables []string
+	var homeTimelineErr error
+	followerQueries := 0
+	mockDynamoDBClient := &MockDynamoDBClient{
+		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: tweets[input.Key["TweetID"].(*types.AttributeValueMemberS).Value]}, nil
+		},
+		DeleteItemFunc: func(ctx context.Context, input *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+			switch *input.TableName {
+			case "Tweets":
+				delete(tweets, input.Key["TweetID"].(*types.AttributeValueMemberS).Value)
+			case "HomeTimelines":
+				if homeTimelineErr != nil {
+					return nil, homeTimelineErr
+				}
+				deletedHomeTweets = append(deletedHomeTweets, input.Key["UserID"].(*types.AttributeValueMemberS).Value)
+			}
+			return &dynamodb.DeleteItemOutput{}, nil
+		},
+		UpdateItemFunc: func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			if aws.ToString(input.UpdateExpression) == "SET Deleted = :true" {
+				return markDeletedItem(tweets, input)
+			}
+			updatedTables = append(updatedTables, *input.TableName)
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			if *input.TableName == "Retweets" {
+				return &dynamodb.QueryOutput{}, nil
+			}
+			followerQueries++
+			return &dynamodb.QueryOutput{
+				Items: []map[string]types.AttributeValue{
+					{"UserID": &types.AttributeValueMemberS{Value: "2"}, "FolloweeID": &types.AttributeValueMemberS{Value: "1"}},
+				},
+			}, nil
+		},
+	}
+	var deletedKeys []string
+	tombstones := map[string]string{}
+	mockRedisClient := &MockRedisClient{
+		SetFunc: func(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+			if expiration == tweetTombstoneTTL {
+				tombstones[key] = fmt.Sprint(value)
+			}
+			return redis.NewStatusResult("OK", nil)
+		},
+		DelFunc: func(ctx context.Context, keys ...string) *redis.IntCmd {
+			deletedKeys = append(deletedKeys, keys...)
+			return redis.NewIntResult(int64(len(keys)), nil)
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, mockRedisClient)
+
+	t.Run("should not let other users delete the tweet", func(t *testing.T) {
+		err := service.DeleteTweet(context.Background(), "2", "10")
+		assert.Equal(t, domain.ErrNotTweetOwner, err)
+		assert.Contains(t, tweets, "10")
+	})
+
+	t.Run("should hide the tweet at once and clean up after it in the background", func(t *testing.T) {
+		err := service.DeleteTweet(context.Background(), "1", "10")
+		assert.NoError(t, err)
+		assert.Contains(t, tweets["10"], "Deleted")
+		assert.Equal(t, map[string]string{"tweet:json:10": tweetTombstone}, tombstones)
+
+		_, err = service.GetTweet(context.Background(), "10")
+		assert.Equal(t, domain.ErrTweetNotFound, err)
+		err = service.DeleteTweet(context.Background(), "1", "10")
+		assert.Equal(t, domain.ErrTweetNotFound, err)
+
+		runAllJobs(t, service)
+		assert.NotContains(t, tweets, "10")
+		// The author's tweets are an index of Tweets, so they need no update
+		assert.Empty(t, updatedTables)
+		assert.Equal(t, []string{"2", "1"}, deletedHomeTweets)
+		assert.Equal(t, []string{"timeline:2", "timeline:1"}, deletedKeys[:2])
+	})
+
+	t.Run("should resume a cleanup that failed", func(t *testing.T) {
+		lease := jobLease
+		t.Cleanup(func() { jobLease = lease })
+		// The lease of the failed job expires right away
+		jobLease = 0
+
+		tweets["11"] = map[string]types.AttributeValue{
+			"TweetID":   &types.AttributeValueMemberS{Value: "11"},
+			"UserID":    &types.AttributeValueMemberS{Value: "1"},
+			"Content":   &types.AttributeValueMemberS{Value: "Hello again"},
+			"Timestamp": &types.AttributeValueMemberN{Value: "11"},
+		}
+		deletedHomeTweets = nil
+		homeTimelineErr = errors.New("throttled")
+
+		err := service.DeleteTweet(context.Background(), "1", "11")
+		assert.NoError(t, err)
+		assert.NoError(t, service.runPendingJobs(context.Background()))
+		assert.Contains(t, tweets, "11")
+		assert.Equal(t, 1, mockDynamoDBClient.jobs.len())
+
+		homeTimelineErr = nil
+		runAllJobs(t, service)
+		assert.NotContains(t, tweets, "11")
+		assert.Equal(t, []string{"2", "1"}, deletedHomeTweets)
+	})
+
+	t.Run("should only remove a celebrity tweet from its author's timeline", func(t *testing.T) {
+		tweets["12"] = map[string]types.AttributeValue{
+			"TweetID":      &types.AttributeValueMemberS{Value: "12"},
+			"UserID":       &types.AttributeValueMemberS{Value: "1"},
+			"Content":      &types.AttributeValueMemberS{Value: "Hello fans"},
+			"Timestamp":    &types.AttributeValueMemberN{Value: "12"},
+			"NotFannedOut": &types.AttributeValueMemberBOOL{Value: true},
+		}
+		deletedHomeTweets = nil
+		followerQueries = 0
+
+		err := service.DeleteTweet(context.Background(), "1", "12")
+		assert.NoError(t, err)
+		runAllJobs(t, service)
+		assert.NotContains(t, tweets, "12")
+		assert.Equal(t, []string{"1"}, deletedHomeTweets)
+		assert.Zero(t, followerQueries)
+	})
+}
+
 func TestGetTimeline(t *testing.T) {
 	mockDynamoDBClient := &MockDynamoDBClient{
 		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
@@ -128,10 +708,6 @@ func TestGetTimeline(t *testing.T) {
 				return &dynamodb.GetItemOutput{
 					Item: map[string]types.AttributeValue{
 						"UserID": &types.AttributeValueMemberS{Value: "1"},
-						"Tweets": &types.AttributeValueMemberL{Value: []types.AttributeValue{
-							&types.AttributeValueMemberS{Value: "1"},
-							&types.AttributeValueMemberS{Value: "2"},
-						}},
 					},
 				}, nil
 			}
@@ -192,7 +768,8 @@ func TestGetTimeline(t *testing.T) {
 			return redis.NewStringResult(string(tweetsJSON), nil)
 		}
 
-		timeline, err := service.GetTimeline("1")
+		page, err := service.GetTimeline(context.Background(), "1", domain.PageRequest{})
+		timeline := page.Tweets
 		assert.NoError(t, err)
 		assert.Len(t, timeline, 2)
 		assert.Equal(t, "1", timeline[0].TweetID)
@@ -208,12 +785,12 @@ func TestGetTimeline(t *testing.T) {
 			return &dynamodb.GetItemOutput{
 				Item: map[string]types.AttributeValue{
 					"UserID": &types.AttributeValueMemberS{Value: "1"},
-					"Tweets": &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
 				},
 			}, nil
 		}
 
-		timeline, err := service.GetTimeline("1")
+		page, err := service.GetTimeline(context.Background(), "1", domain.PageRequest{})
+		timeline := page.Tweets
 		assert.NoError(t, err)
 		assert.Empty(t, timeline)
 	})
@@ -228,7 +805,8 @@ func TestGetTimeline(t *testing.T) {
 			return redis.NewStringResult(string(tweetsJSON), nil)
 		}
 
-		timeline, err := service.GetTimeline("1")
+		page, err := service.GetTimeline(context.Background(), "1", domain.PageRequest{})
+		timeline := page.Tweets
 		assert.NoError(t, err)
 		assert.Len(t, timeline, 2)
 		assert.Equal(t, "1", timeline[0].TweetID)
@@ -240,47 +818,17 @@ func TestGetTimeline(t *testing.T) {
 			return redis.NewStringResult("", redis.Nil)
 		}
 
-		mockDynamoDBClient.GetItemFunc = func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
-			if input.TableName != nil && *input.TableName == "UserTimelines" {
-				if input.Key["UserID"].(*types.AttributeValueMemberS).Value == "1" {
-					return &dynamodb.GetItemOutput{
-						Item: map[string]types.AttributeValue{
-							"UserID": &types.AttributeValueMemberS{Value: "1"},
-							"Tweets": &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
-						},
-					}, nil
-				}
-				if input.Key["UserID"].(*types.AttributeValueMemberS).Value == "2" {
-					return &dynamodb.GetItemOutput{
-						Item: map[string]types.AttributeValue{
-							"UserID": &types.AttributeValueMemberS{Value: "2"},
-							"Tweets": &types.AttributeValueMemberL{Value: []types.AttributeValue{
-								&types.AttributeValueMemberS{Value: "1"},
-							}},
-						},
-					}, nil
-				}
-			}
-			if input.Key["TweetID"].(*types.AttributeValueMemberS).Value == "1" {
-				return &dynamodb.GetItemOutput{
-					Item: map[string]types.AttributeValue{
-						"TweetID":   &types.AttributeValueMemberS{Value: "1"},
-						"UserID":    &types.AttributeValueMemberS{Value: "2"},
-						"Content":   &types.AttributeValueMemberS{Value: "Hello World"},
-						"Timestamp": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().UnixNano(), 10)},
-					},
-				}, nil
-			}
-			return &dynamodb.GetItemOutput{}, nil
-		}
-
 		mockDynamoDBClient.QueryFunc = func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
-			if *input.TableName == "UserFollowers" {
+			if *input.TableName == "HomeTimelines" {
+				assert.Equal(t, "1", input.ExpressionAttributeValues[":userID"].(*types.AttributeValueMemberS).Value)
 				return &dynamodb.QueryOutput{
 					Items: []map[string]types.AttributeValue{
 						{
-							"UserID":     &types.AttributeValueMemberS{Value: "1"},
-							"FolloweeID": &types.AttributeValueMemberS{Value: "2"},
+							"UserID":    &types.AttributeValueMemberS{Value: "1"},
+							"TweetID":   &types.AttributeValueMemberN{Value: "1"},
+							"AuthorID":  &types.AttributeValueMemberS{Value: "2"},
+							"Content":   &types.AttributeValueMemberS{Value: "Hello World"},
+							"Timestamp": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().UnixNano(), 10)},
 						},
 					},
 				}, nil
@@ -288,9 +836,64 @@ func TestGetTimeline(t *testing.T) {
 			return &dynamodb.QueryOutput{}, nil
 		}
 
-		timeline, err := service.GetTimeline("1")
+		page, err := service.GetTimeline(context.Background(), "1", domain.PageRequest{})
+		timeline := page.Tweets
 		assert.NoError(t, err)
 		assert.Len(t, timeline, 1)
 		assert.Equal(t, "1", timeline[0].TweetID)
+		assert.Equal(t, "2", timeline[0].UserID)
+		assert.Equal(t, "Hello World", timeline[0].Content)
+	})
+
+	t.Run("should query pages past the cached tweets from DynamoDB", func(t *testing.T) {
+		cached := make([]domain.Tweet, 0, timelineCacheSize)
+		for id := 1000; len(cached) < timelineCacheSize; id-- {
+			cached = append(cached, domain.Tweet{TweetID: strconv.Itoa(id), UserID: "2", Timestamp: int64(id)})
+		}
+		mockRedisClient.GetFunc = func(ctx context.Context, key string) *redis.StringCmd {
+			cachedJSON, _ := json.Marshal(cached)
+			return redis.NewStringResult(string(cachedJSON), nil)
+		}
+
+		var queries []*dynamodb.QueryInput
+		mockDynamoDBClient.QueryFunc = func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			if *input.TableName != "HomeTimelines" {
+				return &dynamodb.QueryOutput{}, nil
+			}
+			queries = append(queries, input)
+			return &dynamodb.QueryOutput{
+				Items: []map[string]types.AttributeValue{
+					{
+						"UserID":    &types.AttributeValueMemberS{Value: "1"},
+						"TweetID":   &types.AttributeValueMemberN{Value: "800"},
+						"AuthorID":  &types.AttributeValueMemberS{Value: "2"},
+						"Content":   &types.AttributeValueMemberS{Value: "Hello World"},
+						"Timestamp": &types.AttributeValueMemberN{Value: "800"},
+					},
+				},
+			}, nil
+		}
+
+		t.Run("should serve cached pages from Redis", func(t *testing.T) {
+			page, err := service.GetTimeline(context.Background(), "1", domain.PageRequest{Limit: 2, Cursor: domain.EncodeCursor("900")})
+			assert.NoError(t, err)
+			assert.Equal(t, "899", page.Tweets[0].TweetID)
+			assert.Equal(t, "898", page.Tweets[1].TweetID)
+			assert.Equal(t, domain.EncodeCursor("898"), page.NextCursor)
+			assert.Empty(t, queries)
+		})
+
+		t.Run("should query DynamoDB past the oldest cached tweet", func(t *testing.T) {
+			page, err := service.GetTimeline(context.Background(), "1", domain.PageRequest{Limit: 1, Cursor: domain.EncodeCursor("801")})
+			assert.NoError(t, err)
+			assert.Len(t, page.Tweets, 1)
+			assert.Equal(t, "800", page.Tweets[0].TweetID)
+			assert.Equal(t, domain.EncodeCursor("800"), page.NextCursor)
+
+			assert.Len(t, queries, 1)
+			assert.Equal(t, "800", queries[0].ExpressionAttributeValues[":maxID"].(*types.AttributeValueMemberN).Value)
+			assert.Equal(t, "1", queries[0].ExpressionAttributeValues[":minID"].(*types.AttributeValueMemberN).Value)
+			assert.Equal(t, int32(1), *queries[0].Limit)
+		})
 	})
 }
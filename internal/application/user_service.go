@@ -2,58 +2,174 @@ package application
 
 import (
 	"context"
-	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-)
-
-var (
-	ErrCannotFollowSelf = errors.New("cannot follow self")
+	"github.com/freischarler/desafio-twitter/internal/domain"
 )
 
 // DynamoDBUserService handles user-related operations using DynamoDB
 type DynamoDBUserService struct {
 	DynamoDBClient DynamoDBClient
-	Ctx            context.Context
+	RedisClient    RedisClient
+	Timeouts       Timeouts
+
+	// IDs generates the IDs of new users
+	IDs IDGenerator
+
+	// FollowersIndexReady, when set, reports whether the UserFollowers index
+	// of followers is built; until then followers cannot be listed. Nil
+	// means the index is built.
+	FollowersIndexReady *atomic.Bool
 }
 
-// NewDynamoDBUserService creates a new UserService with a DynamoDB client
-func NewDynamoDBUserService(client DynamoDBClient) *DynamoDBUserService {
+// NewDynamoDBUserService creates a new UserService with a DynamoDB client and
+// the Redis client caching timelines
+func NewDynamoDBUserService(client DynamoDBClient, redisClient RedisClient) *DynamoDBUserService {
 	return &DynamoDBUserService{
 		DynamoDBClient: client,
-		Ctx:            context.TODO(),
+		RedisClient:    redisClient,
+		Timeouts:       DefaultTimeouts,
+		IDs:            defaultIDs,
 	}
 }
 
 // FollowUser allows a user to follow another user
-func (s *DynamoDBUserService) FollowUser(followerID, followeeID string) error {
+func (s *DynamoDBUserService) FollowUser(ctx context.Context, followerID, followeeID string) error {
+	ctx, cancel := s.Timeouts.write(ctx)
+	defer cancel()
+
 	if followerID == followeeID {
-		return ErrCannotFollowSelf
+		return domain.ErrCannotFollowSelf
 	}
 
-	_, err := s.DynamoDBClient.PutItem(s.Ctx, &dynamodb.PutItemInput{
-		TableName: aws.String("UserFollowers"),
-		Item: map[string]types.AttributeValue{
-			"UserID":     &types.AttributeValueMemberS{Value: followerID},
-			"FolloweeID": &types.AttributeValueMemberS{Value: followeeID},
+	err := transactWrite(ctx, s.DynamoDBClient, []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				TableName: aws.String("UserFollowers"),
+				Item: map[string]types.AttributeValue{
+					"UserID":     &types.AttributeValueMemberS{Value: followerID},
+					"FolloweeID": &types.AttributeValueMemberS{Value: followeeID},
+					"FollowedAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().UnixNano(), 10)},
+				},
+				ConditionExpression: aws.String("attribute_not_exists(UserID)"),
+			},
 		},
+		followCountUpdate(followerID, "FollowingCount", 1),
+		followCountUpdate(followeeID, "FollowersCount", 1),
 	})
-	if err != nil {
+	// Following a user again fails the condition and leaves the counts alone
+	if err != nil && cancellationReason(err, 0) != "ConditionalCheckFailed" {
 		return err
 	}
 
-	_, err = s.DynamoDBClient.PutItem(s.Ctx, &dynamodb.PutItemInput{
-		TableName: aws.String("UserFollowers"),
-		Item: map[string]types.AttributeValue{
-			"UserID":     &types.AttributeValueMemberS{Value: followeeID},
-			"FolloweeID": &types.AttributeValueMemberS{Value: followerID},
+	// Tweets of celebrities are merged into the timeline at read time
+	celebrity, err := isCelebrityFlagged(ctx, s.DynamoDBClient, followeeID)
+	if err != nil || !celebrity {
+		return err
+	}
+	return addFollowedCelebrity(ctx, s.DynamoDBClient, followerID, followeeID)
+}
+
+// UnfollowUser allows a user to stop following another user
+func (s *DynamoDBUserService) UnfollowUser(ctx context.Context, followerID, followeeID string) error {
+	ctx, cancel := s.Timeouts.write(ctx)
+	defer cancel()
+
+	if followerID == followeeID {
+		return domain.ErrCannotFollowSelf
+	}
+
+	err := transactWrite(ctx, s.DynamoDBClient, []types.TransactWriteItem{
+		{
+			Delete: &types.Delete{
+				TableName: aws.String("UserFollowers"),
+				Key: map[string]types.AttributeValue{
+					"UserID":     &types.AttributeValueMemberS{Value: followerID},
+					"FolloweeID": &types.AttributeValueMemberS{Value: followeeID},
+				},
+				ConditionExpression: aws.String("attribute_exists(UserID)"),
+			},
 		},
+		followCountUpdate(followerID, "FollowingCount", -1),
+		followCountUpdate(followeeID, "FollowersCount", -1),
 	})
-	if err != nil {
+	// Unfollowing a user who is not followed fails the condition and leaves
+	// the counts alone
+	if err != nil && cancellationReason(err, 0) != "ConditionalCheckFailed" {
 		return err
 	}
 
-	return nil
+	if err := removeFollowedCelebrity(ctx, s.DynamoDBClient, followerID, followeeID); err != nil {
+		return err
+	}
+	return s.removeAuthorFromHomeTimeline(ctx, followerID, followeeID)
+}
+
+// GetFollowers retrieves a page of the users following a user. It returns
+// domain.ErrIndexNotReady while the index of followers is being built.
+func (s *DynamoDBUserService) GetFollowers(ctx context.Context, userID string, page domain.PageRequest) (domain.UserPage, error) {
+	if !indexReady(s.FollowersIndexReady) {
+		return domain.UserPage{}, domain.ErrIndexNotReady
+	}
+
+	ctx, cancel := s.Timeouts.read(ctx)
+	defer cancel()
+
+	return queryFollowersPage(ctx, s.DynamoDBClient, userID, page)
+}
+
+// GetFollowing retrieves a page of the users a user follows
+func (s *DynamoDBUserService) GetFollowing(ctx context.Context, userID string, page domain.PageRequest) (domain.UserPage, error) {
+	ctx, cancel := s.Timeouts.read(ctx)
+	defer cancel()
+
+	return queryFollowingPage(ctx, s.DynamoDBClient, userID, page)
+}
+
+// removeAuthorFromHomeTimeline deletes every tweet of an author from a user's
+// materialized home timeline and drops the user's cached timeline, so the
+// next read no longer shows them
+func (s *DynamoDBUserService) removeAuthorFromHomeTimeline(ctx context.Context, userID, authorID string) error {
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := s.DynamoDBClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String("HomeTimelines"),
+			KeyConditionExpression: aws.String("UserID = :userID"),
+			FilterExpression:       aws.String("AuthorID = :authorID"),
+			ProjectionExpression:   aws.String("TweetID"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":userID":   &types.AttributeValueMemberS{Value: userID},
+				":authorID": &types.AttributeValueMemberS{Value: authorID},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, item := range result.Items {
+			_, err := s.DynamoDBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+				TableName: aws.String("HomeTimelines"),
+				Key: map[string]types.AttributeValue{
+					"UserID":  &types.AttributeValueMemberS{Value: userID},
+					"TweetID": item["TweetID"],
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = result.LastEvaluatedKey
+	}
+
+	return s.RedisClient.Del(ctx, "timeline:"+userID).Err()
 }
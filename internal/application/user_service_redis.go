@@ -2,6 +2,8 @@ package application
 
 import (
 	"context"
+	"strconv"
+	"time"
 
 	"github.com/freischarler/desafio-twitter/internal/domain"
 	"github.com/go-redis/redis/v8"
@@ -10,32 +12,185 @@ import (
 // UserService handles user-related operations
 type RedisUserService struct {
 	RedisClient *redis.Client
-	Ctx         context.Context
 }
 
 // NewRedisUserService creates a new UserService with a Redis client
 func NewRedisUserService(redisClient *redis.Client) *RedisUserService {
 	return &RedisUserService{
 		RedisClient: redisClient,
-		Ctx:         context.Background(),
 	}
 }
 
 // FollowUser allows a user to follow another user
-func (s *RedisUserService) FollowUser(followerID, followeeID string) error {
+func (s *RedisUserService) FollowUser(ctx context.Context, followerID, followeeID string) error {
 	if followerID == followeeID {
 		return domain.ErrCannotFollowSelf
 	}
 
-	err := s.RedisClient.SAdd(s.Ctx, "user:following:"+followerID, followeeID).Err()
+	err := s.RedisClient.SAdd(ctx, "user:following:"+followerID, followeeID).Err()
 	if err != nil {
 		return err
 	}
 
-	err = s.RedisClient.SAdd(s.Ctx, "user:followers:"+followeeID, followerID).Err()
+	err = s.RedisClient.SAdd(ctx, "user:followers:"+followeeID, followerID).Err()
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// UnfollowUser allows a user to stop following another user
+func (s *RedisUserService) UnfollowUser(ctx context.Context, followerID, followeeID string) error {
+	if followerID == followeeID {
+		return domain.ErrCannotFollowSelf
+	}
+
+	err := s.RedisClient.SRem(ctx, "user:following:"+followerID, followeeID).Err()
+	if err != nil {
+		return err
+	}
+
+	err = s.RedisClient.SRem(ctx, "user:followers:"+followeeID, followerID).Err()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetFollowers retrieves a page of the users following a user
+func (s *RedisUserService) GetFollowers(ctx context.Context, userID string, page domain.PageRequest) (domain.UserPage, error) {
+	return s.scanUsers(ctx, "user:followers:"+userID, page)
+}
+
+// GetFollowing retrieves a page of the users a user follows
+func (s *RedisUserService) GetFollowing(ctx context.Context, userID string, page domain.PageRequest) (domain.UserPage, error) {
+	return s.scanUsers(ctx, "user:following:"+userID, page)
+}
+
+// Register creates a user. Handles are claimed with HSETNX on the
+// user:handles hash, so two users can never hold the same handle, regardless
+// of case.
+func (s *RedisUserService) Register(ctx context.Context, registration domain.Registration) (domain.User, error) {
+	registration, err := registration.Validate()
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	passwordHash, err := hashPassword(registration.Password)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	id, err := s.RedisClient.Incr(ctx, "userID:counter").Result()
+	if err != nil {
+		return domain.User{}, err
+	}
+	user := domain.User{
+		ID:          strconv.FormatInt(id, 10),
+		Handle:      registration.Handle,
+		DisplayName: registration.DisplayName,
+		CreatedAt:   time.Now().UnixNano(),
+	}
+
+	claimed, err := s.RedisClient.HSetNX(ctx, "user:handles", domain.NormalizeHandle(user.Handle), user.ID).Result()
+	if err != nil {
+		return domain.User{}, err
+	}
+	if !claimed {
+		return domain.User{}, domain.ErrHandleTaken
+	}
+
+	err = s.RedisClient.HSet(ctx, "user:"+user.ID, map[string]interface{}{
+		"handle":       user.Handle,
+		"displayName":  user.DisplayName,
+		"createdAt":    user.CreatedAt,
+		"passwordHash": passwordHash,
+	}).Err()
+	if err != nil {
+		s.RedisClient.HDel(ctx, "user:handles", domain.NormalizeHandle(user.Handle))
+		return domain.User{}, err
+	}
+
+	return user, nil
+}
+
+// Login returns the user with a handle if the password is theirs
+func (s *RedisUserService) Login(ctx context.Context, handle, password string) (domain.User, error) {
+	var fields map[string]string
+	userID, err := s.RedisClient.HGet(ctx, "user:handles", domain.NormalizeHandle(handle)).Result()
+	if err == nil {
+		fields, err = s.RedisClient.HGetAll(ctx, "user:"+userID).Result()
+	}
+	if err != nil && err != redis.Nil {
+		return domain.User{}, err
+	}
+
+	// Unknown handles still check a password, so they cannot be told apart
+	// from wrong passwords by the time taken
+	if !checkPassword(fields["passwordHash"], password) {
+		return domain.User{}, domain.ErrInvalidCredentials
+	}
+	return redisUser(userID, fields), nil
+}
+
+// GetProfile retrieves a user
+func (s *RedisUserService) GetProfile(ctx context.Context, userID string) (domain.User, error) {
+	fields, err := s.RedisClient.HGetAll(ctx, "user:"+userID).Result()
+	if err != nil {
+		return domain.User{}, err
+	}
+	if len(fields) == 0 {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	return redisUser(userID, fields), nil
+}
+
+// redisUser converts the fields of a user hash into a user
+func redisUser(userID string, fields map[string]string) domain.User {
+	createdAt, _ := strconv.ParseInt(fields["createdAt"], 10, 64)
+	return domain.User{
+		ID:          userID,
+		Handle:      fields["handle"],
+		DisplayName: fields["displayName"],
+		CreatedAt:   createdAt,
+	}
+}
+
+// scanUsers retrieves a page of a set of user IDs with SSCAN. The cursor holds
+// the SSCAN cursor; pages may be slightly larger or smaller than the limit,
+// as SSCAN only takes it as a hint.
+func (s *RedisUserService) scanUsers(ctx context.Context, key string, page domain.PageRequest) (domain.UserPage, error) {
+	var cursor uint64
+	if page.Cursor != "" {
+		value, err := domain.DecodeCursorKey(page.Cursor)
+		if err != nil {
+			return domain.UserPage{}, err
+		}
+		cursor, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return domain.UserPage{}, domain.ErrInvalidCursor
+		}
+	}
+
+	count, err := s.RedisClient.SCard(ctx, key).Result()
+	if err != nil {
+		return domain.UserPage{}, err
+	}
+
+	userIDs, next, err := s.RedisClient.SScan(ctx, key, cursor, "", int64(page.PageSize())).Result()
+	if err != nil {
+		return domain.UserPage{}, err
+	}
+
+	userPage := domain.UserPage{UserIDs: userIDs, Count: count}
+	if userPage.UserIDs == nil {
+		userPage.UserIDs = []string{}
+	}
+	if next != 0 {
+		userPage.NextCursor = domain.EncodeCursor(strconv.FormatUint(next, 10))
+	}
+
+	return userPage, nil
+}
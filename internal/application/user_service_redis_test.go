@@ -1,11 +1,14 @@
 package application
 
 import (
+	"context"
+	"strconv"
 	"testing"
 
 	"github.com/freischarler/desafio-twitter/internal/domain"
 	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestRedisFollowUser(t *testing.T) {
@@ -16,13 +19,129 @@ func TestRedisFollowUser(t *testing.T) {
 	service := NewRedisUserService(mockRedisClient)
 
 	t.Run("should follow user successfully", func(t *testing.T) {
-		err := service.FollowUser("1", "2")
+		err := service.FollowUser(context.Background(), "1", "2")
 		assert.NoError(t, err)
 	})
 
 	t.Run("should return error if user tries to follow self", func(t *testing.T) {
-		err := service.FollowUser("1", "1")
+		err := service.FollowUser(context.Background(), "1", "1")
 		assert.Error(t, err)
 		assert.Equal(t, domain.ErrCannotFollowSelf, err)
 	})
 }
+
+func TestRedisUnfollowUser(t *testing.T) {
+	redisClient := setupTestRedisClient()
+	service := NewRedisUserService(redisClient)
+	tweetService := NewRedisTweetService(redisClient)
+
+	// Clean up Redis database before running the test
+	redisClient.FlushDB(context.Background())
+
+	assert.NoError(t, service.FollowUser(context.Background(), "1", "2"))
+	_, err := tweetService.PostTweet(context.Background(), "2", "Hello from User2!")
+	assert.NoError(t, err)
+
+	page, err := tweetService.GetTimeline(context.Background(), "1", domain.PageRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, page.Tweets, 1)
+
+	t.Run("should stop showing the unfollowed user's tweets", func(t *testing.T) {
+		err := service.UnfollowUser(context.Background(), "1", "2")
+		assert.NoError(t, err)
+
+		page, err := tweetService.GetTimeline(context.Background(), "1", domain.PageRequest{})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Tweets)
+
+		followers, err := redisClient.SMembers(context.Background(), "user:followers:2").Result()
+		assert.NoError(t, err)
+		assert.Empty(t, followers)
+	})
+
+	t.Run("should return error if user tries to unfollow self", func(t *testing.T) {
+		err := service.UnfollowUser(context.Background(), "1", "1")
+		assert.Equal(t, domain.ErrCannotFollowSelf, err)
+	})
+}
+
+func TestRedisGetFollowersAndFollowing(t *testing.T) {
+	redisClient := setupTestRedisClient()
+	service := NewRedisUserService(redisClient)
+
+	// Clean up Redis database before running the test
+	redisClient.FlushDB(context.Background())
+
+	for i := 1; i <= 5; i++ {
+		assert.NoError(t, service.FollowUser(context.Background(), strconv.Itoa(i), "0"))
+	}
+
+	t.Run("should page through followers", func(t *testing.T) {
+		var followers []string
+		page := domain.PageRequest{Limit: 2}
+		for {
+			result, err := service.GetFollowers(context.Background(), "0", page)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(5), result.Count)
+			followers = append(followers, result.UserIDs...)
+			if result.NextCursor == "" {
+				break
+			}
+			page.Cursor = result.NextCursor
+		}
+		assert.ElementsMatch(t, []string{"1", "2", "3", "4", "5"}, followers)
+	})
+
+	t.Run("should list following", func(t *testing.T) {
+		result, err := service.GetFollowing(context.Background(), "1", domain.PageRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"0"}, result.UserIDs)
+		assert.Equal(t, int64(1), result.Count)
+
+		result, err = service.GetFollowing(context.Background(), "0", domain.PageRequest{})
+		assert.NoError(t, err)
+		assert.Empty(t, result.UserIDs)
+		assert.Equal(t, int64(0), result.Count)
+	})
+}
+
+func TestRedisAccounts(t *testing.T) {
+	PasswordCost = bcrypt.MinCost
+	defer func() { PasswordCost = bcrypt.DefaultCost }()
+
+	redisClient := setupTestRedisClient()
+	service := NewRedisUserService(redisClient)
+
+	// Clean up Redis database before running the test
+	redisClient.FlushDB(context.Background())
+
+	user, err := service.Register(context.Background(), domain.Registration{Handle: "ada", DisplayName: " Ada Lovelace ", Password: "correct horse"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Ada Lovelace", user.DisplayName)
+
+	t.Run("should not register a taken handle regardless of case", func(t *testing.T) {
+		_, err := service.Register(context.Background(), domain.Registration{Handle: "Ada", Password: "another horse"})
+		assert.Equal(t, domain.ErrHandleTaken, err)
+	})
+
+	t.Run("should log in with the password of the user", func(t *testing.T) {
+		loggedIn, err := service.Login(context.Background(), "ADA", "correct horse")
+		assert.NoError(t, err)
+		assert.Equal(t, user, loggedIn)
+
+		_, err = service.Login(context.Background(), "ada", "wrong horse")
+		assert.Equal(t, domain.ErrInvalidCredentials, err)
+
+		_, err = service.Login(context.Background(), "grace", "correct horse")
+		assert.Equal(t, domain.ErrInvalidCredentials, err)
+	})
+
+	t.Run("should get the profile of a user", func(t *testing.T) {
+		profile, err := service.GetProfile(context.Background(), user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, user, profile)
+
+		_, err = service.GetProfile(context.Background(), "404")
+		assert.Equal(t, domain.ErrUserNotFound, err)
+	})
+}
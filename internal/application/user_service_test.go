@@ -2,29 +2,254 @@ package application
 
 import (
 	"context"
+	"strconv"
+	"sync/atomic"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestFollowUser(t *testing.T) {
+	var edges []string
 	mockDynamoDBClient := &MockDynamoDBClient{
 		PutItemFunc: func(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			edge := input.Item["UserID"].(*types.AttributeValueMemberS).Value + "->" + input.Item["FolloweeID"].(*types.AttributeValueMemberS).Value
+			for _, existing := range edges {
+				if existing == edge {
+					return nil, &types.ConditionalCheckFailedException{}
+				}
+			}
+			edges = append(edges, edge)
 			return &dynamodb.PutItemOutput{}, nil
 		},
+		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			celebrity := input.Key["UserID"].(*types.AttributeValueMemberS).Value == "star"
+			return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+				"Celebrity": &types.AttributeValueMemberBOOL{Value: celebrity},
+			}}, nil
+		},
+	}
+	var listedCelebrities []string
+	counts := map[string]int64{}
+	mockDynamoDBClient.UpdateItemFunc = func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+		if aws.ToString(input.UpdateExpression) == "ADD #counter :delta" {
+			delta, _ := strconv.ParseInt(input.ExpressionAttributeValues[":delta"].(*types.AttributeValueMemberN).Value, 10, 64)
+			counts[input.Key["UserID"].(*types.AttributeValueMemberS).Value+"."+input.ExpressionAttributeNames["#counter"]] += delta
+			return &dynamodb.UpdateItemOutput{}, nil
+		}
+		assert.Equal(t, "ADD FollowedCelebrities :celebrity", aws.ToString(input.UpdateExpression))
+		listedCelebrities = append(listedCelebrities, input.Key["UserID"].(*types.AttributeValueMemberS).Value+"->"+input.ExpressionAttributeValues[":celebrity"].(*types.AttributeValueMemberSS).Value[0])
+		return &dynamodb.UpdateItemOutput{}, nil
 	}
 
-	service := NewDynamoDBUserService(mockDynamoDBClient)
+	service := NewDynamoDBUserService(mockDynamoDBClient, &MockRedisClient{})
 
 	t.Run("should follow user successfully", func(t *testing.T) {
-		err := service.FollowUser("1", "2")
+		err := service.FollowUser(context.Background(), "1", "2")
+		assert.NoError(t, err)
+	})
+
+	t.Run("should only store the follow in one direction", func(t *testing.T) {
+		assert.Equal(t, []string{"1->2"}, edges)
+		assert.Empty(t, listedCelebrities)
+	})
+
+	t.Run("should count the follow once", func(t *testing.T) {
+		err := service.FollowUser(context.Background(), "1", "2")
 		assert.NoError(t, err)
+		assert.Equal(t, map[string]int64{"1.FollowingCount": 1, "2.FollowersCount": 1}, counts)
+	})
+
+	t.Run("should list a followed celebrity", func(t *testing.T) {
+		err := service.FollowUser(context.Background(), "1", "star")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1->star"}, listedCelebrities)
 	})
 
 	t.Run("should return error if user tries to follow self", func(t *testing.T) {
-		err := service.FollowUser("1", "1")
+		err := service.FollowUser(context.Background(), "1", "1")
 		assert.Error(t, err)
-		assert.Equal(t, ErrCannotFollowSelf, err)
+		assert.Equal(t, domain.ErrCannotFollowSelf, err)
+	})
+}
+
+func TestUnfollowUser(t *testing.T) {
+	var deletedEdges, deletedHomeTweets, unlistedCelebrities, counts []string
+	mockDynamoDBClient := &MockDynamoDBClient{
+		DeleteItemFunc: func(ctx context.Context, input *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+			userID := input.Key["UserID"].(*types.AttributeValueMemberS).Value
+			switch *input.TableName {
+			case "UserFollowers":
+				// User 1 only follows user 2
+				edge := userID + "->" + input.Key["FolloweeID"].(*types.AttributeValueMemberS).Value
+				if edge != "1->2" || len(deletedEdges) > 0 {
+					return nil, &types.ConditionalCheckFailedException{}
+				}
+				deletedEdges = append(deletedEdges, edge)
+			case "HomeTimelines":
+				deletedHomeTweets = append(deletedHomeTweets, userID+":"+input.Key["TweetID"].(*types.AttributeValueMemberN).Value)
+			}
+			return &dynamodb.DeleteItemOutput{}, nil
+		},
+		UpdateItemFunc: func(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			if aws.ToString(input.UpdateExpression) == "ADD #counter :delta" {
+				counts = append(counts, input.Key["UserID"].(*types.AttributeValueMemberS).Value+"."+input.ExpressionAttributeNames["#counter"]+input.ExpressionAttributeValues[":delta"].(*types.AttributeValueMemberN).Value)
+				return &dynamodb.UpdateItemOutput{}, nil
+			}
+			unlistedCelebrities = append(unlistedCelebrities, aws.ToString(input.UpdateExpression))
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			userID := input.ExpressionAttributeValues[":userID"].(*types.AttributeValueMemberS).Value
+			if userID != "1" {
+				return &dynamodb.QueryOutput{}, nil
+			}
+			// Tweets of user 2 in user 1's home timeline, split over two pages
+			if input.ExclusiveStartKey == nil {
+				return &dynamodb.QueryOutput{
+					Items: []map[string]types.AttributeValue{
+						{"TweetID": &types.AttributeValueMemberN{Value: "10"}},
+					},
+					LastEvaluatedKey: map[string]types.AttributeValue{
+						"UserID":  &types.AttributeValueMemberS{Value: "1"},
+						"TweetID": &types.AttributeValueMemberN{Value: "10"},
+					},
+				}, nil
+			}
+			return &dynamodb.QueryOutput{
+				Items: []map[string]types.AttributeValue{
+					{"TweetID": &types.AttributeValueMemberN{Value: "20"}},
+				},
+			}, nil
+		},
+	}
+	var deletedKeys []string
+	mockRedisClient := &MockRedisClient{
+		DelFunc: func(ctx context.Context, keys ...string) *redis.IntCmd {
+			deletedKeys = append(deletedKeys, keys...)
+			return redis.NewIntResult(int64(len(keys)), nil)
+		},
+	}
+
+	service := NewDynamoDBUserService(mockDynamoDBClient, mockRedisClient)
+
+	t.Run("should unfollow user successfully", func(t *testing.T) {
+		err := service.UnfollowUser(context.Background(), "1", "2")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1->2"}, deletedEdges)
+	})
+
+	t.Run("should remove the unfollowed user's tweets from the home timeline", func(t *testing.T) {
+		assert.Equal(t, []string{"1:10", "1:20"}, deletedHomeTweets)
+	})
+
+	t.Run("should invalidate cached timelines", func(t *testing.T) {
+		assert.Equal(t, []string{"timeline:1"}, deletedKeys)
+	})
+
+	t.Run("should remove the unfollowed user from the followed celebrities", func(t *testing.T) {
+		assert.Equal(t, []string{"DELETE FollowedCelebrities :celebrity"}, unlistedCelebrities)
+	})
+
+	t.Run("should only count unfollows of followed users", func(t *testing.T) {
+		err := service.UnfollowUser(context.Background(), "1", "2")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1.FollowingCount-1", "2.FollowersCount-1"}, counts)
+	})
+
+	t.Run("should return error if user tries to unfollow self", func(t *testing.T) {
+		err := service.UnfollowUser(context.Background(), "1", "1")
+		assert.Equal(t, domain.ErrCannotFollowSelf, err)
+	})
+}
+
+func TestGetFollowersAndFollowing(t *testing.T) {
+	var queries []*dynamodb.QueryInput
+	mockDynamoDBClient := &MockDynamoDBClient{
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			queries = append(queries, input)
+			if input.IndexName != nil {
+				return &dynamodb.QueryOutput{
+					Items: []map[string]types.AttributeValue{
+						{"UserID": &types.AttributeValueMemberS{Value: "2"}, "FolloweeID": &types.AttributeValueMemberS{Value: "1"}},
+						{"UserID": &types.AttributeValueMemberS{Value: "3"}, "FolloweeID": &types.AttributeValueMemberS{Value: "1"}},
+					},
+					LastEvaluatedKey: map[string]types.AttributeValue{
+						"UserID":     &types.AttributeValueMemberS{Value: "3"},
+						"FolloweeID": &types.AttributeValueMemberS{Value: "1"},
+					},
+				}, nil
+			}
+			return &dynamodb.QueryOutput{
+				Items: []map[string]types.AttributeValue{
+					{"UserID": &types.AttributeValueMemberS{Value: "1"}, "FolloweeID": &types.AttributeValueMemberS{Value: "4"}},
+				},
+			}, nil
+		},
+		GetItemFunc: func(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			assert.Equal(t, "UserTimelines", *input.TableName)
+			return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+				"FollowersCount": &types.AttributeValueMemberN{Value: "3"},
+				"FollowingCount": &types.AttributeValueMemberN{Value: "1"},
+			}}, nil
+		},
+	}
+
+	service := NewDynamoDBUserService(mockDynamoDBClient, &MockRedisClient{})
+
+	t.Run("should list followers through the followers index", func(t *testing.T) {
+		page, err := service.GetFollowers(context.Background(), "1", domain.PageRequest{Limit: 2, Cursor: domain.EncodeCursor("0")})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"2", "3"}, page.UserIDs)
+		assert.Equal(t, int64(3), page.Count)
+		assert.Equal(t, domain.EncodeCursor("3"), page.NextCursor)
+
+		query := queries[len(queries)-1]
+		assert.Equal(t, "FolloweeIDIndex", *query.IndexName)
+		assert.Equal(t, int32(2), *query.Limit)
+		assert.Equal(t, map[string]types.AttributeValue{
+			"FolloweeID": &types.AttributeValueMemberS{Value: "1"},
+			"UserID":     &types.AttributeValueMemberS{Value: "0"},
+		}, query.ExclusiveStartKey)
+	})
+
+	t.Run("should list following from the follower's partition", func(t *testing.T) {
+		queries = nil
+		page, err := service.GetFollowing(context.Background(), "1", domain.PageRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"4"}, page.UserIDs)
+		assert.Equal(t, int64(1), page.Count)
+		assert.Empty(t, page.NextCursor)
+		assert.Nil(t, queries[len(queries)-1].IndexName)
+	})
+
+	t.Run("should read the counts instead of counting the graph", func(t *testing.T) {
+		queries = nil
+		_, err := service.GetFollowers(context.Background(), "1", domain.PageRequest{})
+		assert.NoError(t, err)
+		assert.Len(t, queries, 1)
+	})
+
+	t.Run("should reject invalid cursors", func(t *testing.T) {
+		_, err := service.GetFollowers(context.Background(), "1", domain.PageRequest{Cursor: "!"})
+		assert.Equal(t, domain.ErrInvalidCursor, err)
+	})
+
+	t.Run("should not list followers until their index is built", func(t *testing.T) {
+		queries = nil
+		service.FollowersIndexReady = new(atomic.Bool)
+		defer func() { service.FollowersIndexReady = nil }()
+
+		_, err := service.GetFollowers(context.Background(), "1", domain.PageRequest{})
+		assert.Equal(t, domain.ErrIndexNotReady, err)
+		assert.Empty(t, queries)
+
+		_, err = service.GetFollowing(context.Background(), "1", domain.PageRequest{})
+		assert.NoError(t, err)
 	})
 }
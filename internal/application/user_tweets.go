@@ -0,0 +1,136 @@
+package application
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/domain"
+	"github.com/freischarler/desafio-twitter/internal/snowflake"
+)
+
+const (
+	// userTweetsIndex is the Tweets index keyed by author and sorted by
+	// timestamp
+	userTweetsIndex = "UserIDTimestampIndex"
+
+	// legacyUserTweetsIndex is the Tweets index keyed by author only, read
+	// until userTweetsIndex is built
+	legacyUserTweetsIndex = "UserIDIndex"
+)
+
+// legacyTimestampSlack bounds how much later than its ID the timestamp of a
+// tweet with a legacy ID was taken
+const legacyTimestampSlack = int64(time.Second)
+
+// queryUserTweets retrieves up to limit tweets posted by a user, newest
+// first, with IDs in the range (sinceID, maxID]. The index is read a page at
+// a time from the timestamp of maxID down, so tweets newer than maxID are
+// not read, but for those posted in its millisecond, which are skipped.
+func (s *DynamoRedisTweetService) queryUserTweets(ctx context.Context, userID string, sinceID, maxID int64, limit int) ([]domain.Tweet, error) {
+	if s.UserTweetsIndexReady != nil && !s.UserTweetsIndexReady.Load() {
+		return s.queryLegacyUserTweets(ctx, userID, sinceID, maxID, limit)
+	}
+
+	var tweets []domain.Tweet
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := s.DynamoDBClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String("Tweets"),
+			IndexName:              aws.String(userTweetsIndex),
+			KeyConditionExpression: aws.String("UserID = :userID AND #timestamp <= :maxTimestamp"),
+			// TIMESTAMP is a reserved word
+			ExpressionAttributeNames: map[string]string{
+				"#timestamp": "Timestamp",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":userID":       &types.AttributeValueMemberS{Value: userID},
+				":maxTimestamp": &types.AttributeValueMemberN{Value: strconv.FormatInt(maxTimestamp(maxID), 10)},
+			},
+			ScanIndexForward:  aws.Bool(false),
+			Limit:             aws.Int32(int32(limit)),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Items {
+			if isDeletedItem(item) {
+				continue
+			}
+			tweet := tweetFromItem(item)
+			id, _ := strconv.ParseInt(tweet.TweetID, 10, 64)
+			if id > maxID {
+				continue
+			}
+			if id <= sinceID {
+				return tweets, nil
+			}
+			tweets = append(tweets, tweet)
+			if len(tweets) == limit {
+				return tweets, nil
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return tweets, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+// maxTimestamp returns the latest timestamp of a tweet with an ID up to
+// maxID. New tweets are stamped with the time in their ID, so that is the
+// end of the millisecond of maxID. Legacy IDs were the Unix time of the
+// tweet in nanoseconds, taken just before its timestamp, so they always lie
+// in the past, while a Snowflake ID read as nanoseconds lies years ahead.
+// A Snowflake ID taken for a legacy one only loosens the bound.
+func maxTimestamp(maxID int64) int64 {
+	if maxID <= time.Now().UnixNano() {
+		return maxID + legacyTimestampSlack
+	}
+	return snowflake.Time(maxID).Add(time.Millisecond).UnixNano() - 1
+}
+
+// queryLegacyUserTweets is queryUserTweets on the legacy index. It has no
+// sort key, so every tweet of the user is read and sorted in memory.
+func (s *DynamoRedisTweetService) queryLegacyUserTweets(ctx context.Context, userID string, sinceID, maxID int64, limit int) ([]domain.Tweet, error) {
+	var tweets []domain.Tweet
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := s.DynamoDBClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String("Tweets"),
+			IndexName:              aws.String(legacyUserTweetsIndex),
+			KeyConditionExpression: aws.String("UserID = :userID"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":userID": &types.AttributeValueMemberS{Value: userID},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Items {
+			if isDeletedItem(item) {
+				continue
+			}
+			tweets = append(tweets, tweetFromItem(item))
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = result.LastEvaluatedKey
+	}
+
+	sort.Slice(tweets, func(i, j int) bool {
+		return tweetIDValue(tweets[i]) > tweetIDValue(tweets[j])
+	})
+	return filterTimeline(tweets, sinceID, maxID, limit), nil
+}
@@ -0,0 +1,171 @@
+package application
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/freischarler/desafio-twitter/internal/snowflake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryUserTweets(t *testing.T) {
+	// The user posted tweets 1 to 9, one per millisecond but for 4 and 5,
+	// posted in the same one; the index returns them newest first, a page at
+	// a time
+	start := time.Now().UnixMilli() - snowflake.Epoch
+	ids := make([]int64, 10)
+	for n := 1; n < len(ids); n++ {
+		ids[n] = (start+int64(n))<<22 + int64(n)
+	}
+	ids[5] = ids[4] + 1
+	id := func(n int) string { return strconv.FormatInt(ids[n], 10) }
+
+	var queries []*dynamodb.QueryInput
+	mockDynamoDBClient := &MockDynamoDBClient{
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			queries = append(queries, input)
+
+			next := len(ids) - 1
+			if input.ExclusiveStartKey != nil {
+				for n := range ids {
+					if id(n) == stringAttr(input.ExclusiveStartKey, "TweetID") {
+						next = n - 1
+					}
+				}
+			}
+
+			var items []map[string]types.AttributeValue
+			for n := next; n > 0 && len(items) < int(aws.ToInt32(input.Limit)); n-- {
+				timestamp := tweetTimestamp(ids[n])
+				if timestamp > numberAttr(input.ExpressionAttributeValues, ":maxTimestamp") {
+					continue
+				}
+				items = append(items, map[string]types.AttributeValue{
+					"TweetID":   &types.AttributeValueMemberS{Value: id(n)},
+					"UserID":    &types.AttributeValueMemberS{Value: "star"},
+					"Timestamp": &types.AttributeValueMemberN{Value: strconv.FormatInt(timestamp, 10)},
+				})
+			}
+
+			output := &dynamodb.QueryOutput{Items: items}
+			if len(items) == int(aws.ToInt32(input.Limit)) && stringAttr(items[len(items)-1], "TweetID") != id(1) {
+				last := items[len(items)-1]
+				output.LastEvaluatedKey = map[string]types.AttributeValue{
+					"TweetID":   last["TweetID"],
+					"UserID":    last["UserID"],
+					"Timestamp": last["Timestamp"],
+				}
+			}
+			return output, nil
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, &MockRedisClient{})
+
+	tweetIDs := func(t *testing.T, sinceID, maxID int64, limit int) []string {
+		queries = nil
+		tweets, err := service.queryUserTweets(context.Background(), "star", sinceID, maxID, limit)
+		assert.NoError(t, err)
+		var tweetIDs []string
+		for _, tweet := range tweets {
+			tweetIDs = append(tweetIDs, tweet.TweetID)
+		}
+		return tweetIDs
+	}
+
+	t.Run("should query the index of the user newest first", func(t *testing.T) {
+		assert.Equal(t, []string{id(9), id(8), id(7)}, tweetIDs(t, 0, math.MaxInt64, 3))
+
+		assert.Len(t, queries, 1)
+		assert.Equal(t, "Tweets", aws.ToString(queries[0].TableName))
+		assert.Equal(t, userTweetsIndex, aws.ToString(queries[0].IndexName))
+		assert.False(t, aws.ToBool(queries[0].ScanIndexForward))
+		assert.Equal(t, int32(3), aws.ToInt32(queries[0].Limit))
+	})
+
+	t.Run("should start reading at the timestamp of max_id", func(t *testing.T) {
+		assert.Equal(t, []string{id(7), id(6)}, tweetIDs(t, 0, ids[7], 2))
+		assert.Len(t, queries, 1)
+		assert.Equal(t, "UserID = :userID AND #timestamp <= :maxTimestamp", aws.ToString(queries[0].KeyConditionExpression))
+	})
+
+	t.Run("should skip tweets newer than max_id in its millisecond", func(t *testing.T) {
+		assert.Equal(t, []string{id(4), id(3)}, tweetIDs(t, 0, ids[4], 2))
+		assert.Len(t, queries, 2)
+		assert.NotNil(t, queries[1].ExclusiveStartKey)
+	})
+
+	t.Run("should bound legacy IDs by their timestamp", func(t *testing.T) {
+		legacyID := time.Now().Add(-time.Hour).UnixNano()
+		assert.Equal(t, legacyID+legacyTimestampSlack, maxTimestamp(legacyID))
+	})
+
+	t.Run("should stop at since_id", func(t *testing.T) {
+		assert.Equal(t, []string{id(9), id(8)}, tweetIDs(t, ids[7], math.MaxInt64, 5))
+		assert.Len(t, queries, 1)
+	})
+
+	t.Run("should stop when the user has no more tweets", func(t *testing.T) {
+		assert.Equal(t, []string{id(2), id(1)}, tweetIDs(t, 0, ids[2], 5))
+	})
+}
+
+func TestQueryLegacyUserTweets(t *testing.T) {
+	// The legacy index has no sort key: it returns the tweets of the user in
+	// any order, over two pages
+	var queries []*dynamodb.QueryInput
+	mockDynamoDBClient := &MockDynamoDBClient{
+		QueryFunc: func(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			queries = append(queries, input)
+
+			ids := []string{"3", "9", "1"}
+			output := &dynamodb.QueryOutput{}
+			if input.ExclusiveStartKey == nil {
+				ids = []string{"5", "2", "7"}
+				output.LastEvaluatedKey = map[string]types.AttributeValue{
+					"TweetID": &types.AttributeValueMemberS{Value: "7"},
+				}
+			}
+			for _, id := range ids {
+				output.Items = append(output.Items, map[string]types.AttributeValue{
+					"TweetID": &types.AttributeValueMemberS{Value: id},
+					"UserID":  &types.AttributeValueMemberS{Value: "star"},
+				})
+			}
+			return output, nil
+		},
+	}
+
+	service := NewDynamoRedisTweetService(mockDynamoDBClient, &MockRedisClient{})
+	service.UserTweetsIndexReady = new(atomic.Bool)
+
+	t.Run("should read the legacy index until the sorted one is built", func(t *testing.T) {
+		queries = nil
+		tweets, err := service.queryUserTweets(context.Background(), "star", 2, 8, 3)
+		assert.NoError(t, err)
+
+		var ids []string
+		for _, tweet := range tweets {
+			ids = append(ids, tweet.TweetID)
+		}
+		assert.Equal(t, []string{"7", "5", "3"}, ids)
+
+		assert.Len(t, queries, 2)
+		assert.Equal(t, legacyUserTweetsIndex, aws.ToString(queries[0].IndexName))
+	})
+
+	t.Run("should switch to the sorted index once it is built", func(t *testing.T) {
+		queries = nil
+		service.UserTweetsIndexReady.Store(true)
+		_, err := service.queryUserTweets(context.Background(), "star", 0, 100, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, userTweetsIndex, aws.ToString(queries[0].IndexName))
+	})
+}
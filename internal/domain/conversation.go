@@ -0,0 +1,57 @@
+package domain
+
+import "sort"
+
+// ConversationNode is a tweet in a conversation tree along with its replies,
+// oldest first
+type ConversationNode struct {
+	Tweet   Tweet              `json:"tweet"`
+	Replies []ConversationNode `json:"replies"`
+}
+
+// ConversationRootID returns the ID of the tweet that started the
+// conversation a tweet belongs to
+func ConversationRootID(tweet Tweet) string {
+	if tweet.ConversationID != "" {
+		return tweet.ConversationID
+	}
+	return tweet.TweetID
+}
+
+// BuildConversationTree arranges the tweets of a conversation into a tree
+// under its root. Replies to tweets that are no longer part of the
+// conversation, e.g. because they were deleted, hang from the root.
+func BuildConversationTree(root Tweet, tweets []Tweet) ConversationNode {
+	sorted := make([]Tweet, 0, len(tweets))
+	inConversation := map[string]bool{root.TweetID: true}
+	for _, tweet := range tweets {
+		if inConversation[tweet.TweetID] {
+			continue
+		}
+		inConversation[tweet.TweetID] = true
+		sorted = append(sorted, tweet)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp < sorted[j].Timestamp
+	})
+
+	replies := make(map[string][]Tweet)
+	for _, tweet := range sorted {
+		parentID := tweet.InReplyToTweetID
+		if !inConversation[parentID] {
+			parentID = root.TweetID
+		}
+		replies[parentID] = append(replies[parentID], tweet)
+	}
+
+	var build func(tweet Tweet) ConversationNode
+	build = func(tweet Tweet) ConversationNode {
+		node := ConversationNode{Tweet: tweet, Replies: []ConversationNode{}}
+		for _, reply := range replies[tweet.TweetID] {
+			node.Replies = append(node.Replies, build(reply))
+		}
+		return node
+	}
+
+	return build(root)
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildConversationTree(t *testing.T) {
+	root := Tweet{TweetID: "1", Timestamp: 1, ConversationID: "1"}
+	tweets := []Tweet{
+		{TweetID: "4", Timestamp: 4, InReplyToTweetID: "2", ConversationID: "1"},
+		{TweetID: "3", Timestamp: 3, InReplyToTweetID: "1", ConversationID: "1"},
+		{TweetID: "2", Timestamp: 2, InReplyToTweetID: "1", ConversationID: "1"},
+		root,
+	}
+
+	tree := BuildConversationTree(root, tweets)
+
+	assert.Equal(t, "1", tree.Tweet.TweetID)
+	assert.Len(t, tree.Replies, 2)
+	assert.Equal(t, "2", tree.Replies[0].Tweet.TweetID)
+	assert.Equal(t, "3", tree.Replies[1].Tweet.TweetID)
+	assert.Len(t, tree.Replies[0].Replies, 1)
+	assert.Equal(t, "4", tree.Replies[0].Replies[0].Tweet.TweetID)
+	assert.Empty(t, tree.Replies[1].Replies)
+
+	t.Run("should attach replies to deleted tweets to the root", func(t *testing.T) {
+		tree := BuildConversationTree(root, []Tweet{
+			{TweetID: "5", Timestamp: 5, InReplyToTweetID: "deleted", ConversationID: "1"},
+		})
+
+		assert.Len(t, tree.Replies, 1)
+		assert.Equal(t, "5", tree.Replies[0].Tweet.TweetID)
+	})
+}
+
+func TestConversationRootID(t *testing.T) {
+	assert.Equal(t, "1", ConversationRootID(Tweet{TweetID: "2", ConversationID: "1"}))
+	assert.Equal(t, "2", ConversationRootID(Tweet{TweetID: "2"}))
+}
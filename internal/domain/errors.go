@@ -4,7 +4,26 @@ import "errors"
 
 // Define domain-specific errors
 var (
-	ErrCannotFollowSelf = errors.New("cannot follow yourself")
-	ErrTweetTooLong     = errors.New("tweet is too long")
-	ErrTweetNotFound    = errors.New("tweet not found")
+	ErrCannotFollowSelf   = errors.New("cannot follow yourself")
+	ErrTweetTooLong       = errors.New("tweet is too long")
+	ErrTweetEmpty         = errors.New("tweet is empty")
+	ErrTweetNotFound      = errors.New("tweet not found")
+	ErrInvalidTweetID     = errors.New("invalid tweet ID")
+	ErrInvalidCursor      = errors.New("invalid pagination cursor")
+	ErrNotTweetOwner      = errors.New("only the author can delete a tweet")
+	ErrReplyToNotFound    = errors.New("tweet being replied to not found")
+	ErrQuotedNotFound     = errors.New("quoted tweet not found")
+	ErrAlreadyRetweeted   = errors.New("tweet already retweeted")
+	ErrInvalidHashtag     = errors.New("invalid hashtag")
+	ErrRateLimited        = errors.New("too many requests")
+	ErrUnauthenticated    = errors.New("authentication required")
+	ErrNotPrincipal       = errors.New("cannot act as another user")
+	ErrInvalidHandle      = errors.New("handle must be 1 to 15 letters, digits or underscores")
+	ErrInvalidDisplayName = errors.New("display name is too long")
+	ErrInvalidPassword    = errors.New("password must be at least 8 characters and at most 72 bytes")
+	ErrHandleTaken        = errors.New("handle is already taken")
+	ErrInvalidCredentials = errors.New("invalid handle or password")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrDuplicateTweetID   = errors.New("tweet ID already exists")
+	ErrIndexNotReady      = errors.New("not available until a database index is built, try again later")
 )
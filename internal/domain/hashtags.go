@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// hashtagPattern matches #hashtags made of letters, marks, digits and
+// underscores that are not part of a longer word. Full-width number signs
+// start hashtags too.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{M}\p{N}_&#＃])[#＃]([\p{L}\p{M}\p{N}_]+)`)
+
+// hashtagTextPattern matches the text of a hashtag, without the number sign
+var hashtagTextPattern = regexp.MustCompile(`^[\p{L}\p{M}\p{N}_]+$`)
+
+// ExtractHashtags returns the normalized hashtags in a tweet, in order of
+// first appearance and without duplicates. Hashtags made only of digits,
+// like #1, are not hashtags.
+func ExtractHashtags(content string) []string {
+	var hashtags []string
+	seen := make(map[string]bool)
+	for _, match := range hashtagPattern.FindAllStringSubmatch(norm.NFC.String(content), -1) {
+		if !strings.ContainsFunc(match[1], func(r rune) bool { return !unicode.IsDigit(r) }) {
+			continue
+		}
+		tag := NormalizeHashtag(match[1])
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		hashtags = append(hashtags, tag)
+	}
+	return hashtags
+}
+
+// NormalizeHashtag returns the form a hashtag is indexed by, so that
+// hashtags match regardless of case and Unicode composition. A leading
+// number sign is dropped.
+func NormalizeHashtag(tag string) string {
+	tag = strings.TrimLeft(tag, "#＃")
+	return norm.NFC.String(cases.Fold().String(tag))
+}
+
+// ParseHashtag normalizes a hashtag given by a user, such as in a search
+func ParseHashtag(tag string) (string, error) {
+	tag = NormalizeHashtag(tag)
+	if !hashtagTextPattern.MatchString(tag) {
+		return "", ErrInvalidHashtag
+	}
+	return tag, nil
+}
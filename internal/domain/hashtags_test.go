@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{"should find hashtags anywhere in the tweet", "#Go is fun, #golang_rocks!", []string{"go", "golang_rocks"}},
+		{"should fold case and drop duplicates", "#Go #GO #go", []string{"go"}},
+		{"should support non-Latin scripts", "#日本語 #Español #ΣΟΦΙΑ", []string{"日本語", "español", "σοφια"}},
+		{"should match composed and decomposed forms", "#Café #Café", []string{"café"}},
+		{"should support full-width number signs", "＃テスト", []string{"テスト"}},
+		{"should ignore numbers", "we are #1", nil},
+		{"should ignore number signs inside words", "C# and a&#38;b", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ExtractHashtags(tt.content))
+		})
+	}
+}
+
+func TestParseHashtag(t *testing.T) {
+	tag, err := ParseHashtag("#GoLang")
+	assert.NoError(t, err)
+	assert.Equal(t, "golang", tag)
+
+	tag, err = ParseHashtag("Straße")
+	assert.NoError(t, err)
+	assert.Equal(t, "strasse", tag)
+
+	_, err = ParseHashtag("not a tag")
+	assert.Equal(t, ErrInvalidHashtag, err)
+
+	_, err = ParseHashtag("")
+	assert.Equal(t, ErrInvalidHashtag, err)
+}
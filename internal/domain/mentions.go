@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// MaxHandleLength is the longest handle that can be mentioned
+const MaxHandleLength = 15
+
+// mentionPattern matches @handle mentions that are not part of a longer
+// word, such as an email address
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w{1,` + strconv.Itoa(MaxHandleLength) + `})\b`)
+
+// ExtractMentions returns the handles mentioned in a tweet, in order of first
+// appearance and without duplicates
+func ExtractMentions(content string) []string {
+	var mentions []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		handle := match[1]
+		if seen[handle] {
+			continue
+		}
+		seen[handle] = true
+		mentions = append(mentions, handle)
+	}
+	return mentions
+}
@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{"should find mentions anywhere in the tweet", "@alice hi @bob_2, and @carol!", []string{"alice", "bob_2", "carol"}},
+		{"should drop duplicates", "@alice @bob @alice", []string{"alice", "bob"}},
+		{"should ignore email addresses", "mail me at alice@example.com", nil},
+		{"should ignore handles that are too long", "@abcdefghijklmnopq", nil},
+		{"should ignore a lone @", "meet me @ noon", nil},
+		{"should ignore chained mentions", "@alice@bob", []string{"alice"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ExtractMentions(tt.content))
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package domain
+
+import (
+	"encoding/base64"
+	"math"
+	"strconv"
+)
+
+const (
+	// DefaultPageSize is the page size used when none is requested
+	DefaultPageSize = 20
+	// MaxPageSize is the largest page size a client can request
+	MaxPageSize = 100
+)
+
+// PageRequest describes which slice of a timeline to return. Tweet IDs are
+// time ordered, so pages are walked from the newest tweet backwards. Lists
+// that are not timelines, like followers, only use Limit and Cursor.
+type PageRequest struct {
+	// Limit is the maximum number of tweets in the page
+	Limit int
+	// Cursor is the opaque NextCursor of the previous page
+	Cursor string
+	// SinceID only returns tweets newer than this tweet ID
+	SinceID string
+	// MaxID only returns tweets older than or equal to this tweet ID
+	MaxID string
+}
+
+// TimelinePage is a page of tweets, newest first
+type TimelinePage struct {
+	Tweets     []Tweet `json:"tweets"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// UserPage is a page of a list of users, along with the size of the list
+type UserPage struct {
+	UserIDs    []string `json:"userIDs"`
+	Count      int64    `json:"count"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// PageSize returns the requested limit clamped to [1, MaxPageSize]
+func (p PageRequest) PageSize() int {
+	if p.Limit <= 0 {
+		return DefaultPageSize
+	}
+	if p.Limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return p.Limit
+}
+
+// IDRange returns the range of tweet IDs covered by the request: tweets with
+// an ID greater than sinceID and lower than or equal to maxID
+func (p PageRequest) IDRange() (sinceID, maxID int64, err error) {
+	maxID = math.MaxInt64
+
+	if p.SinceID != "" {
+		sinceID, err = strconv.ParseInt(p.SinceID, 10, 64)
+		if err != nil {
+			return 0, 0, ErrInvalidTweetID
+		}
+	}
+
+	if p.MaxID != "" {
+		maxID, err = strconv.ParseInt(p.MaxID, 10, 64)
+		if err != nil {
+			return 0, 0, ErrInvalidTweetID
+		}
+	}
+
+	if p.Cursor != "" {
+		cursorID, err := DecodeCursor(p.Cursor)
+		if err != nil {
+			return 0, 0, err
+		}
+		// The cursor points at the last tweet already returned
+		if cursorID-1 < maxID {
+			maxID = cursorID - 1
+		}
+	}
+
+	return sinceID, maxID, nil
+}
+
+// EncodeCursor returns an opaque cursor pointing at the given tweet ID or
+// list key
+func EncodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// DecodeCursor returns the tweet ID a cursor points at
+func DecodeCursor(cursor string) (int64, error) {
+	key, err := DecodeCursorKey(cursor)
+	if err != nil {
+		return 0, err
+	}
+	tweetID, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	return tweetID, nil
+}
+
+// DecodeCursorKey returns the list key a cursor points at
+func DecodeCursorKey(cursor string) (string, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(decoded) == 0 {
+		return "", ErrInvalidCursor
+	}
+	return string(decoded), nil
+}
+
+// NewTimelinePage builds a page from tweets that are already limited to the
+// page size, setting NextCursor when there may be more tweets to fetch.
+// Duplicate retweets are dropped after the cursor is taken, so a page may
+// hold fewer tweets than the limit and still have a next page.
+func NewTimelinePage(tweets []Tweet, limit int) TimelinePage {
+	page := TimelinePage{Tweets: DedupeRetweets(tweets)}
+	if len(tweets) > 0 && len(tweets) == limit {
+		page.NextCursor = EncodeCursor(tweets[len(tweets)-1].TweetID)
+	}
+	return page
+}
@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageRequestPageSize(t *testing.T) {
+	assert.Equal(t, DefaultPageSize, PageRequest{}.PageSize())
+	assert.Equal(t, 5, PageRequest{Limit: 5}.PageSize())
+	assert.Equal(t, MaxPageSize, PageRequest{Limit: MaxPageSize + 1}.PageSize())
+}
+
+func TestPageRequestIDRange(t *testing.T) {
+	t.Run("should cover every tweet by default", func(t *testing.T) {
+		sinceID, maxID, err := PageRequest{}.IDRange()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), sinceID)
+		assert.Equal(t, int64(math.MaxInt64), maxID)
+	})
+
+	t.Run("should stop before the cursor", func(t *testing.T) {
+		sinceID, maxID, err := PageRequest{SinceID: "10", MaxID: "50", Cursor: EncodeCursor("40")}.IDRange()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(10), sinceID)
+		assert.Equal(t, int64(39), maxID)
+	})
+
+	t.Run("should keep max_id when it is older than the cursor", func(t *testing.T) {
+		_, maxID, err := PageRequest{MaxID: "30", Cursor: EncodeCursor("40")}.IDRange()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(30), maxID)
+	})
+
+	t.Run("should reject invalid values", func(t *testing.T) {
+		_, _, err := PageRequest{SinceID: "abc"}.IDRange()
+		assert.Equal(t, ErrInvalidTweetID, err)
+
+		_, _, err = PageRequest{Cursor: "not a cursor"}.IDRange()
+		assert.Equal(t, ErrInvalidCursor, err)
+	})
+}
+
+func TestNewTimelinePage(t *testing.T) {
+	page := NewTimelinePage([]Tweet{{TweetID: "2"}, {TweetID: "1"}}, 2)
+	assert.Equal(t, EncodeCursor("1"), page.NextCursor)
+
+	page = NewTimelinePage([]Tweet{{TweetID: "2"}}, 2)
+	assert.Empty(t, page.NextCursor)
+
+	page = NewTimelinePage(nil, 2)
+	assert.NotNil(t, page.Tweets)
+}
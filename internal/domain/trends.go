@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultTrendsLimit is the number of trends returned when none is requested
+	DefaultTrendsLimit = 10
+	// MaxTrendsLimit is the largest number of trends a client can request
+	MaxTrendsLimit = 50
+)
+
+// Trend is a hashtag whose use is growing. Velocity compares the uses of the
+// hashtag in the recent window against the uses expected from its baseline:
+// 1 means the hashtag is used as much as usual, 10 ten times as much.
+type Trend struct {
+	Hashtag  string  `json:"hashtag"`
+	Count    int64   `json:"count"`
+	Baseline int64   `json:"baseline"`
+	Velocity float64 `json:"velocity"`
+}
+
+// TrendService counts the use of hashtags over time and ranks the ones that
+// are trending
+type TrendService interface {
+	RecordHashtags(ctx context.Context, hashtags []string) error
+	GetTrends(ctx context.Context, limit int) ([]Trend, error)
+}
+
+// Clock tells the current time. Services take a Clock so that tests can
+// control time.
+type Clock func() time.Time
+
+// TrendWindows are the time windows trends are computed over. The baseline
+// window should be longer than and include the recent window.
+type TrendWindows struct {
+	// Recent is the window the current use of a hashtag is counted in
+	Recent time.Duration
+	// Baseline is the window the usual use of a hashtag is counted in
+	Baseline time.Duration
+	// MinCount is the fewest uses in the recent window for a hashtag to trend
+	MinCount int64
+}
+
+// DefaultTrendWindows compares the last hour against the last day
+var DefaultTrendWindows = TrendWindows{
+	Recent:   time.Hour,
+	Baseline: 24 * time.Hour,
+	MinCount: 2,
+}
+
+// Velocity returns how much faster a hashtag is used in the recent window
+// than its baseline predicts. One use is added to both sides so that rare
+// hashtags do not get huge velocities from a couple of uses.
+func (w TrendWindows) Velocity(count, baseline int64) float64 {
+	expected := float64(baseline) * float64(w.Recent) / float64(w.Baseline)
+	return (float64(count) + 1) / (expected + 1)
+}
+
+// RankTrends ranks the hashtags used at least MinCount times in the recent
+// window by velocity, then by count, and returns at most limit of them.
+// counts and baselines are the uses of each hashtag in the recent and the
+// baseline window.
+func (w TrendWindows) RankTrends(counts, baselines map[string]int64, limit int) []Trend {
+	trends := []Trend{}
+	for hashtag, count := range counts {
+		if count < w.MinCount {
+			continue
+		}
+		baseline := max(baselines[hashtag], count)
+		trends = append(trends, Trend{
+			Hashtag:  hashtag,
+			Count:    count,
+			Baseline: baseline,
+			Velocity: w.Velocity(count, baseline),
+		})
+	}
+
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].Velocity != trends[j].Velocity {
+			return trends[i].Velocity > trends[j].Velocity
+		}
+		if trends[i].Count != trends[j].Count {
+			return trends[i].Count > trends[j].Count
+		}
+		return trends[i].Hashtag < trends[j].Hashtag
+	})
+
+	if len(trends) > limit {
+		trends = trends[:limit]
+	}
+	return trends
+}
+
+// TrendsLimit returns the requested number of trends clamped to
+// [1, MaxTrendsLimit]
+func TrendsLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultTrendsLimit
+	}
+	if limit > MaxTrendsLimit {
+		return MaxTrendsLimit
+	}
+	return limit
+}
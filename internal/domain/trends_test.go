@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrendWindowsVelocity(t *testing.T) {
+	windows := TrendWindows{Recent: time.Hour, Baseline: 24 * time.Hour}
+
+	t.Run("should be about one for steady hashtags", func(t *testing.T) {
+		assert.InDelta(t, 1, windows.Velocity(10, 240), 0.001)
+	})
+
+	t.Run("should grow with the recent uses", func(t *testing.T) {
+		assert.Greater(t, windows.Velocity(50, 240), windows.Velocity(20, 240))
+	})
+
+	t.Run("should damp hashtags with few uses", func(t *testing.T) {
+		assert.Less(t, windows.Velocity(2, 2), windows.Velocity(20, 20))
+	})
+}
+
+func TestTrendWindowsRankTrends(t *testing.T) {
+	windows := TrendWindows{Recent: time.Hour, Baseline: 24 * time.Hour, MinCount: 2}
+
+	counts := map[string]int64{"steady": 100, "rising": 30, "new": 30, "rare": 1}
+	baselines := map[string]int64{"steady": 2400, "rising": 120, "new": 30, "rare": 1}
+
+	t.Run("should rank by velocity rather than count", func(t *testing.T) {
+		trends := windows.RankTrends(counts, baselines, 10)
+		assert.Len(t, trends, 3)
+		assert.Equal(t, "new", trends[0].Hashtag)
+		assert.Equal(t, "rising", trends[1].Hashtag)
+		assert.Equal(t, "steady", trends[2].Hashtag)
+		assert.Equal(t, int64(30), trends[0].Count)
+		assert.Equal(t, int64(120), trends[1].Baseline)
+	})
+
+	t.Run("should return at most limit trends", func(t *testing.T) {
+		trends := windows.RankTrends(counts, baselines, 1)
+		assert.Len(t, trends, 1)
+		assert.Equal(t, "new", trends[0].Hashtag)
+	})
+
+	t.Run("should count recent uses in the baseline", func(t *testing.T) {
+		trends := windows.RankTrends(map[string]int64{"new": 5}, map[string]int64{}, 10)
+		assert.Equal(t, int64(5), trends[0].Baseline)
+	})
+}
+
+func TestTrendsLimit(t *testing.T) {
+	assert.Equal(t, DefaultTrendsLimit, TrendsLimit(0))
+	assert.Equal(t, 5, TrendsLimit(5))
+	assert.Equal(t, MaxTrendsLimit, TrendsLimit(MaxTrendsLimit+1))
+}
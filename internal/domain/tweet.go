@@ -2,10 +2,120 @@ package domain
 
 // Tweet represents a tweet with a timestamp
 type Tweet struct {
-	TweetID   string `json:"tweetID"`
-	UserID    string `json:"userID"`
-	Content   string `json:"content"`
-	Timestamp int64  `json:"timestamp"`
+	TweetID          string    `json:"tweetID"`
+	UserID           string    `json:"userID"`
+	Content          string    `json:"content"`
+	Timestamp        int64     `json:"timestamp"`
+	Type             TweetType `json:"type"`
+	InReplyToTweetID string    `json:"inReplyToTweetID,omitempty"`
+	ConversationID   string    `json:"conversationID,omitempty"`
+
+	// RetweetOfID is the original tweet reshared by a retweet. Retweets copy
+	// the original content but are attributed to the user who reshared it.
+	RetweetOfID string `json:"retweetOfID,omitempty"`
+	// QuotedTweetID is the tweet commented on by a quote tweet
+	QuotedTweetID string `json:"quotedTweetID,omitempty"`
+	// Mentions are the users mentioned in the content, extracted when the
+	// tweet is posted
+	Mentions []string `json:"mentions,omitempty"`
+	// Hashtags are the normalized hashtags in the content, extracted when
+	// the tweet is posted
+	Hashtags []string `json:"hashtags,omitempty"`
+
+	RetweetCount int64 `json:"retweetCount"`
+	QuoteCount   int64 `json:"quoteCount"`
+	LikeCount    int64 `json:"likeCount"`
+
+	// Liked tells whether the user viewing the tweet has liked it
+	Liked bool `json:"liked"`
+}
+
+// TweetType tells original tweets apart from reshares
+type TweetType string
+
+const (
+	TweetTypeOriginal TweetType = "original"
+	TweetTypeRetweet  TweetType = "retweet"
+	TweetTypeQuote    TweetType = "quote"
+)
+
+// ParseTweetType returns the type stored for a tweet. Tweets stored before
+// reshares existed have no type and are originals.
+func ParseTweetType(value string) TweetType {
+	if value == "" {
+		return TweetTypeOriginal
+	}
+	return TweetType(value)
+}
+
+// IsRetweet reports whether the tweet is a pure reshare of another tweet
+func (t Tweet) IsRetweet() bool {
+	return t.Type == TweetTypeRetweet
+}
+
+// OriginalID returns the ID of the tweet whose content is shown: the
+// reshared tweet for retweets, or the tweet itself otherwise
+func (t Tweet) OriginalID() string {
+	if t.IsRetweet() {
+		return t.RetweetOfID
+	}
+	return t.TweetID
 }
 
-const MaxTweetLength = 280
+// DedupeRetweets drops retweets of tweets that already appear in a timeline,
+// either as the original or as a newer retweet. The timeline must be sorted
+// newest first.
+func DedupeRetweets(timeline []Tweet) []Tweet {
+	present := make(map[string]bool, len(timeline))
+	for _, tweet := range timeline {
+		if !tweet.IsRetweet() {
+			present[tweet.TweetID] = true
+		}
+	}
+
+	deduped := make([]Tweet, 0, len(timeline))
+	for _, tweet := range timeline {
+		if tweet.IsRetweet() {
+			if present[tweet.RetweetOfID] {
+				continue
+			}
+			present[tweet.RetweetOfID] = true
+		}
+		deduped = append(deduped, tweet)
+	}
+	return deduped
+}
+
+// PostOptions holds the optional settings of a new tweet
+type PostOptions struct {
+	// InReplyToTweetID is the tweet the new tweet replies to
+	InReplyToTweetID string
+	// QuotedTweetID is the tweet the new tweet quotes
+	QuotedTweetID string
+}
+
+// PostOption configures a new tweet
+type PostOption func(*PostOptions)
+
+// InReplyTo makes the new tweet a reply to another tweet
+func InReplyTo(tweetID string) PostOption {
+	return func(o *PostOptions) {
+		o.InReplyToTweetID = tweetID
+	}
+}
+
+// Quoting makes the new tweet a quote tweet of another tweet
+func Quoting(tweetID string) PostOption {
+	return func(o *PostOptions) {
+		o.QuotedTweetID = tweetID
+	}
+}
+
+// NewPostOptions applies the given options
+func NewPostOptions(opts ...PostOption) PostOptions {
+	var options PostOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
@@ -1,7 +1,17 @@
 package domain
 
+import "context"
+
 type TweetService interface {
-	PostTweet(userID, tweet string) (string, error)
-	GetTweet(tweetID string) (Tweet, error)
-	GetTimeline(userID string) ([]Tweet, error)
+	PostTweet(ctx context.Context, userID, tweet string, opts ...PostOption) (string, error)
+	GetTweet(ctx context.Context, tweetID string) (Tweet, error)
+	GetTimeline(ctx context.Context, userID string, page PageRequest) (TimelinePage, error)
+	DeleteTweet(ctx context.Context, userID, tweetID string) error
+	GetConversation(ctx context.Context, tweetID string) (ConversationNode, error)
+	Retweet(ctx context.Context, userID, tweetID string) (string, error)
+	LikeTweet(ctx context.Context, userID, tweetID string) error
+	UnlikeTweet(ctx context.Context, userID, tweetID string) error
+	GetLikedTweets(ctx context.Context, userID string, page PageRequest) (TimelinePage, error)
+	GetMentions(ctx context.Context, userID string, page PageRequest) (TimelinePage, error)
+	GetHashtagTimeline(ctx context.Context, tag string, page PageRequest) (TimelinePage, error)
 }
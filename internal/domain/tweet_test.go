@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupeRetweets(t *testing.T) {
+	timeline := []Tweet{
+		{TweetID: "6", Type: TweetTypeRetweet, RetweetOfID: "1"},
+		{TweetID: "5", Type: TweetTypeRetweet, RetweetOfID: "9"},
+		{TweetID: "4", Type: TweetTypeRetweet, RetweetOfID: "2"},
+		{TweetID: "3", Type: TweetTypeRetweet, RetweetOfID: "2"},
+		{TweetID: "2", Type: TweetTypeOriginal},
+		{TweetID: "1", Type: TweetTypeQuote, QuotedTweetID: "0"},
+	}
+
+	var tweetIDs []string
+	for _, tweet := range DedupeRetweets(timeline) {
+		tweetIDs = append(tweetIDs, tweet.TweetID)
+	}
+	assert.Equal(t, []string{"5", "2", "1"}, tweetIDs)
+
+	t.Run("should keep only the newest retweet of a tweet missing from the timeline", func(t *testing.T) {
+		deduped := DedupeRetweets(timeline[2:4])
+		assert.Len(t, deduped, 1)
+		assert.Equal(t, "4", deduped[0].TweetID)
+	})
+}
+
+func TestParseTweetType(t *testing.T) {
+	assert.Equal(t, TweetTypeOriginal, ParseTweetType(""))
+	assert.Equal(t, TweetTypeRetweet, ParseTweetType("retweet"))
+}
@@ -1,8 +1,65 @@
 package domain
 
-// User represents a user in the system
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// User represents a registered user in the system
 type User struct {
-	ID        string
-	Followers []string
-	Following []string
+	ID          string `json:"userID"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"displayName"`
+	CreatedAt   int64  `json:"createdAt"`
+}
+
+const (
+	// MaxDisplayNameLength is the longest display name, in characters
+	MaxDisplayNameLength = 50
+	// MinPasswordLength is the shortest password, in characters
+	MinPasswordLength = 8
+	// MaxPasswordBytes is the longest password, in bytes. Longer passwords
+	// would be silently truncated by bcrypt.
+	MaxPasswordBytes = 72
+)
+
+// handlePattern matches the handles users can register, the same ones that
+// can be mentioned
+var handlePattern = regexp.MustCompile(`^\w{1,` + strconv.Itoa(MaxHandleLength) + `}$`)
+
+// Registration is what a user signs up with
+type Registration struct {
+	Handle      string
+	DisplayName string
+	Password    string
+}
+
+// Validate checks a registration and returns it with its display name
+// trimmed. A missing display name defaults to the handle.
+func (r Registration) Validate() (Registration, error) {
+	r.Handle = strings.TrimPrefix(r.Handle, "@")
+	if !handlePattern.MatchString(r.Handle) {
+		return r, ErrInvalidHandle
+	}
+
+	r.DisplayName = strings.TrimSpace(r.DisplayName)
+	if r.DisplayName == "" {
+		r.DisplayName = r.Handle
+	}
+	if utf8.RuneCountInString(r.DisplayName) > MaxDisplayNameLength {
+		return r, ErrInvalidDisplayName
+	}
+
+	if utf8.RuneCountInString(r.Password) < MinPasswordLength || len(r.Password) > MaxPasswordBytes {
+		return r, ErrInvalidPassword
+	}
+	return r, nil
+}
+
+// NormalizeHandle returns the form handles are compared in: handles are
+// unique regardless of case
+func NormalizeHandle(handle string) string {
+	return strings.ToLower(strings.TrimPrefix(handle, "@"))
 }
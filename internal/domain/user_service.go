@@ -1,6 +1,14 @@
 package domain
 
+import "context"
+
 // UserService defines the interface for user-related operations
 type UserService interface {
-	FollowUser(followerID, followeeID string) error
+	FollowUser(ctx context.Context, followerID, followeeID string) error
+	UnfollowUser(ctx context.Context, followerID, followeeID string) error
+	GetFollowers(ctx context.Context, userID string, page PageRequest) (UserPage, error)
+	GetFollowing(ctx context.Context, userID string, page PageRequest) (UserPage, error)
+	Register(ctx context.Context, registration Registration) (User, error)
+	Login(ctx context.Context, handle, password string) (User, error)
+	GetProfile(ctx context.Context, userID string) (User, error)
 }
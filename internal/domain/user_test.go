@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistrationValidate(t *testing.T) {
+	t.Run("should accept a valid registration", func(t *testing.T) {
+		registration, err := Registration{Handle: "@ada_l", DisplayName: "  Ada Lovelace ", Password: "correct horse"}.Validate()
+		assert.NoError(t, err)
+		assert.Equal(t, "ada_l", registration.Handle)
+		assert.Equal(t, "Ada Lovelace", registration.DisplayName)
+	})
+
+	t.Run("should default the display name to the handle", func(t *testing.T) {
+		registration, err := Registration{Handle: "ada", Password: "correct horse"}.Validate()
+		assert.NoError(t, err)
+		assert.Equal(t, "ada", registration.DisplayName)
+	})
+
+	tests := []struct {
+		name         string
+		registration Registration
+		expected     error
+	}{
+		{"should reject an empty handle", Registration{Handle: "", Password: "correct horse"}, ErrInvalidHandle},
+		{"should reject a handle with spaces", Registration{Handle: "ada l", Password: "correct horse"}, ErrInvalidHandle},
+		{"should reject a handle over 15 characters", Registration{Handle: strings.Repeat("a", 16), Password: "correct horse"}, ErrInvalidHandle},
+		{"should reject a display name over 50 characters", Registration{Handle: "ada", DisplayName: strings.Repeat("é", 51), Password: "correct horse"}, ErrInvalidDisplayName},
+		{"should reject a short password", Registration{Handle: "ada", Password: "short"}, ErrInvalidPassword},
+		{"should reject a password over 72 bytes", Registration{Handle: "ada", Password: strings.Repeat("a", 73)}, ErrInvalidPassword},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.registration.Validate()
+			assert.Equal(t, tt.expected, err)
+		})
+	}
+}
+
+func TestNormalizeHandle(t *testing.T) {
+	assert.Equal(t, "ada", NormalizeHandle("@Ada"))
+	assert.Equal(t, NormalizeHandle("ADA"), NormalizeHandle("ada"))
+}
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+const (
+	// MaxTweetLength is the largest weighted length of a tweet
+	MaxTweetLength = 280
+	// URLLength is the weighted length of every URL, however long it is
+	URLLength = 23
+	// WideCharacterWeight is the weighted length of a CJK character
+	WideCharacterWeight = 2
+)
+
+// urlPattern matches http and https URLs. Punctuation right after a URL is
+// not part of it.
+var urlPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s]*[^\s.,;:!?'")\]]`)
+
+// TweetValidationError describes why the content of a tweet is not valid.
+// It wraps ErrTweetEmpty or ErrTweetTooLong, so callers can match it with
+// errors.Is.
+type TweetValidationError struct {
+	Err    error
+	Length int
+	Max    int
+}
+
+func (e *TweetValidationError) Error() string {
+	if e.Err == ErrTweetTooLong {
+		return fmt.Sprintf("%v: %d characters, the maximum is %d", e.Err, e.Length, e.Max)
+	}
+	return e.Err.Error()
+}
+
+func (e *TweetValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateTweet checks the content of a new tweet and returns it normalized
+// to NFC, the form tweets are stored in. Content made only of whitespace is
+// empty.
+func ValidateTweet(content string) (string, error) {
+	content = norm.NFC.String(content)
+
+	if strings.TrimFunc(content, isBlank) == "" {
+		return "", &TweetValidationError{Err: ErrTweetEmpty, Max: MaxTweetLength}
+	}
+
+	if length := TweetLength(content); length > MaxTweetLength {
+		return "", &TweetValidationError{Err: ErrTweetTooLong, Length: length, Max: MaxTweetLength}
+	}
+
+	return content, nil
+}
+
+// TweetLength returns the weighted length of a tweet. Every user-perceived
+// character counts once, so an emoji made of several code points is a
+// single character; CJK characters count WideCharacterWeight times and
+// every URL counts URLLength.
+func TweetLength(content string) int {
+	content = norm.NFC.String(content)
+
+	length := 0
+	last := 0
+	for _, url := range urlPattern.FindAllStringIndex(content, -1) {
+		length += textLength(content[last:url[0]]) + URLLength
+		last = url[1]
+	}
+	return length + textLength(content[last:])
+}
+
+// textLength returns the weighted length of text without URLs
+func textLength(text string) int {
+	length := 0
+	graphemes := uniseg.NewGraphemes(text)
+	for graphemes.Next() {
+		if isWide(graphemes.Runes()[0]) {
+			length += WideCharacterWeight
+		} else {
+			length++
+		}
+	}
+	return length
+}
+
+// isWide reports whether a character is a CJK character
+func isWide(r rune) bool {
+	if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+		return true
+	}
+	return width.LookupRune(r).Kind() == width.EastAsianFullwidth
+}
+
+// isBlank reports whether a character is whitespace or an invisible
+// formatting character, like a zero width space
+func isBlank(r rune) bool {
+	return unicode.IsSpace(r) || unicode.Is(unicode.Cf, r)
+}
@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTweetLength(t *testing.T) {
+	t.Run("should count ASCII characters", func(t *testing.T) {
+		assert.Equal(t, 11, TweetLength("Hello World"))
+	})
+
+	t.Run("should count an emoji as one character", func(t *testing.T) {
+		assert.Equal(t, 1, TweetLength("👍"))
+		assert.Equal(t, 1, TweetLength("👍🏽"))
+		assert.Equal(t, 1, TweetLength("👨‍👩‍👧‍👦"))
+		assert.Equal(t, 1, TweetLength("🇦🇷"))
+	})
+
+	t.Run("should count combining marks with their letter", func(t *testing.T) {
+		assert.Equal(t, 4, TweetLength("cafe\u0301"))
+	})
+
+	t.Run("should weigh CJK characters", func(t *testing.T) {
+		assert.Equal(t, 4, TweetLength("你好"))
+		assert.Equal(t, 6, TweetLength("こんに"))
+		assert.Equal(t, 4, TweetLength("안녕"))
+		assert.Equal(t, 2, TweetLength("Ａ"))
+	})
+
+	t.Run("should count every URL as a fixed length", func(t *testing.T) {
+		assert.Equal(t, URLLength, TweetLength("https://example.com/a/very/long/path?with=query&and=more"))
+		assert.Equal(t, 4+URLLength+1, TweetLength("see http://go.dev."))
+		assert.Equal(t, 2*URLLength+1, TweetLength("https://a.io https://b.io"))
+	})
+}
+
+func TestValidateTweet(t *testing.T) {
+	t.Run("should normalize to NFC", func(t *testing.T) {
+		content, err := ValidateTweet("cafe\u0301")
+		assert.NoError(t, err)
+		assert.Equal(t, "caf\u00e9", content)
+	})
+
+	t.Run("should reject empty content", func(t *testing.T) {
+		for _, content := range []string{"", "   ", "\n\t", "\u200b"} {
+			_, err := ValidateTweet(content)
+			assert.ErrorIs(t, err, ErrTweetEmpty)
+		}
+	})
+
+	t.Run("should accept content up to the maximum length", func(t *testing.T) {
+		_, err := ValidateTweet(strings.Repeat("😀", MaxTweetLength))
+		assert.NoError(t, err)
+
+		_, err = ValidateTweet(strings.Repeat("字", MaxTweetLength/WideCharacterWeight))
+		assert.NoError(t, err)
+	})
+
+	t.Run("should reject content over the maximum length", func(t *testing.T) {
+		_, err := ValidateTweet(strings.Repeat("字", MaxTweetLength/WideCharacterWeight+1))
+		assert.ErrorIs(t, err, ErrTweetTooLong)
+
+		var validationErr *TweetValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, MaxTweetLength+WideCharacterWeight, validationErr.Length)
+		assert.Equal(t, MaxTweetLength, validationErr.Max)
+	})
+
+	t.Run("should not count long URLs against the maximum length", func(t *testing.T) {
+		content := strings.Repeat("a", MaxTweetLength-URLLength-1) + " https://example.com/" + strings.Repeat("x", 300)
+		_, err := ValidateTweet(content)
+		assert.NoError(t, err)
+	})
+}
@@ -16,6 +16,22 @@ const (
 	UserFollowersTable = "UserFollowers"
 	TweetsTable        = "Tweets"
 	UserTimelinesTable = "UserTimelines"
+	HomeTimelinesTable = "HomeTimelines"
+	RetweetsTable      = "Retweets"
+	LikesTable         = "Likes"
+	MentionsTable      = "Mentions"
+	HashtagsTable      = "Hashtags"
+	UsersTable         = "Users"
+	HandlesTable       = "Handles"
+	JobsTable          = "Jobs"
+
+	FollowersIndex     = "FolloweeIDIndex"
+	ConversationsIndex = "ConversationIDIndex"
+	UserTweetsIndex    = "UserIDTimestampIndex"
+
+	// LegacyUserTweetsIndex es el índice por usuario sin clave de
+	// ordenamiento, que se borra con MigrateUserTimelines
+	LegacyUserTweetsIndex = "UserIDIndex"
 )
 
 type DynamoConfigurator struct {
@@ -33,6 +49,36 @@ func (setup DynamoConfigurator) SetupDatabase() {
 	setup.createTableIfNotExists(UserFollowersTable, setup.createUserFollowersTable)
 	setup.createTableIfNotExists(TweetsTable, setup.createTweetsTable)
 	setup.createTableIfNotExists(UserTimelinesTable, setup.createUserTimelinesTable)
+	setup.createTableIfNotExists(HomeTimelinesTable, setup.createHomeTimelinesTable)
+	setup.createTableIfNotExists(RetweetsTable, setup.createRetweetsTable)
+	setup.createTableIfNotExists(LikesTable, setup.createLikesTable)
+	setup.createTableIfNotExists(MentionsTable, setup.createMentionsTable)
+	setup.createTableIfNotExists(HashtagsTable, setup.createHashtagsTable)
+	setup.createTableIfNotExists(UsersTable, setup.createUsersTable)
+	setup.createTableIfNotExists(HandlesTable, setup.createHandlesTable)
+	setup.createTableIfNotExists(JobsTable, setup.createJobsTable)
+
+	// Las tablas UserFollowers creadas antes del grafo dirigido no tienen el
+	// índice de seguidores. Como el de conversaciones, se construye sin
+	// bloquear el arranque.
+	if err := setup.createGlobalSecondaryIndex(UserFollowersTable, followersIndex(), followersIndexAttributes()); err != nil {
+		log.Fatalf("Error creating index %s: %v", FollowersIndex, err)
+	}
+
+	// Las tablas Tweets creadas antes de las respuestas no tienen el índice
+	// de conversaciones. Se construye sin bloquear el arranque, porque en una
+	// tabla grande puede tardar horas; WaitForIndex avisa cuando está listo.
+	if err := setup.createGlobalSecondaryIndex(TweetsTable, conversationsIndex(), conversationsIndexAttributes()); err != nil {
+		log.Fatalf("Error creating index %s: %v", ConversationsIndex, err)
+	}
+
+	// En las tablas Tweets anteriores el índice por usuario, UserIDIndex, no
+	// tenía clave de ordenamiento. El índice nuevo se construye a su lado sin
+	// bloquear el arranque, porque en una tabla grande puede tardar horas;
+	// WaitForIndex avisa cuando está listo.
+	if err := setup.createGlobalSecondaryIndex(TweetsTable, userTweetsIndex(), userTweetsIndexAttributes()); err != nil {
+		log.Fatalf("Error creating index %s: %v", UserTweetsIndex, err)
+	}
 }
 
 // createTableIfNotExists verifica si una tabla existe y, si no, la crea
@@ -0,0 +1,441 @@
+package dynamoDb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// MigrateFollowGraph migra UserFollowers al grafo dirigido. Antes cada follow
+// se guardaba en ambas direcciones (A→B y B→A); como la dirección original no
+// se guardó, los pares existentes se conservan como follows mutuos y se marcan
+// con FollowedAt para distinguirlos de las filas legacy. El índice de
+// seguidores lo crea SetupDatabase.
+func (setup DynamoConfigurator) MigrateFollowGraph() error {
+	migratedAt := strconv.FormatInt(time.Now().UnixNano(), 10)
+	migrated := 0
+
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := setup.client.Scan(context.TODO(), &dynamodb.ScanInput{
+			TableName:         aws.String(UserFollowersTable),
+			FilterExpression:  aws.String("attribute_not_exists(FollowedAt)"),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, item := range result.Items {
+			_, err := setup.client.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+				TableName: aws.String(UserFollowersTable),
+				Key: map[string]types.AttributeValue{
+					"UserID":     item["UserID"],
+					"FolloweeID": item["FolloweeID"],
+				},
+				UpdateExpression:    aws.String("SET FollowedAt = :migratedAt"),
+				ConditionExpression: aws.String("attribute_exists(UserID) AND attribute_not_exists(FollowedAt)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":migratedAt": &types.AttributeValueMemberN{Value: migratedAt},
+				},
+			})
+			if err != nil {
+				var conditionFailed *types.ConditionalCheckFailedException
+				if errors.As(err, &conditionFailed) {
+					// La fila fue borrada o migrada mientras tanto
+					continue
+				}
+				return err
+			}
+			migrated++
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = result.LastEvaluatedKey
+	}
+
+	log.Printf("Migrated %d legacy follow rows in %s", migrated, UserFollowersTable)
+	return nil
+}
+
+// MigrateFollowCounts recalcula los contadores FollowersCount y
+// FollowingCount de UserTimelines a partir de UserFollowers. Los contadores
+// se actualizan con cada follow, así que solo hace falta para los follows
+// anteriores a ellos. Los follows que cambien mientras corre pueden quedar
+// mal contados; volver a ejecutarla los corrige.
+func (setup DynamoConfigurator) MigrateFollowCounts() error {
+	followers := make(map[string]int64)
+	following := make(map[string]int64)
+
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := setup.client.Scan(context.TODO(), &dynamodb.ScanInput{
+			TableName:            aws.String(UserFollowersTable),
+			ProjectionExpression: aws.String("UserID, FolloweeID"),
+			ExclusiveStartKey:    startKey,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, item := range result.Items {
+			userID, _ := item["UserID"].(*types.AttributeValueMemberS)
+			followeeID, _ := item["FolloweeID"].(*types.AttributeValueMemberS)
+			if userID == nil || followeeID == nil {
+				continue
+			}
+			following[userID.Value]++
+			followers[followeeID.Value]++
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = result.LastEvaluatedKey
+	}
+
+	users := make(map[string]bool)
+	for userID := range followers {
+		users[userID] = true
+	}
+	for userID := range following {
+		users[userID] = true
+	}
+
+	for userID := range users {
+		_, err := setup.client.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+			TableName: aws.String(UserTimelinesTable),
+			Key: map[string]types.AttributeValue{
+				"UserID": &types.AttributeValueMemberS{Value: userID},
+			},
+			UpdateExpression: aws.String("SET FollowersCount = :followers, FollowingCount = :following"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":followers": &types.AttributeValueMemberN{Value: strconv.FormatInt(followers[userID], 10)},
+				":following": &types.AttributeValueMemberN{Value: strconv.FormatInt(following[userID], 10)},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Counted the follows of %d users in %s", len(users), UserTimelinesTable)
+	return nil
+}
+
+// MigrateHomeTimelines llena HomeTimelines, el timeline materializado de cada
+// usuario, con los tweets publicados antes de que existiera: cada tweet se
+// copia al timeline de su autor y de cada seguidor. Los seguidores de las
+// celebridades no lo reciben, porque esos tweets se mezclan al leer el
+// timeline. Escribir un tweet que ya estaba no cambia nada, así que se puede
+// ejecutar de nuevo sin problemas.
+func (setup DynamoConfigurator) MigrateHomeTimelines() error {
+	status, err := setup.indexStatus(UserFollowersTable, FollowersIndex)
+	if err != nil {
+		return err
+	}
+	if status != types.IndexStatusActive {
+		return fmt.Errorf("index %s on table %s is not active yet", FollowersIndex, UserFollowersTable)
+	}
+
+	celebrities := make(map[string]bool)
+	migrated := 0
+
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := setup.client.Scan(context.TODO(), &dynamodb.ScanInput{
+			TableName:         aws.String(TweetsTable),
+			FilterExpression:  aws.String("attribute_exists(#timestamp)"),
+			ExclusiveStartKey: startKey,
+			ExpressionAttributeNames: map[string]string{
+				"#timestamp": "Timestamp",
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, item := range result.Items {
+			authorID, _ := item["UserID"].(*types.AttributeValueMemberS)
+			if authorID == nil {
+				continue
+			}
+
+			celebrity, ok := celebrities[authorID.Value]
+			if !ok {
+				celebrity, err = setup.isCelebrity(authorID.Value)
+				if err != nil {
+					return err
+				}
+				celebrities[authorID.Value] = celebrity
+			}
+
+			recipients := []string{authorID.Value}
+			if !celebrity {
+				followers, err := setup.followers(authorID.Value)
+				if err != nil {
+					return err
+				}
+				recipients = append(recipients, followers...)
+			}
+
+			requests := make([]types.WriteRequest, 0, len(recipients))
+			for _, recipientID := range recipients {
+				requests = append(requests, types.WriteRequest{
+					PutRequest: &types.PutRequest{Item: homeTimelineItem(recipientID, item)},
+				})
+			}
+			if err := setup.batchWrite(HomeTimelinesTable, requests); err != nil {
+				return err
+			}
+			migrated++
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = result.LastEvaluatedKey
+	}
+
+	log.Printf("Copied %d tweets to %s", migrated, HomeTimelinesTable)
+	return nil
+}
+
+// homeTimelineItem convierte un ítem de Tweets en un ítem del timeline
+// materializado de un usuario, igual que al publicar
+func homeTimelineItem(userID string, tweet map[string]types.AttributeValue) map[string]types.AttributeValue {
+	item := make(map[string]types.AttributeValue, len(tweet)+1)
+	for name, value := range tweet {
+		item[name] = value
+	}
+	item["AuthorID"] = tweet["UserID"]
+	item["UserID"] = &types.AttributeValueMemberS{Value: userID}
+	if tweetID, ok := tweet["TweetID"].(*types.AttributeValueMemberS); ok {
+		item["TweetID"] = &types.AttributeValueMemberN{Value: tweetID.Value}
+	}
+	return item
+}
+
+// isCelebrity indica si un usuario está marcado como celebridad
+func (setup DynamoConfigurator) isCelebrity(userID string) (bool, error) {
+	result, err := setup.client.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(UserTimelinesTable),
+		Key: map[string]types.AttributeValue{
+			"UserID": &types.AttributeValueMemberS{Value: userID},
+		},
+		ProjectionExpression: aws.String("Celebrity"),
+	})
+	if err != nil {
+		return false, err
+	}
+	celebrity, ok := result.Item["Celebrity"].(*types.AttributeValueMemberBOOL)
+	return ok && celebrity.Value, nil
+}
+
+// followers devuelve los seguidores de un usuario
+func (setup DynamoConfigurator) followers(userID string) ([]string, error) {
+	var followers []string
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := setup.client.Query(context.TODO(), &dynamodb.QueryInput{
+			TableName:              aws.String(UserFollowersTable),
+			IndexName:              aws.String(FollowersIndex),
+			KeyConditionExpression: aws.String("FolloweeID = :userID"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":userID": &types.AttributeValueMemberS{Value: userID},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Items {
+			if follower, ok := item["UserID"].(*types.AttributeValueMemberS); ok {
+				followers = append(followers, follower.Value)
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return followers, nil
+		}
+		startKey = result.LastEvaluatedKey
+	}
+}
+
+// batchWrite escribe ítems de una tabla con BatchWriteItem, de a 25, que es
+// el máximo por pedido. Los ítems que DynamoDB deja sin procesar se vuelven
+// a pedir con espera exponencial.
+func (setup DynamoConfigurator) batchWrite(tableName string, requests []types.WriteRequest) error {
+	for start := 0; start < len(requests); start += 25 {
+		batch := requests[start:min(start+25, len(requests))]
+		backoff := 50 * time.Millisecond
+		for len(batch) > 0 {
+			result, err := setup.client.BatchWriteItem(context.TODO(), &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{tableName: batch},
+			})
+			if err != nil {
+				return err
+			}
+
+			batch = result.UnprocessedItems[tableName]
+			if len(batch) > 0 {
+				time.Sleep(backoff)
+				backoff = min(backoff*2, 5*time.Second)
+			}
+		}
+	}
+	return nil
+}
+
+// MigrateUserTimelines quita de UserTimelines la lista Tweets, que crecía con
+// cada tweet publicado hasta chocar con el límite de 400KB por ítem, y borra
+// el índice UserIDIndex de Tweets, que no tenía clave de ordenamiento. Los
+// tweets de cada usuario ahora se consultan con el índice UserIDTimestampIndex,
+// así que la migración falla si ese índice todavía no está activo. Antes de
+// borrar nada llena HomeTimelines con MigrateHomeTimelines, para que los
+// tweets anteriores sigan en el timeline de cada usuario.
+func (setup DynamoConfigurator) MigrateUserTimelines() error {
+	status, err := setup.indexStatus(TweetsTable, UserTweetsIndex)
+	if err != nil {
+		return err
+	}
+	if status != types.IndexStatusActive {
+		return fmt.Errorf("index %s on table %s is not active yet", UserTweetsIndex, TweetsTable)
+	}
+
+	if err := setup.MigrateHomeTimelines(); err != nil {
+		return err
+	}
+
+	migrated := 0
+
+	var startKey map[string]types.AttributeValue
+	for {
+		result, err := setup.client.Scan(context.TODO(), &dynamodb.ScanInput{
+			TableName:            aws.String(UserTimelinesTable),
+			FilterExpression:     aws.String("attribute_exists(Tweets)"),
+			ProjectionExpression: aws.String("UserID"),
+			ExclusiveStartKey:    startKey,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, item := range result.Items {
+			_, err := setup.client.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+				TableName: aws.String(UserTimelinesTable),
+				Key: map[string]types.AttributeValue{
+					"UserID": item["UserID"],
+				},
+				UpdateExpression: aws.String("REMOVE Tweets"),
+			})
+			if err != nil {
+				return err
+			}
+			migrated++
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = result.LastEvaluatedKey
+	}
+	log.Printf("Removed the tweet list from %d rows in %s", migrated, UserTimelinesTable)
+
+	status, err = setup.indexStatus(TweetsTable, LegacyUserTweetsIndex)
+	if err != nil || status == "" {
+		return err
+	}
+	_, err = setup.client.UpdateTable(context.TODO(), &dynamodb.UpdateTableInput{
+		TableName: aws.String(TweetsTable),
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{
+			{Delete: &types.DeleteGlobalSecondaryIndexAction{IndexName: aws.String(LegacyUserTweetsIndex)}},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to delete index %s on table %s: %v\n", LegacyUserTweetsIndex, TweetsTable, err)
+		return err
+	}
+	log.Printf("Deleting index %s on table %s\n", LegacyUserTweetsIndex, TweetsTable)
+	return nil
+}
+
+// createGlobalSecondaryIndex pide crear un índice global en una tabla
+// existente si todavía no lo tiene, sin esperar a que se construya. Si otra
+// instancia lo pidió al mismo tiempo, el índice ya existe y no es un error.
+func (setup DynamoConfigurator) createGlobalSecondaryIndex(tableName string, index types.GlobalSecondaryIndex, attributes []types.AttributeDefinition) error {
+	status, err := setup.indexStatus(tableName, *index.IndexName)
+	if err != nil || status != "" {
+		return err
+	}
+
+	_, err = setup.client.UpdateTable(context.TODO(), &dynamodb.UpdateTableInput{
+		TableName:            aws.String(tableName),
+		AttributeDefinitions: attributes,
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{
+			{
+				Create: &types.CreateGlobalSecondaryIndexAction{
+					IndexName:             index.IndexName,
+					KeySchema:             index.KeySchema,
+					Projection:            index.Projection,
+					ProvisionedThroughput: index.ProvisionedThroughput,
+				},
+			},
+		},
+	})
+	if err != nil {
+		if status, _ := setup.indexStatus(tableName, *index.IndexName); status != "" {
+			return nil
+		}
+		log.Printf("Failed to create index %s on table %s: %v\n", *index.IndexName, tableName, err)
+		return err
+	}
+	log.Printf("Creating index %s on table %s\n", *index.IndexName, tableName)
+	return nil
+}
+
+// WaitForIndex espera, sin límite de tiempo, a que un índice global esté
+// activo. Sirve para esperar en segundo plano índices cuya construcción puede
+// tardar horas en tablas grandes.
+func (setup DynamoConfigurator) WaitForIndex(tableName, indexName string) error {
+	for {
+		status, err := setup.indexStatus(tableName, indexName)
+		if err != nil {
+			return err
+		}
+		if status == types.IndexStatusActive {
+			return nil
+		}
+		if status == "" {
+			return fmt.Errorf("index %s on table %s does not exist", indexName, tableName)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// indexStatus devuelve el estado de un índice global, o "" si no existe
+func (setup DynamoConfigurator) indexStatus(tableName, indexName string) (types.IndexStatus, error) {
+	table, err := setup.client.DescribeTable(
+		context.TODO(), &dynamodb.DescribeTableInput{TableName: aws.String(tableName)},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	for _, index := range table.Table.GlobalSecondaryIndexes {
+		if aws.ToString(index.IndexName) == indexName {
+			return index.IndexStatus, nil
+		}
+	}
+	return "", nil
+}
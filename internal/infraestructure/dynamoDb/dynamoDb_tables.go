@@ -9,15 +9,13 @@ import (
 // createUserFollowersTable crea la tabla UserFollowers
 func (setup DynamoConfigurator) createUserFollowersTable() error {
 	tableInput := &dynamodb.CreateTableInput{
-		TableName: aws.String(UserFollowersTable),
-		AttributeDefinitions: []types.AttributeDefinition{
-			{AttributeName: aws.String("UserID"), AttributeType: types.ScalarAttributeTypeS},
-			{AttributeName: aws.String("FolloweeID"), AttributeType: types.ScalarAttributeTypeS},
-		},
+		TableName:            aws.String(UserFollowersTable),
+		AttributeDefinitions: followersIndexAttributes(),
 		KeySchema: []types.KeySchemaElement{
 			{AttributeName: aws.String("UserID"), KeyType: types.KeyTypeHash},
 			{AttributeName: aws.String("FolloweeID"), KeyType: types.KeyTypeRange},
 		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{followersIndex()},
 		ProvisionedThroughput: &types.ProvisionedThroughput{
 			ReadCapacityUnits:  aws.Int64(5),
 			WriteCapacityUnits: aws.Int64(5),
@@ -26,31 +24,47 @@ func (setup DynamoConfigurator) createUserFollowersTable() error {
 	return setup.createTable(UserFollowersTable, tableInput)
 }
 
+// followersIndex es el índice de UserFollowers que lista los seguidores de
+// cada usuario
+func followersIndex() types.GlobalSecondaryIndex {
+	return types.GlobalSecondaryIndex{
+		IndexName: aws.String(FollowersIndex),
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("FolloweeID"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("UserID"), KeyType: types.KeyTypeRange},
+		},
+		Projection: &types.Projection{
+			ProjectionType: types.ProjectionTypeKeysOnly,
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+}
+
+// followersIndexAttributes son los atributos que usa el índice de seguidores
+func followersIndexAttributes() []types.AttributeDefinition {
+	return []types.AttributeDefinition{
+		{AttributeName: aws.String("UserID"), AttributeType: types.ScalarAttributeTypeS},
+		{AttributeName: aws.String("FolloweeID"), AttributeType: types.ScalarAttributeTypeS},
+	}
+}
+
 // createTweetsTable crea la tabla Tweets
 func (setup DynamoConfigurator) createTweetsTable() error {
 	tableInput := &dynamodb.CreateTableInput{
 		TableName: aws.String(TweetsTable),
-		AttributeDefinitions: []types.AttributeDefinition{
+		AttributeDefinitions: append([]types.AttributeDefinition{
 			{AttributeName: aws.String("TweetID"), AttributeType: types.ScalarAttributeTypeS},
 			{AttributeName: aws.String("UserID"), AttributeType: types.ScalarAttributeTypeS},
-		},
+		}, conversationsIndexAttributes()...),
 		KeySchema: []types.KeySchemaElement{
 			{AttributeName: aws.String("TweetID"), KeyType: types.KeyTypeHash},
 		},
 		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
-			{
-				IndexName: aws.String("UserIDIndex"),
-				KeySchema: []types.KeySchemaElement{
-					{AttributeName: aws.String("UserID"), KeyType: types.KeyTypeHash},
-				},
-				Projection: &types.Projection{
-					ProjectionType: types.ProjectionTypeAll,
-				},
-				ProvisionedThroughput: &types.ProvisionedThroughput{
-					ReadCapacityUnits:  aws.Int64(5),
-					WriteCapacityUnits: aws.Int64(5),
-				},
-			},
+			userTweetsIndex(),
+			conversationsIndex(),
 		},
 		ProvisionedThroughput: &types.ProvisionedThroughput{
 			ReadCapacityUnits:  aws.Int64(5),
@@ -60,6 +74,63 @@ func (setup DynamoConfigurator) createTweetsTable() error {
 	return setup.createTable(TweetsTable, tableInput)
 }
 
+// userTweetsIndex es el índice de Tweets que lista los tweets de cada
+// usuario ordenados por fecha, reemplazando la lista que crecía sin límite
+// en UserTimelines
+func userTweetsIndex() types.GlobalSecondaryIndex {
+	return types.GlobalSecondaryIndex{
+		IndexName: aws.String(UserTweetsIndex),
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("UserID"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("Timestamp"), KeyType: types.KeyTypeRange},
+		},
+		Projection: &types.Projection{
+			ProjectionType: types.ProjectionTypeAll,
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+}
+
+// userTweetsIndexAttributes son los atributos que usa el índice de tweets
+// por usuario
+func userTweetsIndexAttributes() []types.AttributeDefinition {
+	return []types.AttributeDefinition{
+		{AttributeName: aws.String("UserID"), AttributeType: types.ScalarAttributeTypeS},
+		{AttributeName: aws.String("Timestamp"), AttributeType: types.ScalarAttributeTypeN},
+	}
+}
+
+// conversationsIndex es el índice de Tweets que lista los tweets de cada
+// conversación ordenados por fecha
+func conversationsIndex() types.GlobalSecondaryIndex {
+	return types.GlobalSecondaryIndex{
+		IndexName: aws.String(ConversationsIndex),
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("ConversationID"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("Timestamp"), KeyType: types.KeyTypeRange},
+		},
+		Projection: &types.Projection{
+			ProjectionType: types.ProjectionTypeAll,
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+}
+
+// conversationsIndexAttributes son los atributos que usa el índice de
+// conversaciones
+func conversationsIndexAttributes() []types.AttributeDefinition {
+	return []types.AttributeDefinition{
+		{AttributeName: aws.String("ConversationID"), AttributeType: types.ScalarAttributeTypeS},
+		{AttributeName: aws.String("Timestamp"), AttributeType: types.ScalarAttributeTypeN},
+	}
+}
+
 // createUserTimelinesTable crea la tabla UserTimelines
 func (setup DynamoConfigurator) createUserTimelinesTable() error {
 	tableInput := &dynamodb.CreateTableInput{
@@ -77,3 +148,119 @@ func (setup DynamoConfigurator) createUserTimelinesTable() error {
 	}
 	return setup.createTable(UserTimelinesTable, tableInput)
 }
+
+// createHomeTimelinesTable crea la tabla HomeTimelines, donde se materializa
+// el timeline de cada usuario (fan-out on write)
+func (setup DynamoConfigurator) createHomeTimelinesTable() error {
+	tableInput := &dynamodb.CreateTableInput{
+		TableName: aws.String(HomeTimelinesTable),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("UserID"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("TweetID"), AttributeType: types.ScalarAttributeTypeN},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("UserID"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("TweetID"), KeyType: types.KeyTypeRange},
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+	return setup.createTable(HomeTimelinesTable, tableInput)
+}
+
+// createRetweetsTable crea la tabla Retweets, que guarda un único retweet por
+// usuario y tweet
+func (setup DynamoConfigurator) createRetweetsTable() error {
+	tableInput := &dynamodb.CreateTableInput{
+		TableName: aws.String(RetweetsTable),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("TweetID"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("UserID"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("TweetID"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("UserID"), KeyType: types.KeyTypeRange},
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+	return setup.createTable(RetweetsTable, tableInput)
+}
+
+// createLikesTable crea la tabla Likes, ordenada por tweet dentro de cada
+// usuario para saber con una sola consulta qué tweets de un rango le gustaron
+func (setup DynamoConfigurator) createLikesTable() error {
+	return setup.createTable(LikesTable, tweetIndexTable(LikesTable, "UserID"))
+}
+
+// createMentionsTable crea la tabla Mentions, con los tweets que mencionan a
+// cada usuario
+func (setup DynamoConfigurator) createMentionsTable() error {
+	return setup.createTable(MentionsTable, tweetIndexTable(MentionsTable, "UserID"))
+}
+
+// createHashtagsTable crea la tabla Hashtags, con los tweets de cada hashtag
+// normalizado
+func (setup DynamoConfigurator) createHashtagsTable() error {
+	return setup.createTable(HashtagsTable, tweetIndexTable(HashtagsTable, "Tag"))
+}
+
+// createUsersTable crea la tabla Users, con el perfil y el hash de la
+// contraseña de cada usuario registrado
+func (setup DynamoConfigurator) createUsersTable() error {
+	return setup.createTable(UsersTable, singleKeyTable(UsersTable, "UserID"))
+}
+
+// createHandlesTable crea la tabla Handles, que reserva cada handle
+// normalizado para un único usuario
+func (setup DynamoConfigurator) createHandlesTable() error {
+	return setup.createTable(HandlesTable, singleKeyTable(HandlesTable, "Handle"))
+}
+
+// createJobsTable crea la tabla Jobs, con los trabajos en segundo plano
+// pendientes, como listar una celebridad para cada seguidor
+func (setup DynamoConfigurator) createJobsTable() error {
+	return setup.createTable(JobsTable, singleKeyTable(JobsTable, "JobID"))
+}
+
+// singleKeyTable describe una tabla con una clave de partición de tipo
+// string y sin clave de ordenamiento
+func singleKeyTable(tableName, keyAttribute string) *dynamodb.CreateTableInput {
+	return &dynamodb.CreateTableInput{
+		TableName: aws.String(tableName),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String(keyAttribute), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String(keyAttribute), KeyType: types.KeyTypeHash},
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+}
+
+// tweetIndexTable describe una tabla que lista tweets bajo una clave,
+// ordenados por TweetID para paginarlos igual que el timeline
+func tweetIndexTable(tableName, keyAttribute string) *dynamodb.CreateTableInput {
+	return &dynamodb.CreateTableInput{
+		TableName: aws.String(tableName),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String(keyAttribute), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("TweetID"), AttributeType: types.ScalarAttributeTypeN},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String(keyAttribute), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("TweetID"), KeyType: types.KeyTypeRange},
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+}
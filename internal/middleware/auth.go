@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Principal is the authenticated user a request acts as
+type Principal struct {
+	UserID string
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying the principal
+func ContextWithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal of an authenticated request,
+// and false for anonymous requests
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// ErrInvalidToken is returned for tokens that are malformed, expired or not
+// signed with the key of the authenticator
+var ErrInvalidToken = errors.New("invalid token")
+
+// Authenticator issues and validates bearer tokens: JWTs signed with HMAC
+// SHA-256 whose subject is the ID of the user
+type Authenticator struct {
+	key            []byte
+	now            func() time.Time
+	onUnauthorized http.HandlerFunc
+}
+
+// AuthOption configures an authenticator
+type AuthOption func(*Authenticator)
+
+// WithUnauthorizedHandler sets the handler that answers requests with an
+// invalid token, instead of a plain text 401
+func WithUnauthorizedHandler(handler http.HandlerFunc) AuthOption {
+	return func(a *Authenticator) {
+		a.onUnauthorized = handler
+	}
+}
+
+// WithAuthClock sets the clock tokens are issued and checked against
+func WithAuthClock(now func() time.Time) AuthOption {
+	return func(a *Authenticator) {
+		a.now = now
+	}
+}
+
+// NewAuthenticator creates an authenticator that signs tokens with key
+func NewAuthenticator(key []byte, opts ...AuthOption) *Authenticator {
+	a := &Authenticator{
+		key: key,
+		now: time.Now,
+		onUnauthorized: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// IssueToken returns a token for userID that expires after ttl
+func (a *Authenticator) IssueToken(userID string, ttl time.Duration) (string, error) {
+	now := a.now()
+	claims := jwt.RegisteredClaims{
+		Subject:   userID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.key)
+}
+
+// Authenticate validates a token and returns the principal it was issued to
+func (a *Authenticator) Authenticate(token string) (Principal, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return a.key, nil
+	},
+		// Only accept the algorithm tokens are issued with, so a token
+		// cannot pick how it is verified
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(a.now),
+	)
+	if err != nil || claims.Subject == "" {
+		return Principal{}, ErrInvalidToken
+	}
+	return Principal{UserID: claims.Subject}, nil
+}
+
+// Middleware authenticates requests with an "Authorization: Bearer" header
+// and adds their principal to the request context. Requests without the
+// header go through anonymously, so public routes keep working; handlers
+// that act as a user reject them. Requests with an invalid token are
+// answered by the unauthorized handler.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			a.onUnauthorized(w, r)
+			return
+		}
+		principal, err := a.Authenticate(strings.TrimSpace(token))
+		if err != nil {
+			a.onUnauthorized(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), principal)))
+	})
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticator(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	auth := NewAuthenticator([]byte("secret"), WithAuthClock(func() time.Time { return now }))
+
+	var principal Principal
+	var authenticated bool
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, authenticated = PrincipalFromContext(r.Context())
+	}))
+
+	serve := func(authorization string) *httptest.ResponseRecorder {
+		principal, authenticated = Principal{}, false
+		req := httptest.NewRequest("POST", "/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should add the principal of a valid token to the context", func(t *testing.T) {
+		token, err := auth.IssueToken("1", time.Hour)
+		assert.NoError(t, err)
+
+		rr := serve("Bearer " + token)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.True(t, authenticated)
+		assert.Equal(t, "1", principal.UserID)
+	})
+
+	t.Run("should let anonymous requests through", func(t *testing.T) {
+		rr := serve("")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.False(t, authenticated)
+	})
+
+	t.Run("should reject an expired token", func(t *testing.T) {
+		token, err := auth.IssueToken("1", -time.Minute)
+		assert.NoError(t, err)
+
+		rr := serve("Bearer " + token)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+		assert.False(t, authenticated)
+	})
+
+	t.Run("should reject a token signed with another key", func(t *testing.T) {
+		other := NewAuthenticator([]byte("other"), WithAuthClock(func() time.Time { return now }))
+		token, err := other.IssueToken("1", time.Hour)
+		assert.NoError(t, err)
+
+		rr := serve("Bearer " + token)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should reject unsigned tokens", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.RegisteredClaims{
+			Subject:   "1",
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		assert.NoError(t, err)
+
+		rr := serve("Bearer " + token)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should reject other authorization schemes", func(t *testing.T) {
+		rr := serve("Basic dXNlcjpwYXNz")
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should answer with the unauthorized handler", func(t *testing.T) {
+		var called bool
+		custom := NewAuthenticator([]byte("secret"), WithUnauthorizedHandler(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			w.WriteHeader(http.StatusTeapot)
+		}))
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Authorization", "Bearer not-a-token")
+		custom.Middleware(handler).ServeHTTP(rr, req)
+
+		assert.True(t, called)
+		assert.Equal(t, http.StatusTeapot, rr.Code)
+	})
+}
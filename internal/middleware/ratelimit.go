@@ -13,6 +13,18 @@ type rateLimiter struct {
 	mu       sync.Mutex
 	rate     time.Duration
 	burst    int
+	onLimit  http.HandlerFunc
+}
+
+// RateLimitOption configures a rate limiter
+type RateLimitOption func(*rateLimiter)
+
+// WithLimitHandler sets the handler that answers requests over the limit,
+// instead of a plain text 429
+func WithLimitHandler(handler http.HandlerFunc) RateLimitOption {
+	return func(rl *rateLimiter) {
+		rl.onLimit = handler
+	}
 }
 
 type visitor struct {
@@ -21,11 +33,17 @@ type visitor struct {
 }
 
 // NewRateLimiter creates a new rate limiter middleware
-func NewRateLimiter(rate time.Duration, burst int) *rateLimiter {
+func NewRateLimiter(rate time.Duration, burst int, opts ...RateLimitOption) *rateLimiter {
 	rl := &rateLimiter{
 		visitors: make(map[string]*visitor),
 		rate:     rate,
 		burst:    burst,
+		onLimit: func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		},
+	}
+	for _, opt := range opts {
+		opt(rl)
 	}
 
 	go rl.cleanupVisitors()
@@ -92,7 +110,7 @@ func (rl *rateLimiter) limit(next http.Handler) http.Handler {
 		case <-v.limiter:
 			next.ServeHTTP(w, r)
 		default:
-			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			rl.onLimit(w, r)
 		}
 	})
 }
@@ -109,7 +127,7 @@ func getIP(r *http.Request) string {
 }
 
 // RateLimitMiddleware creates a rate limiting middleware
-func RateLimitMiddleware(rate time.Duration, burst int) func(http.Handler) http.Handler {
-	rl := NewRateLimiter(rate, burst)
+func RateLimitMiddleware(rate time.Duration, burst int, opts ...RateLimitOption) func(http.Handler) http.Handler {
+	rl := NewRateLimiter(rate, burst, opts...)
 	return rl.limit
 }
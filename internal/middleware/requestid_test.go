@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var requestID string
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = RequestID(r.Context())
+	}))
+
+	t.Run("should generate a request ID", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Len(t, requestID, 32)
+		assert.Equal(t, requestID, rr.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("should keep the request ID of the client", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIDHeader, "client-id.1")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, "client-id.1", requestID)
+		assert.Equal(t, "client-id.1", rr.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("should replace an invalid request ID", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIDHeader, "bad id\r\n")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.NotEqual(t, "bad id\r\n", requestID)
+		assert.Len(t, requestID, 32)
+	})
+}
+
+func TestRequestIDOutsideMiddleware(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	assert.Empty(t, RequestID(req.Context()))
+}
@@ -0,0 +1,147 @@
+// Package snowflake generates 64-bit, time ordered IDs that are unique
+// across instances without coordinating them, in the layout of Twitter's
+// Snowflake: 41 bits of milliseconds since Epoch, 10 bits of worker ID and
+// 12 bits of sequence within the millisecond.
+package snowflake
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// Epoch is the time IDs count from, in Unix milliseconds
+	Epoch int64 = 1288834974657
+
+	workerIDBits  = 10
+	sequenceBits  = 12
+	timestampBits = 41
+
+	// MaxWorkerID is the largest worker ID
+	MaxWorkerID int64 = 1<<workerIDBits - 1
+
+	maxSequence  int64 = 1<<sequenceBits - 1
+	maxTimestamp int64 = 1<<timestampBits - 1
+
+	workerIDShift  = sequenceBits
+	timestampShift = sequenceBits + workerIDBits
+)
+
+// DefaultMaxClockRegression is how far the clock may move backwards before
+// Next fails instead of waiting for it to catch up
+const DefaultMaxClockRegression = 10 * time.Millisecond
+
+var (
+	ErrInvalidWorkerID     = errors.New("worker ID must be between 0 and 1023")
+	ErrClockMovedBackwards = errors.New("clock moved backwards")
+	ErrClockOutOfRange     = errors.New("clock is outside the range of IDs")
+)
+
+// Generator generates IDs for one worker. Every instance generating IDs at
+// the same time needs its own worker ID.
+type Generator struct {
+	mu            sync.Mutex
+	workerID      int64
+	clock         func() time.Time
+	maxRegression time.Duration
+
+	lastTimestamp int64
+	sequence      int64
+}
+
+// Option configures a Generator
+type Option func(*Generator)
+
+// WithClock sets the clock IDs are timestamped with, instead of time.Now
+func WithClock(clock func() time.Time) Option {
+	return func(g *Generator) {
+		g.clock = clock
+	}
+}
+
+// WithMaxClockRegression sets how far the clock may move backwards before
+// Next fails, instead of DefaultMaxClockRegression
+func WithMaxClockRegression(maxRegression time.Duration) Option {
+	return func(g *Generator) {
+		g.maxRegression = maxRegression
+	}
+}
+
+// NewGenerator creates a Generator for a worker
+func NewGenerator(workerID int64, opts ...Option) (*Generator, error) {
+	if workerID < 0 || workerID > MaxWorkerID {
+		return nil, ErrInvalidWorkerID
+	}
+
+	g := &Generator{
+		workerID:      workerID,
+		clock:         time.Now,
+		maxRegression: DefaultMaxClockRegression,
+		lastTimestamp: -1,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g, nil
+}
+
+// Next returns a new ID, greater than every ID returned before. When the
+// clock moves backwards by up to the maximum regression, Next waits for it
+// to catch up; further than that, it fails rather than risk a duplicate.
+func (g *Generator) Next() (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	timestamp := g.now()
+	if timestamp < g.lastTimestamp {
+		regression := time.Duration(g.lastTimestamp-timestamp) * time.Millisecond
+		if regression > g.maxRegression {
+			return 0, ErrClockMovedBackwards
+		}
+		timestamp = g.waitUntil(g.lastTimestamp)
+	}
+
+	if timestamp == g.lastTimestamp {
+		g.sequence = (g.sequence + 1) & maxSequence
+		// The sequence ran out for this millisecond
+		if g.sequence == 0 {
+			timestamp = g.waitUntil(g.lastTimestamp + 1)
+		}
+	} else {
+		g.sequence = 0
+	}
+
+	if timestamp < 0 || timestamp > maxTimestamp {
+		return 0, ErrClockOutOfRange
+	}
+
+	g.lastTimestamp = timestamp
+	return timestamp<<timestampShift | g.workerID<<workerIDShift | g.sequence, nil
+}
+
+// now returns the milliseconds since Epoch
+func (g *Generator) now() int64 {
+	return g.clock().UnixMilli() - Epoch
+}
+
+// waitUntil waits until the clock reaches timestamp and returns the time
+// then
+func (g *Generator) waitUntil(timestamp int64) int64 {
+	now := g.now()
+	for now < timestamp {
+		time.Sleep(time.Duration(timestamp-now) * time.Millisecond)
+		now = g.now()
+	}
+	return now
+}
+
+// Time returns the time an ID was generated, to the millisecond
+func Time(id int64) time.Time {
+	return time.UnixMilli(id>>timestampShift + Epoch)
+}
+
+// WorkerID returns the worker that generated an ID
+func WorkerID(id int64) int64 {
+	return id >> workerIDShift & MaxWorkerID
+}
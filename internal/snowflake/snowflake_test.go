@@ -0,0 +1,152 @@
+package snowflake
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sequenceClock returns a clock that answers each call with the next of
+// times, repeating the last one when they run out
+func sequenceClock(times ...time.Time) func() time.Time {
+	var mu sync.Mutex
+	calls := 0
+	return func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		t := times[min(calls, len(times)-1)]
+		calls++
+		return t
+	}
+}
+
+func TestNewGenerator(t *testing.T) {
+	t.Run("should accept every worker ID that fits in 10 bits", func(t *testing.T) {
+		_, err := NewGenerator(0)
+		assert.NoError(t, err)
+		_, err = NewGenerator(MaxWorkerID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should reject worker IDs that do not fit in 10 bits", func(t *testing.T) {
+		_, err := NewGenerator(-1)
+		assert.ErrorIs(t, err, ErrInvalidWorkerID)
+		_, err = NewGenerator(MaxWorkerID + 1)
+		assert.ErrorIs(t, err, ErrInvalidWorkerID)
+	})
+}
+
+func TestNext(t *testing.T) {
+	t0 := time.UnixMilli(1700000000000)
+
+	t.Run("should lay out the timestamp, worker ID and sequence", func(t *testing.T) {
+		generator, err := NewGenerator(42, WithClock(sequenceClock(t0)))
+		assert.NoError(t, err)
+
+		first, err := generator.Next()
+		assert.NoError(t, err)
+		second, err := generator.Next()
+		assert.NoError(t, err)
+
+		assert.Equal(t, t0, Time(first))
+		assert.Equal(t, int64(42), WorkerID(first))
+		assert.Equal(t, int64(0), first&maxSequence)
+		assert.Equal(t, int64(1), second&maxSequence)
+	})
+
+	t.Run("should generate increasing unique IDs concurrently", func(t *testing.T) {
+		generator, err := NewGenerator(1)
+		assert.NoError(t, err)
+
+		const workers, perWorker = 8, 2000
+		ids := make([][]int64, workers)
+		var wg sync.WaitGroup
+		for w := range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range perWorker {
+					id, err := generator.Next()
+					assert.NoError(t, err)
+					ids[w] = append(ids[w], id)
+				}
+			}()
+		}
+		wg.Wait()
+
+		seen := map[int64]bool{}
+		for _, workerIDs := range ids {
+			for i, id := range workerIDs {
+				assert.False(t, seen[id], "duplicate ID %d", id)
+				seen[id] = true
+				if i > 0 {
+					assert.Greater(t, id, workerIDs[i-1])
+				}
+			}
+		}
+		assert.Len(t, seen, workers*perWorker)
+	})
+
+	t.Run("should not collide with another worker in the same millisecond", func(t *testing.T) {
+		a, _ := NewGenerator(1, WithClock(sequenceClock(t0)))
+		b, _ := NewGenerator(2, WithClock(sequenceClock(t0)))
+
+		idA, err := a.Next()
+		assert.NoError(t, err)
+		idB, err := b.Next()
+		assert.NoError(t, err)
+		assert.NotEqual(t, idA, idB)
+	})
+
+	t.Run("should wait for the next millisecond when the sequence runs out", func(t *testing.T) {
+		times := make([]time.Time, maxSequence+2)
+		for i := range times {
+			times[i] = t0
+		}
+		times = append(times, t0.Add(time.Millisecond))
+		generator, _ := NewGenerator(0, WithClock(sequenceClock(times...)))
+
+		var last int64
+		for range maxSequence + 1 {
+			last, _ = generator.Next()
+		}
+		assert.Equal(t, maxSequence, last&maxSequence)
+
+		id, err := generator.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, t0.Add(time.Millisecond), Time(id))
+		assert.Equal(t, int64(0), id&maxSequence)
+		assert.Greater(t, id, last)
+	})
+
+	t.Run("should wait for the clock to catch up after a small regression", func(t *testing.T) {
+		later := t0.Add(5 * time.Millisecond)
+		generator, _ := NewGenerator(0, WithClock(sequenceClock(later, t0, later)))
+
+		first, err := generator.Next()
+		assert.NoError(t, err)
+		second, err := generator.Next()
+		assert.NoError(t, err)
+		assert.Greater(t, second, first)
+		assert.Equal(t, later, Time(second))
+	})
+
+	t.Run("should fail when the clock moves back further than allowed", func(t *testing.T) {
+		later := t0.Add(time.Second)
+		generator, _ := NewGenerator(0, WithClock(sequenceClock(later, t0)))
+
+		_, err := generator.Next()
+		assert.NoError(t, err)
+		_, err = generator.Next()
+		assert.ErrorIs(t, err, ErrClockMovedBackwards)
+	})
+
+	t.Run("should fail before the epoch", func(t *testing.T) {
+		generator, _ := NewGenerator(0, WithClock(sequenceClock(time.UnixMilli(Epoch-1))))
+
+		_, err := generator.Next()
+		assert.ErrorIs(t, err, ErrClockOutOfRange)
+	})
+}